@@ -4,25 +4,29 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
-	"github.com/Gr1shma/notgit/internal/objects/blob"
 	"github.com/Gr1shma/notgit/internal/repository"
 	"github.com/spf13/cobra"
 )
 
 var addVerboseBool bool
+var addForceBool bool
 
 var addCmd = &cobra.Command{
 	Use:   "add <pathspec>...",
 	Short: "Add file contents to the index",
-	Long:  `Add file contents to the index by storing them as blob objects in .notgit/objects.`,
-	Args:  cobra.MinimumNArgs(1),
-	RunE:  addCallback,
+	Long: `Add file contents to the index by storing them as blob objects in .notgit/objects.
+
+Untracked files matched by .notgitignore, .notgit/info/exclude or the global
+excludes file are skipped when adding a directory. Naming an ignored file
+explicitly is an error unless -f is given.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: addCallback,
 }
 
 func init() {
 	addCmd.PersistentFlags().BoolVarP(&addVerboseBool, "verbose", "v", false, "Be verbose and show files as they are added")
+	addCmd.Flags().BoolVarP(&addForceBool, "force", "f", false, "Allow adding otherwise ignored files")
 	rootCmd.AddCommand(addCmd)
 }
 
@@ -32,13 +36,21 @@ func addCallback(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to open repository: %w", err)
 	}
 
-	index, err := repo.LoadIndex()
+	index, err := repo.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Rollback()
+
+	matcher, err := repo.IgnoreMatcher()
 	if err != nil {
-		return fmt.Errorf("failed to load index: %w", err)
+		return err
 	}
+	trackedDirs := trackedDirectories(index.Index)
 
 	repoRoot := filepath.Dir(repo.NotgitDir)
 
+	var ignoredPaths []string
 	for _, pathSpec := range args {
 		if _, err := os.Stat(pathSpec); os.IsNotExist(err) {
 			return fmt.Errorf("pathspec '%s' did not match any files", pathSpec)
@@ -53,44 +65,53 @@ func addCallback(cmd *cobra.Command, args []string) error {
 			if err != nil {
 				return fmt.Errorf("could not get absolute path for %s: %w", path, err)
 			}
-			absNotgitDir, err := filepath.Abs(repo.NotgitDir)
+
+			relativePath, err := filepath.Rel(repoRoot, absPath)
 			if err != nil {
-				return fmt.Errorf("could not get absolute path for repository dir: %w", err)
+				return fmt.Errorf("failed to determine repository-relative path for %s: %w", path, err)
 			}
 
-			if strings.HasPrefix(absPath, absNotgitDir) {
+			if isNotgitDir(relativePath) {
 				if info.IsDir() {
 					return filepath.SkipDir
 				}
 				return nil
 			}
+			relativePath = filepath.ToSlash(relativePath)
 
-			if info.IsDir() {
-				return nil
-			}
-
-			data, err := os.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("failed to read file %s: %w", path, err)
+			if !index.IsTracked(relativePath) && !trackedDirs[relativePath] && relativePath != "." && !addForceBool {
+				ignored, err := matcher.IsIgnored(relativePath, info.IsDir())
+				if err != nil {
+					return err
+				}
+				if ignored {
+					// Only complain about ignored paths that were named explicitly
+					if path == pathSpec {
+						ignoredPaths = append(ignoredPaths, relativePath)
+					}
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
 			}
 
-			b, err := blob.NewBlob(data)
-			if err != nil {
-				return fmt.Errorf("failed to create blob for %s: %w", path, err)
+			if info.IsDir() {
+				return nil
 			}
 
-			hash, err := repo.StoreObject(b)
-			if err != nil {
-				return fmt.Errorf("failed to store object for %s: %w", path, err)
+			stat := repository.StatFromFileInfo(info)
+			if index.IsStatClean(relativePath, stat) {
+				// Unchanged since it was last added, no need to hash it again
+				if addVerboseBool {
+					fmt.Fprintf(cmd.OutOrStdout(), "add '%s'\n", relativePath)
+				}
+				return nil
 			}
 
-			relativePath, err := filepath.Rel(repoRoot, absPath)
-			if err != nil {
-				return fmt.Errorf("failed to determine repository-relative path for %s: %w", path, err)
+			if err := stageFile(repo, index.Index, relativePath, path, info); err != nil {
+				return err
 			}
-			relativePath = filepath.ToSlash(relativePath)
-
-			index.AddEntry(relativePath, hash)
 
 			if addVerboseBool {
 				fmt.Fprintf(cmd.OutOrStdout(), "add '%s'\n", relativePath)
@@ -104,9 +125,19 @@ func addCallback(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	if err := repo.SaveIndex(index); err != nil {
+	if err := index.Commit(); err != nil {
 		return fmt.Errorf("failed to save the index: %w", err)
 	}
 
+	if len(ignoredPaths) > 0 {
+		fmt.Fprintf(cmd.ErrOrStderr(), "The following paths are ignored by one of your %s files:\n", repository.IgnoreFileName)
+		for _, path := range ignoredPaths {
+			fmt.Fprintln(cmd.ErrOrStderr(), path)
+		}
+		fmt.Fprintln(cmd.ErrOrStderr(), "hint: Use -f if you really want to add them.")
+		cmd.SilenceUsage = true
+		return fmt.Errorf("some paths are ignored")
+	}
+
 	return nil
 }
@@ -1,9 +1,8 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/Gr1shma/notgit/internal/repository"
@@ -17,12 +16,13 @@ var (
 )
 
 var branchCmd = &cobra.Command{
-	Use:   "branch [branchName]",
+	Use:   "branch [branchName] [start-point]",
 	Short: "List, create, delete, or rename branches",
 	Long: `Manage branches in notgit.
 
 Without arguments, this shows the existing branches.
-With a branch name, it creates a new branch pointing to the current commit.
+With a branch name, it creates a new branch pointing to the current commit,
+or to <start-point> (any revision) if one is given.
 With -d, deletes the specified branch.
 With -m, renames the given branch.`,
 	Args: cobra.MaximumNArgs(2),
@@ -51,11 +51,19 @@ func branchCallback(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to rename branch: %w", err)
 		}
 	case deleteBranch != "":
-		if err := deleteBranchByName(repo, deleteBranch); err != nil {
+		name, err := repo.ResolveBranchShorthand(deleteBranch)
+		if err != nil {
+			return fmt.Errorf("failed to resolve '%s': %w", deleteBranch, err)
+		}
+		if err := deleteBranchByName(repo, name); err != nil {
 			return fmt.Errorf("failed to delete branch: %w", err)
 		}
 	case len(args) == 1:
-		if err := createBranchFromHEAD(repo, args[0]); err != nil {
+		if err := createBranch(cmd, repo, args[0], ""); err != nil {
+			return fmt.Errorf("failed to create branch: %w", err)
+		}
+	case len(args) == 2:
+		if err := createBranch(cmd, repo, args[0], args[1]); err != nil {
 			return fmt.Errorf("failed to create branch: %w", err)
 		}
 	default:
@@ -68,14 +76,9 @@ func branchCallback(cmd *cobra.Command, args []string) error {
 }
 
 func listBranches(repo *repository.Repository) error {
-	branchesDir := filepath.Join(repo.NotgitDir, "refs", "heads")
-	entries, err := os.ReadDir(branchesDir)
+	refs, err := repo.ListRefs()
 	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Println("No branches found")
-			return nil
-		}
-		return fmt.Errorf("error while reading the branches directory %w", err)
+		return fmt.Errorf("error while reading the branches %w", err)
 	}
 
 	currentBranch, err := repo.GetCurrentBranch()
@@ -83,16 +86,21 @@ func listBranches(repo *repository.Repository) error {
 		return fmt.Errorf("error while getting the current branch %w", err)
 	}
 
-	if len(entries) == 0 {
+	var branches []string
+	for _, ref := range sortedKeys(refs) {
+		if branchName, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+			branches = append(branches, branchName)
+		}
+	}
+
+	if currentBranch == "" {
+		fmt.Printf("* (%s)\n", detachedHEADLabel(repo))
+	} else if len(branches) == 0 {
 		fmt.Println("No branches found")
 		return nil
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		branchName := entry.Name()
+	for _, branchName := range branches {
 		if branchName == currentBranch {
 			fmt.Printf("* %s\n", branchName)
 		} else {
@@ -102,35 +110,45 @@ func listBranches(repo *repository.Repository) error {
 	return nil
 }
 
-func createBranchFromHEAD(repo *repository.Repository, branchName string) error {
-	if strings.Contains(branchName, "/") {
-		return fmt.Errorf("nested branch names are not supported")
+// createBranch creates a branch at startPoint, or at HEAD if startPoint is empty.
+func createBranch(cmd *cobra.Command, repo *repository.Repository, branchName, startPoint string) error {
+	if err := repository.ValidateBranchName(branchName); err != nil {
+		return err
 	}
 
-	branchPath := filepath.Join(repo.NotgitDir, "refs", "heads", branchName)
-	if _, err := os.Stat(branchPath); err == nil {
+	if branchExists(repo, branchName) {
 		return fmt.Errorf("branch '%s' already exists", branchName)
 	}
 
-	headCommitHash, err := repo.GetHEADCommitHash()
-	if err != nil {
-		return fmt.Errorf("failed to get HEAD commit hash: %w", err)
+	var headCommitHash string
+	var err error
+	if startPoint != "" {
+		headCommitHash, err = repo.ResolveCommit(startPoint)
+		if err != nil {
+			return err
+		}
+	} else {
+		headCommitHash, err = repo.GetHEADCommitHash()
+		if err != nil {
+			return fmt.Errorf("failed to get HEAD commit hash: %w", err)
+		}
 	}
 
 	if headCommitHash == "" {
 		return fmt.Errorf("cannot create branch: no commits exist yet")
 	}
 
-	refsHeadsDir := filepath.Join(repo.NotgitDir, "refs", "heads")
-	if err := os.MkdirAll(refsHeadsDir, 0o755); err != nil {
-		return fmt.Errorf("failed to create refs/heads directory: %w", err)
+	source := startPoint
+	if source == "" {
+		source = "HEAD"
 	}
-
-	if err := os.WriteFile(branchPath, []byte(headCommitHash+"\n"), 0o644); err != nil {
+	tx := repo.Refs().Transaction()
+	tx.Create("refs/heads/"+branchName, headCommitHash, "branch: Created from "+source)
+	if err := tx.Commit(reflogSignature()); err != nil {
 		return fmt.Errorf("failed to create branch: %w", err)
 	}
 
-	fmt.Printf("Created branch '%s'\n", branchName)
+	fmt.Fprintf(cmd.OutOrStdout(), "Created branch '%s'\n", branchName)
 	return nil
 }
 
@@ -148,16 +166,17 @@ func deleteBranchByName(repo *repository.Repository, name string) error {
 		return fmt.Errorf("cannot delete the current branch '%s'", name)
 	}
 
-	branchRefPath := filepath.Join(repo.NotgitDir, "refs", "heads", name)
-
-	if _, err := os.Stat(branchRefPath); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("branch '%s' not found", name)
-		}
+	hash, err := repo.Refs().Resolve("refs/heads/" + name)
+	if errors.Is(err, repository.ErrRefNotFound) {
+		return fmt.Errorf("branch '%s' not found", name)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to check branch existence: %w", err)
 	}
 
-	if err := os.Remove(branchRefPath); err != nil {
+	tx := repo.Refs().Transaction()
+	tx.Delete("refs/heads/"+name, hash, "")
+	if err := tx.Commit(reflogSignature()); err != nil {
 		return fmt.Errorf("failed to delete branch '%s': %w", name, err)
 	}
 
@@ -176,49 +195,27 @@ func renameBranch(repo *repository.Repository, oldName, newName string) error {
 		return fmt.Errorf("old and new branch name are same")
 	}
 
-	if strings.Contains(oldName, "/") || strings.Contains(newName, "/") {
-		return fmt.Errorf("nested branch names are not supported")
+	if err := repository.ValidateBranchName(newName); err != nil {
+		return err
 	}
 
-	oldBranchPath := filepath.Join(repo.NotgitDir, "refs", "heads", oldName)
-	newBranchPath := filepath.Join(repo.NotgitDir, "refs", "heads", newName)
-
-	if _, err := os.Stat(oldBranchPath); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("branch '%s' not found", oldName)
-		}
-		return fmt.Errorf("failed to check old branch existence: %w", err)
+	if !branchExists(repo, oldName) {
+		return fmt.Errorf("branch '%s' not found", oldName)
 	}
-
-	if _, err := os.Stat(newBranchPath); err == nil {
+	if branchExists(repo, newName) {
 		return fmt.Errorf("branch '%s' already exists", newName)
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to check new branch existence: %w", err)
 	}
 
-	if err := os.Rename(oldBranchPath, newBranchPath); err != nil {
+	oldRef, newRef := "refs/heads/"+oldName, "refs/heads/"+newName
+	reason := fmt.Sprintf("Branch: renamed %s to %s", oldRef, newRef)
+	if err := repo.Refs().Rename(oldRef, newRef, reflogSignature(), reason); err != nil {
 		return fmt.Errorf("failed to rename branch from '%s' to '%s': %w", oldName, newName, err)
 	}
 
-	currentBranch, err := repo.GetCurrentBranch()
-	if err != nil {
-		// If we can't get current branch, assume it's not the one we renamed
-		// The rename was successful, so don't fail here
-		fmt.Printf("Renamed branch '%s' to '%s'\n", oldName, newName)
-		return nil
-	}
-
-	if currentBranch == oldName {
-		headPath := filepath.Join(repo.NotgitDir, "HEAD")
-		newHeadContent := fmt.Sprintf("ref: refs/heads/%s\n", newName)
-		if err := os.WriteFile(headPath, []byte(newHeadContent), 0o644); err != nil {
-			// Branch was renamed successfully but HEAD update failed
-			// Try to rollback the rename
-			os.Rename(newBranchPath, oldBranchPath)
-			return fmt.Errorf("failed to update HEAD after renaming current branch: %w", err)
-		}
-	}
-
 	fmt.Printf("Renamed branch '%s' to '%s'\n", oldName, newName)
 	return nil
 }
+
+func branchExists(repo *repository.Repository, name string) bool {
+	return repo.Refs().Exists("refs/heads/" + name)
+}
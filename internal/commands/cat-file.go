@@ -2,13 +2,14 @@ package commands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/Gr1shma/notgit/internal/objects/blob"
 	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/objects/tag"
 	"github.com/Gr1shma/notgit/internal/objects/tree"
 	"github.com/Gr1shma/notgit/internal/repository"
 	"github.com/spf13/cobra"
@@ -19,12 +20,15 @@ var catFileTypeBool bool
 var catFileSizeBool bool
 
 var catFileCmd = &cobra.Command{
-	Use:   "cat-file <type-and-size|-t|-s|-p> <object>",
+	Use:   "cat-file <type-and-size|-t|-s|-p> <revision>",
 	Short: "Display the contents of a Git object",
 	Long: `cat-file provides content or type and size information for repository objects.
 With the -p flag, the content of the object is pretty-printed.
 With the -t flag, show the object type.
-With the -s flag, show the object size.`,
+With the -s flag, show the object size.
+
+The object can be given as any revision understood by rev-parse, such as an
+abbreviated hash, HEAD~2 or HEAD:path/to/file.`,
 	Args: cobra.ExactArgs(1),
 	RunE: catFileCallback,
 }
@@ -37,15 +41,6 @@ func init() {
 }
 
 func catFileCallback(cmd *cobra.Command, args []string) error {
-	objectHash := strings.TrimSpace(args[0])
-	
-	if len(objectHash) < 4 {
-		return fmt.Errorf("invalid object hash: %s (too short)", objectHash)
-	}
-	if len(objectHash) != 40 {
-		return fmt.Errorf("invalid object hash: %s (must be 40 characters)", objectHash)
-	}
-
 	flagCount := 0
 	if catFilePrettyBool {
 		flagCount++
@@ -66,15 +61,17 @@ func catFileCallback(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to open repository: %w", err)
 	}
 
-	objDir := filepath.Join(repo.NotgitDir, "objects", objectHash[:2])
-	objFile := filepath.Join(objDir, objectHash[2:])
+	objectHash, err := repo.ResolveRevision(strings.TrimSpace(args[0]))
+	if err != nil {
+		return err
+	}
 
-	data, err := os.ReadFile(objFile)
+	data, err := repo.ReadObject(objectHash)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, os.ErrNotExist) {
 			return fmt.Errorf("object %s not found", objectHash)
 		}
-		return fmt.Errorf("failed to read object file: %w", err)
+		return fmt.Errorf("failed to read object: %w", err)
 	}
 
 	objectType, content, err := parseObjectHeader(data)
@@ -121,7 +118,7 @@ func parseObjectHeader(data []byte) (string, []byte, error) {
 	objectType := parts[0]
 	
 	switch objectType {
-	case "blob", "tree", "commit":
+	case "blob", "tree", "commit", "tag":
 	default:
 		return "", nil, fmt.Errorf("unknown object type: %s", objectType)
 	}
@@ -137,6 +134,8 @@ func prettyPrintObject(cmd *cobra.Command, objectType string, data []byte) error
 		return prettyPrintTree(cmd, data)
 	case "commit":
 		return prettyPrintCommit(cmd, data)
+	case "tag":
+		return prettyPrintTag(cmd, data)
 	default:
 		return fmt.Errorf("unknown object type: %s", objectType)
 	}
@@ -203,15 +202,22 @@ func prettyPrintCommit(cmd *cobra.Command, data []byte) error {
 	return nil
 }
 
-func getModeForType(entryType tree.EntryType) string {
-	switch entryType {
-	case tree.EntryTypeBlob:
-		return "100644"
-	case tree.EntryTypeTree:
-		return "040000"
-	default:
-		return "100644"
+func prettyPrintTag(cmd *cobra.Command, data []byte) error {
+	tagObj, err := tag.DeserializeTag(data)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize tag: %w", err)
 	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "object %s\n", tagObj.Object)
+	fmt.Fprintf(cmd.OutOrStdout(), "type %s\n", tagObj.ObjectType)
+	fmt.Fprintf(cmd.OutOrStdout(), "tag %s\n", tagObj.Name)
+	fmt.Fprintf(cmd.OutOrStdout(), "tagger %s\n", tagObj.Tagger)
+	fmt.Fprintf(cmd.OutOrStdout(), "\n%s\n", tagObj.Message)
+	return nil
+}
+
+func getModeForType(entryType tree.EntryType) string {
+	return tree.ModeForType(entryType)
 }
 
 func getTypeString(entryType tree.EntryType) string {
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/ignore"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var checkIgnoreVerboseBool bool
+var checkIgnoreNonMatchingBool bool
+var checkIgnoreNoIndexBool bool
+
+var checkIgnoreCmd = &cobra.Command{
+	Use:   "check-ignore <pathname>...",
+	Short: "Debug ignore rules",
+	Long: `Print each given path that is ignored by .notgitignore files,
+.notgit/info/exclude or the global excludes file.
+
+With -v, also print the file, line number and pattern that decided, in the
+form "<source>:<line>:<pattern>\t<path>". A matching pattern starting with
+"!" means the path is not ignored. Tracked files are never ignored unless
+--no-index is given.
+
+Exits with status 1 if none of the paths is ignored.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: checkIgnoreCallback,
+}
+
+func init() {
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreVerboseBool, "verbose", "v", false, "Show the pattern matching each path")
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreNonMatchingBool, "non-matching", "n", false, "With -v, also show paths no pattern matches")
+	checkIgnoreCmd.Flags().BoolVar(&checkIgnoreNoIndexBool, "no-index", false, "Do not treat tracked files as not ignored")
+	rootCmd.AddCommand(checkIgnoreCmd)
+}
+
+func checkIgnoreCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	index, err := repo.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+	matcher, err := repo.IgnoreMatcher()
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	anyIgnored := false
+	for _, arg := range args {
+		relPath, err := repoRelativePath(repo, arg)
+		if err != nil {
+			return err
+		}
+		if relPath == "" {
+			return fmt.Errorf("'%s' is outside the repository", arg)
+		}
+
+		isDir := strings.HasSuffix(arg, "/")
+		if info, err := os.Stat(arg); err == nil {
+			isDir = info.IsDir()
+		}
+
+		var pattern *ignore.Pattern
+		if !index.IsTracked(relPath) || checkIgnoreNoIndexBool {
+			if pattern, err = matcher.Match(relPath, isDir); err != nil {
+				return err
+			}
+		}
+		ignored := pattern != nil && !pattern.Negate
+
+		switch {
+		case pattern != nil && checkIgnoreVerboseBool:
+			fmt.Fprintf(out, "%s:%d:%s\t%s\n", pattern.Source, pattern.Line, pattern.Text, arg)
+		case ignored:
+			fmt.Fprintln(out, arg)
+		case pattern == nil && checkIgnoreVerboseBool && checkIgnoreNonMatchingBool:
+			fmt.Fprintf(out, "::\t%s\n", arg)
+		}
+		anyIgnored = anyIgnored || ignored
+	}
+
+	if !anyIgnored {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return fmt.Errorf("no path is ignored")
+	}
+	return nil
+}
+
+// repoRelativePath converts a path given on the command line to a
+// slash-separated path relative to the repository root. It returns "" for
+// the root itself or paths outside the repository.
+func repoRelativePath(repo *repository.Repository, arg string) (string, error) {
+	absPath, err := filepath.Abs(arg)
+	if err != nil {
+		return "", fmt.Errorf("could not get absolute path for %s: %w", arg, err)
+	}
+	relPath, err := filepath.Rel(repo.BaseDir, absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine repository-relative path for %s: %w", arg, err)
+	}
+	relPath = filepath.ToSlash(relPath)
+	if relPath == "." || relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return "", nil
+	}
+	return relPath, nil
+}
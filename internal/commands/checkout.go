@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var checkoutNewBranch string
+var checkoutForceBool bool
+var checkoutDetachBool bool
+
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout [-f] [--detach] [-b <new-branch>] <branch> | <commit> | [<commit>] -- <paths>...",
+	Short: "Switch branches, check out a commit or restore files",
+	Long: `Switch to <branch>, like "notgit switch".
+
+Any other revision (a commit hash, a tag, HEAD~2, ...) is checked out with a
+detached HEAD: HEAD points directly at the commit instead of at a branch.
+--detach does this for a branch name too. When leaving a detached HEAD,
+commits that no branch contains are listed so they can be saved with
+"notgit branch".
+
+With -b, create <new-branch> at the given revision (or HEAD) and switch to it.
+
+With paths, HEAD does not move: "checkout -- <paths>" restores the working
+files from the index, and "checkout <commit> -- <paths>" restores both the
+index and the working files from the commit, like "notgit restore".`,
+	Args: cobra.ArbitraryArgs,
+	RunE: checkoutCallback,
+}
+
+func init() {
+	checkoutCmd.Flags().StringVarP(&checkoutNewBranch, "branch", "b", "", "Create a new branch and switch to it")
+	checkoutCmd.Flags().BoolVarP(&checkoutForceBool, "force", "f", false, "Discard local changes that would be overwritten")
+	checkoutCmd.Flags().BoolVar(&checkoutDetachBool, "detach", false, "Detach HEAD even when given a branch")
+	rootCmd.AddCommand(checkoutCmd)
+}
+
+func checkoutCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 || len(args) > 1 {
+		return checkoutPaths(cmd, repo, args, dash)
+	}
+
+	if checkoutNewBranch != "" {
+		if checkoutDetachBool {
+			return fmt.Errorf("-b cannot be used with --detach")
+		}
+		startPoint := ""
+		if len(args) == 1 {
+			startPoint = args[0]
+		}
+		if branchExists(repo, checkoutNewBranch) {
+			return fmt.Errorf("a branch named '%s' already exists", checkoutNewBranch)
+		}
+		if err := createBranch(cmd, repo, checkoutNewBranch, startPoint); err != nil {
+			return fmt.Errorf("failed to create branch: %w", err)
+		}
+		if err := switchToBranch(cmd, repo, checkoutNewBranch, checkoutForceBool); err != nil {
+			return fmt.Errorf("failed to switch branch: %w", err)
+		}
+		return nil
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("a branch or commit to check out is required")
+	}
+
+	name, err := repo.ResolveBranchShorthand(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve '%s': %w", args[0], err)
+	}
+	if !checkoutDetachBool && !branchExists(repo, name) {
+		if _, err := repo.ResolveCommit(name); err != nil {
+			// Not a revision, so it may be a file to restore
+			return checkoutPaths(cmd, repo, args, -1)
+		}
+	}
+	if checkoutDetachBool || !branchExists(repo, name) {
+		return detachHEAD(cmd, repo, name, checkoutForceBool)
+	}
+
+	if err := switchToBranch(cmd, repo, name, checkoutForceBool); err != nil {
+		return fmt.Errorf("failed to switch branch: %w", err)
+	}
+	return nil
+}
+
+// checkoutPaths restores paths instead of switching: from the index, or
+// into the index and working tree from the commit given before them. dash
+// is the position of "--" in args, or -1 if there is none.
+func checkoutPaths(cmd *cobra.Command, repo *repository.Repository, args []string, dash int) error {
+	if checkoutNewBranch != "" || checkoutDetachBool {
+		return fmt.Errorf("-b and --detach cannot be used with paths")
+	}
+
+	source := ""
+	paths := args
+	switch {
+	case dash > 1:
+		return fmt.Errorf("only one commit may be given before '--'")
+	case dash == 1:
+		source, paths = args[0], args[1:]
+	case dash < 0 && len(args) > 1:
+		if _, err := repo.ResolveCommit(args[0]); err == nil {
+			source, paths = args[0], args[1:]
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no paths given after '--'")
+	}
+
+	cmd.SilenceUsage = true
+	return restorePaths(repo, paths, source, source != "", true)
+}
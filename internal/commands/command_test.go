@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRepo initializes a repository in a temporary directory, makes it the
+// working directory for the rest of the test and sets a global identity in a
+// temporary home directory.
+func newTestRepo(t *testing.T) *repository.Repository {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("EDITOR", "")
+	t.Chdir(t.TempDir())
+
+	runCommand(t, "init", "-q")
+	runCommand(t, "config", "set", "--global", "user.name", "Tester")
+	runCommand(t, "config", "set", "--global", "user.email", "tester@example.com")
+
+	repo, err := repository.OpenRepository(".")
+	require.NoError(t, err)
+	return repo
+}
+
+// execCommand runs notgit with args and returns everything it wrote to its
+// output and error streams.
+func execCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	defer resetFlags(rootCmd)
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+// runCommand is execCommand for commands that must succeed.
+func runCommand(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := execCommand(t, args...)
+	require.NoError(t, err, "notgit %v: %s", args, out)
+	return out
+}
+
+// resetFlags puts the flags of cmd and its subcommands back to their
+// defaults, since they are package variables shared between runs. Init also
+// forgets where a "--" was seen.
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().Init(cmd.Name(), pflag.ContinueOnError)
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(nil)
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// commitFiles writes the given files, stages them and commits them with
+// message, returning the new commit hash.
+func commitFiles(t *testing.T, repo *repository.Repository, message string, files map[string]string) string {
+	t.Helper()
+	for path, content := range files {
+		writeFile(t, path, content)
+		runCommand(t, "add", path)
+	}
+	runCommand(t, "commit", "-m", message)
+	return headHash(t, repo)
+}
+
+func headHash(t *testing.T, repo *repository.Repository) string {
+	t.Helper()
+	hash, err := repo.GetHEADCommitHash()
+	require.NoError(t, err)
+	return hash
+}
+
+func loadIndex(t *testing.T, repo *repository.Repository) *repository.Index {
+	t.Helper()
+	index, err := repo.LoadIndex()
+	require.NoError(t, err)
+	return index
+}
+
+// treeEntries returns the files in the tree of a commit.
+func treeEntries(t *testing.T, repo *repository.Repository, commitHash string) map[string]repository.IndexEntry {
+	t.Helper()
+	index, err := commitIndex(repo, commitHash)
+	require.NoError(t, err)
+	return index.Entries
+}
+
+// withoutStat drops the cached file metadata from index entries so they can
+// be compared with the entries of a tree.
+func withoutStat(entries map[string]repository.IndexEntry) map[string]repository.IndexEntry {
+	stripped := make(map[string]repository.IndexEntry, len(entries))
+	for path, entry := range entries {
+		entry.Stat = nil
+		stripped[path] = entry
+	}
+	return stripped
+}
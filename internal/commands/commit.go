@@ -1,30 +1,64 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Gr1shma/notgit/internal/objects/commit"
-	"github.com/Gr1shma/notgit/internal/objects/tree"
 	"github.com/Gr1shma/notgit/internal/repository"
 	"github.com/Gr1shma/notgit/internal/utils"
 	"github.com/spf13/cobra"
 )
 
 var commitMessageString string
+var commitAllBool bool
+var commitAmendBool bool
+var commitNoEditBool bool
+var commitAllowEmptyBool bool
+var commitAllowEmptyMessageBool bool
+var commitCleanupString string
 
 var commitCmd = &cobra.Command{
-	Use:   "commit -m <message>",
+	Use:   "commit [-a] [--amend] [-m <message>]",
 	Short: "Record changes to the repository",
 	Long: `Stores the current contents of the index in a new commit object.
-A commit message is required to describe the changes being recorded.`,
+
+With -a, modified and deleted tracked files are staged first; new files still
+need "notgit add". With --amend, the new commit replaces HEAD instead: it
+gets the parents and author of HEAD, and its message unless another one is
+given. --no-edit keeps that message without asking.
+
+Without -m, the editor from core.editor or $EDITOR is opened on
+.notgit/COMMIT_EDITMSG. An empty message aborts the commit unless
+--allow-empty-message is given.
+
+--cleanup (or the commit.cleanup config) sets how the message is cleaned up:
+"strip" removes "#" comment lines, trailing whitespace and extra blank
+lines; "whitespace" does the same but keeps comments; "verbatim" keeps the
+message as is; "scissors" is "whitespace" but an edited message is cut at
+the scissors line. "default" strips edited messages and only cleans up
+whitespace otherwise.
+
+A commit whose tree is the same as its parent's is refused unless
+--allow-empty is given; merge commits are always allowed.`,
+	Args: cobra.NoArgs,
 	RunE: commitCallback,
 }
 
 func init() {
-	commitCmd.Flags().StringVarP(&commitMessageString, "message", "m", "", "Commit message (required)")
-	commitCmd.MarkFlagRequired("message")
+	commitCmd.Flags().StringVarP(&commitMessageString, "message", "m", "", "Commit message")
+	commitCmd.Flags().BoolVarP(&commitAllBool, "all", "a", false, "Stage modified and deleted tracked files first")
+	commitCmd.Flags().BoolVar(&commitAmendBool, "amend", false, "Replace the HEAD commit")
+	commitCmd.Flags().BoolVar(&commitNoEditBool, "no-edit", false, "With --amend, reuse the message of HEAD")
+	commitCmd.Flags().BoolVar(&commitAllowEmptyBool, "allow-empty", false, "Allow a commit with the same tree as its parent")
+	commitCmd.Flags().BoolVar(&commitAllowEmptyMessageBool, "allow-empty-message", false, "Allow a commit with an empty message")
+	commitCmd.Flags().StringVar(&commitCleanupString, "cleanup", "", "How to clean up the message: strip, whitespace, verbatim, scissors or default")
 	rootCmd.AddCommand(commitCmd)
 }
 
@@ -43,31 +77,36 @@ func commitCallback(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("user identity not configured")
 	}
 
-	idx, err := repo.LoadIndex()
-	if err != nil {
+	// With -a, the index is locked until the staged changes are committed
+	var idx *repository.Index
+	var lockedIdx *repository.LockedIndex
+	if commitAllBool {
+		if lockedIdx, err = repo.LockIndex(); err != nil {
+			return err
+		}
+		defer lockedIdx.Rollback()
+		idx = lockedIdx.Index
+		if err := stageTrackedChanges(repo, idx); err != nil {
+			return err
+		}
+	} else if idx, err = repo.LoadIndex(); err != nil {
 		return fmt.Errorf("error while getting index from the repository: %w", err)
 	}
 
-	if len(idx.Entries) == 0 {
-		fmt.Fprintln(cmd.OutOrStdout(), "Nothing to commit, working tree clean")
-		return nil
-	}
-
-	commitTree := tree.NewTree()
-	for path, entry := range idx.Entries {
-		commitTree.AddEntry(path, entry.Hash, tree.EntryTypeBlob)
-	}
-	if err := commitTree.ComputeHash(); err != nil {
-		return fmt.Errorf("fatal: failed to compute tree hash: %w", err)
+	if conflicted := idx.ConflictedPaths(); len(conflicted) > 0 {
+		for _, path := range conflicted {
+			fmt.Fprintf(cmd.ErrOrStderr(), "U\t%s\n", path)
+		}
+		cmd.SilenceUsage = true
+		return fmt.Errorf("committing is not possible because you have unmerged files; fix them up and use \"notgit add <file>\"")
 	}
-	treeSHA := commitTree.GetHash()
 
-	_, err = repo.StoreObject(commitTree)
+	mergeHead, err := repo.ReadMergeHead()
 	if err != nil {
-		return fmt.Errorf("fatal: failed to write tree object: %w", err)
+		return err
 	}
 
-	parentSHA, err := repo.GetHEADCommitHash()
+	headSHA, err := repo.GetHEADCommitHash()
 	if err != nil {
 		return fmt.Errorf("failed to read HEAD commit hash: %w", err)
 	}
@@ -78,13 +117,95 @@ func commitCallback(cmd *cobra.Command, args []string) error {
 		Email: authorEmail,
 		Time:  now,
 	}
+	committerSig := authorSig
 
+	// baseSHA is the first parent, whose tree the new commit is compared to
+	baseSHA := headSHA
 	parentHashes := []string{}
-	if parentSHA != "" {
-		parentHashes = append(parentHashes, parentSHA)
+	var amended *commit.Commit
+	if commitAmendBool {
+		cmd.SilenceUsage = true
+		if headSHA == "" {
+			return fmt.Errorf("you have nothing to amend")
+		}
+		if mergeHead != "" {
+			return fmt.Errorf("you are in the middle of a merge -- cannot amend")
+		}
+		if amended, err = repo.RetrieveCommit(headSHA); err != nil {
+			return fmt.Errorf("failed to load HEAD commit: %w", err)
+		}
+		parentHashes = append(parentHashes, amended.ParentHashes...)
+		authorSig = amended.Author
+		baseSHA = ""
+		if len(parentHashes) > 0 {
+			baseSHA = parentHashes[0]
+		}
+	} else {
+		if headSHA != "" {
+			parentHashes = append(parentHashes, headSHA)
+		}
+		if mergeHead != "" {
+			parentHashes = append(parentHashes, mergeHead)
+		}
+	}
+
+	treeSHA, err := repo.WriteTree(idx)
+	if err != nil {
+		return fmt.Errorf("fatal: failed to write tree: %w", err)
 	}
 
-	commitObj := commit.NewCommit(treeSHA, commitMessageString, parentHashes, authorSig, authorSig)
+	if !commitAllowEmptyBool && mergeHead == "" {
+		empty, err := sameTreeAsCommit(repo, treeSHA, baseSHA, len(idx.Entries) == 0)
+		if err != nil {
+			return err
+		}
+		if empty && amended != nil {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("you asked to amend the most recent commit, but doing so would make\nit empty. You can repeat your command with --allow-empty, or you can\nremove the commit entirely with \"notgit reset HEAD^\"")
+		}
+		if empty {
+			return nothingToCommit(cmd, repo)
+		}
+	}
+
+	cleanup := commitCleanupString
+	if !cmd.Flags().Changed("cleanup") {
+		cleanup = lookupConfig("commit.cleanup")
+	}
+	if cleanup != "" && !slices.Contains(cleanupModes, cleanup) {
+		return fmt.Errorf("invalid cleanup mode %s", cleanup)
+	}
+	message := commitMessageString
+	edited := false
+	switch {
+	case cmd.Flags().Changed("message"):
+	case amended != nil && commitNoEditBool:
+		message = amended.Message
+	default:
+		initial := ""
+		if amended != nil {
+			initial = amended.Message
+		} else if initial, err = repo.ReadMergeMessage(); err != nil {
+			return err
+		}
+		if cleanup == "" || cleanup == "default" {
+			cleanup = "strip"
+		}
+		if message, err = editCommitMessage(cmd, repo, idx, baseSHA, initial, cleanup); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		edited = true
+	}
+	if message, err = cleanupCommitMessage(message, cleanup, edited); err != nil {
+		return err
+	}
+	if strings.TrimSpace(message) == "" && !commitAllowEmptyMessageBool {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("aborting commit due to empty commit message")
+	}
+
+	commitObj := commit.NewCommit(treeSHA, message, parentHashes, authorSig, committerSig)
 
 	if err := commitObj.ComputeHash(); err != nil {
 		fmt.Fprintf(os.Stderr, "fatal: failed to compute commit hash: %v\n", err)
@@ -97,26 +218,247 @@ func commitCallback(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("fatal: failed to write commit object: %w\n", err)
 	}
 
-	if err := repo.UpdateHEAD(commitSHA); err != nil {
+	if lockedIdx != nil {
+		if err := lockedIdx.Commit(); err != nil {
+			return fmt.Errorf("failed to save the index: %w", err)
+		}
+	}
+
+	reason := "commit"
+	switch {
+	case amended != nil:
+		reason = "commit (amend)"
+	case headSHA == "":
+		reason = "commit (initial)"
+	case mergeHead != "":
+		reason = "commit (merge)"
+	}
+	subject := strings.SplitN(message, "\n", 2)[0]
+	if err := repo.UpdateHEADFrom(commitSHA, headSHA, committerSig, reason+": "+subject); err != nil {
 		return fmt.Errorf("failed to update HEAD: %w", err)
 	}
 
-	if parentSHA == "" {
-		fmt.Printf("[root-commit %s] %s\n", commitSHA[:7], commitMessageString)
+	if mergeHead != "" {
+		if err := repo.ClearMergeState(); err != nil {
+			return err
+		}
+	}
+
+	if len(parentHashes) == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "[root-commit %s] %s\n", commitSHA[:7], subject)
 	} else {
 		branchName, err := repo.GetCurrentBranch()
 		if err != nil {
 			return fmt.Errorf("failed to get current branch")
 		}
 		if branchName == "" {
-			fmt.Fprintf(cmd.OutOrStdout(), "[%s] %s\n", commitSHA[:7], commitMessageString) // detached HEAD
+			fmt.Fprintf(cmd.OutOrStdout(), "[detached HEAD %s] %s\n", commitSHA[:7], subject)
 		} else {
-			fmt.Fprintf(cmd.OutOrStdout(), "[%s %s] %s\n", branchName, commitSHA[:7], commitMessageString)
+			fmt.Fprintf(cmd.OutOrStdout(), "[%s %s] %s\n", branchName, commitSHA[:7], subject)
+		}
+	}
+	return nil
+}
+
+// stageTrackedChanges records modified and deleted tracked files in the
+// index, as "commit -a" does.
+func stageTrackedChanges(repo *repository.Repository, idx *repository.Index) error {
+	refreshed := false
+	for _, path := range sortedKeys(idx.Entries) {
+		entry := idx.Entries[path]
+		fullPath := filepath.Join(repo.BaseDir, filepath.FromSlash(path))
+		info, err := os.Lstat(fullPath)
+		if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+			idx.RemoveEntry(path)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+
+		hash, err := workingFileHash(idx, path, fullPath, info, &refreshed)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if hash == entry.Hash && fileEntryType(info.Mode()) == entry.Type {
+			continue
+		}
+		if err := stageFile(repo, idx, path, fullPath, info); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// scissorsLine marks where an edited message ends in the scissors cleanup
+// mode; it and everything below it are removed.
+const scissorsLine = "# ------------------------ >8 ------------------------"
+
+var cleanupModes = []string{"default", "strip", "whitespace", "verbatim", "scissors"}
+
+// sameTreeAsCommit reports whether treeSHA is the tree of the commit
+// baseSHA. Without a base commit, only an empty index counts as unchanged.
+func sameTreeAsCommit(repo *repository.Repository, treeSHA, baseSHA string, emptyIndex bool) (bool, error) {
+	if baseSHA == "" {
+		return emptyIndex, nil
+	}
+	base, err := repo.RetrieveCommit(baseSHA)
+	if err != nil {
+		return false, fmt.Errorf("failed to load commit %s: %w", baseSHA, err)
+	}
+	return base.TreeHash == treeSHA, nil
+}
+
+// nothingToCommit shows the status, like Git does when a commit would not
+// change anything, and fails with exit status 1.
+func nothingToCommit(cmd *cobra.Command, repo *repository.Repository) error {
+	status, err := getRepositoryStatus(repo)
+	if err != nil {
+		return fmt.Errorf("error while getting repository status: %w", err)
+	}
+	printStatus(cmd, status)
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return fmt.Errorf("nothing to commit")
+}
+
+// editCommitMessage lets the user write the message in an editor, starting
+// from initial and a commented summary of what is being committed against
+// the tree of baseSHA. The cleanup mode decides how the template explains
+// which lines are kept.
+func editCommitMessage(cmd *cobra.Command, repo *repository.Repository, idx *repository.Index, baseSHA, initial, cleanup string) (string, error) {
+	editor := configuredEditor()
+	if editor == "" {
+		return "", fmt.Errorf("no editor configured; set core.editor or $EDITOR, or use -m")
+	}
+
+	template, err := commitTemplate(repo, idx, baseSHA, initial, cleanup)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(repo.NotgitDir, "COMMIT_EDITMSG")
+	if err := os.WriteFile(path, []byte(template), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write COMMIT_EDITMSG: %w", err)
+	}
+	if err := launchEditor(cmd, editor, path); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("%w\naborting commit; supply the message with -m", err)
+		}
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read COMMIT_EDITMSG: %w", err)
+	}
+	return string(data), nil
+}
+
+// commitTemplate returns the initial content of COMMIT_EDITMSG.
+func commitTemplate(repo *repository.Repository, idx *repository.Index, baseSHA, initial, cleanup string) (string, error) {
+	base, err := commitIndex(repo, baseSHA)
+	if err != nil {
+		return "", err
+	}
+	workingFiles, err := getWorkingDirectoryFiles(repo)
+	if err != nil {
+		return "", fmt.Errorf("failed to read working tree: %w", err)
+	}
+	entries, untracked := buildCompleteStatusEntries(indexFileInfos(base), indexFileInfos(idx), workingFiles)
+
+	var sb strings.Builder
+	if initial = strings.TrimRight(initial, "\n"); initial != "" {
+		sb.WriteString(initial + "\n")
+	}
+	switch cleanup {
+	case "strip":
+		sb.WriteString("\n# Please enter the commit message for your changes. Lines starting\n")
+		sb.WriteString("# with '#' will be ignored, and an empty message aborts the commit.\n#\n")
+	case "scissors":
+		sb.WriteString("\n" + scissorsLine + "\n")
+		sb.WriteString("# Do not modify or remove the line above.\n")
+		sb.WriteString("# Everything below it will be ignored.\n#\n")
+	default:
+		sb.WriteString("\n# Please enter the commit message for your changes. Lines starting\n")
+		sb.WriteString("# with '#' will be kept; you may remove them yourself if you want to.\n")
+		sb.WriteString("# An empty message aborts the commit.\n#\n")
+	}
+
+	if branch, err := repo.GetCurrentBranch(); err == nil && branch != "" {
+		fmt.Fprintf(&sb, "# On branch %s\n", branch)
+	} else {
+		fmt.Fprintf(&sb, "# %s\n", detachedHEADLabel(repo))
+	}
+	writeSection := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "# %s:\n", title)
+		for _, line := range lines {
+			fmt.Fprintf(&sb, "#\t%s\n", line)
+		}
+		sb.WriteString("#\n")
+	}
+	var staged, unstaged []string
+	for _, entry := range getStagedEntries(entries) {
+		staged = append(staged, getStatusString(entry.IndexStatus)+": "+entry.Path)
+	}
+	for _, entry := range getUnstagedEntries(entries) {
+		unstaged = append(unstaged, getStatusString(entry.WorkingStatus)+": "+entry.Path)
+	}
+	writeSection("Changes to be committed", staged)
+	writeSection("Changes not staged for commit", unstaged)
+	writeSection("Untracked files", untracked)
+	return sb.String(), nil
+}
+
+// cleanupCommitMessage applies a commit.cleanup mode to a message. edited
+// tells whether the message comes from the editor: "default" then strips
+// comments, and "scissors" cuts it at the scissors line.
+func cleanupCommitMessage(message, mode string, edited bool) (string, error) {
+	switch mode {
+	case "", "default":
+		if edited {
+			return stripSpace(message, true), nil
+		}
+		return stripSpace(message, false), nil
+	case "strip":
+		return stripSpace(message, true), nil
+	case "whitespace":
+		return stripSpace(message, false), nil
+	case "verbatim":
+		return message, nil
+	case "scissors":
+		if edited {
+			if i := strings.Index(message, scissorsLine+"\n"); i == 0 || (i > 0 && message[i-1] == '\n') {
+				message = message[:i]
+			}
+		}
+		return stripSpace(message, false), nil
+	default:
+		return "", fmt.Errorf("invalid cleanup mode %s", mode)
+	}
+}
+
+// stripSpace removes trailing whitespace, leading and trailing blank lines
+// and repeated blank lines, and with stripComments also lines starting
+// with "#".
+func stripSpace(text string, stripComments bool) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if stripComments && strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
 func getUserIdentity() (name, email string, err error) {
 	localCfg, _, localErr := utils.LoadConfig(false)
 	if localErr == nil {
@@ -141,3 +483,13 @@ func getUserIdentity() (name, email string, err error) {
 	}
 	return name, email, nil
 }
+
+// reflogSignature returns the identity recorded in reflog entries, falling
+// back to a placeholder when no user identity is configured.
+func reflogSignature() commit.Signature {
+	name, email, err := getUserIdentity()
+	if err != nil {
+		name, email = "unknown", "unknown"
+	}
+	return commit.Signature{Name: name, Email: email, Time: time.Now()}
+}
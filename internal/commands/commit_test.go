@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripSpace(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		stripComments bool
+		want          string
+	}{
+		{"empty", "", false, ""},
+		{"trailing whitespace", "subject \t\r\nbody  \n", false, "subject\nbody"},
+		{"leading and trailing blank lines", "\n\n  \nsubject\n\n\n", false, "subject"},
+		{"repeated blank lines collapse", "subject\n\n\n \nbody", false, "subject\n\nbody"},
+		{"comments kept", "subject\n# note", false, "subject\n# note"},
+		{"comments stripped", "# intro\nsubject\n# note\nbody", true, "subject\nbody"},
+		{"blank lines around a comment collapse", "subject\n\n# note\n\nbody", true, "subject\n\nbody"},
+		{"only comments", "# a\n#\n# b\n", true, ""},
+		{"indented hash is not a comment", "subject\n  # kept", true, "subject\n  # kept"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, stripSpace(tt.text, tt.stripComments))
+		})
+	}
+}
+
+func TestCleanupCommitMessage(t *testing.T) {
+	edited := "Subject  \n\n\n# comment\nBody\n" + scissorsLine + "\ndiff below\n"
+
+	tests := []struct {
+		name   string
+		text   string
+		mode   string
+		edited bool
+		want   string
+	}{
+		{"default strips comments when edited", "Subject\n# comment\n", "default", true, "Subject"},
+		{"default keeps comments from -m", "Subject\n# comment\n", "", false, "Subject\n# comment"},
+		{"strip", edited, "strip", false, "Subject\n\nBody\ndiff below"},
+		{"whitespace", edited, "whitespace", true, "Subject\n\n# comment\nBody\n" + scissorsLine + "\ndiff below"},
+		{"verbatim", edited, "verbatim", true, edited},
+		{"scissors cuts an edited message", edited, "scissors", true, "Subject\n\n# comment\nBody"},
+		{"scissors at the start leaves nothing", scissorsLine + "\nSubject\n", "scissors", true, ""},
+		{"scissors must start a line", "Subject " + scissorsLine + "\nBody\n", "scissors", true, "Subject " + scissorsLine + "\nBody"},
+		{"scissors ignored for -m", edited, "scissors", false, "Subject\n\n# comment\nBody\n" + scissorsLine + "\ndiff below"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanupCommitMessage(tt.text, tt.mode, tt.edited)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := cleanupCommitMessage("Subject", "bogus", false)
+	require.ErrorContains(t, err, "invalid cleanup mode")
+}
+
+func TestStageTrackedChanges(t *testing.T) {
+	repo := newTestRepo(t)
+	first := commitFiles(t, repo, "first", map[string]string{"modified.txt": "one\n", "deleted.txt": "gone\n", "same.txt": "same\n"})
+	writeFile(t, "modified.txt", "two\n")
+	require.NoError(t, os.Remove("deleted.txt"))
+	writeFile(t, "untracked.txt", "untracked\n")
+
+	index := loadIndex(t, repo)
+	require.NoError(t, stageTrackedChanges(repo, index))
+
+	require.Equal(t, []string{"modified.txt", "same.txt"}, index.PathsUnder(""))
+	require.NotEqual(t, treeEntries(t, repo, first)["modified.txt"].Hash, index.Entries["modified.txt"].Hash)
+	require.Equal(t, treeEntries(t, repo, first)["same.txt"].Hash, index.Entries["same.txt"].Hash)
+
+	runCommand(t, "commit", "-a", "-m", "second")
+	require.Equal(t, []string{"modified.txt", "same.txt"}, sortedKeys(treeEntries(t, repo, headHash(t, repo))))
+	require.False(t, loadIndex(t, repo).IsTracked("untracked.txt"))
+}
+
+func TestCommitAmendKeepsParents(t *testing.T) {
+	repo := newTestRepo(t)
+	root := commitFiles(t, repo, "root", map[string]string{"f.txt": "one\n"})
+	second := commitFiles(t, repo, "second", map[string]string{"f.txt": "two\n"})
+
+	runCommand(t, "commit", "--amend", "-m", "second, reworded")
+
+	amended, err := repo.RetrieveCommit(headHash(t, repo))
+	require.NoError(t, err)
+	require.NotEqual(t, second, headHash(t, repo))
+	require.Equal(t, []string{root}, amended.ParentHashes)
+	require.Equal(t, "second, reworded", amended.Message)
+
+	// Amending a merge commit keeps both of its parents
+	runCommand(t, "branch", "topic")
+	ours := commitFiles(t, repo, "ours", map[string]string{"ours.txt": "ours\n"})
+	runCommand(t, "switch", "topic")
+	theirs := commitFiles(t, repo, "theirs", map[string]string{"theirs.txt": "theirs\n"})
+	runCommand(t, "switch", "master")
+	runCommand(t, "merge", "topic")
+	merge, err := repo.RetrieveCommit(headHash(t, repo))
+	require.NoError(t, err)
+	require.Equal(t, []string{ours, theirs}, merge.ParentHashes)
+
+	writeFile(t, "extra.txt", "extra\n")
+	runCommand(t, "add", "extra.txt")
+	runCommand(t, "commit", "--amend", "--no-edit")
+
+	amended, err = repo.RetrieveCommit(headHash(t, repo))
+	require.NoError(t, err)
+	require.Equal(t, []string{ours, theirs}, amended.ParentHashes)
+	require.Equal(t, merge.Message, amended.Message)
+	require.Contains(t, treeEntries(t, repo, headHash(t, repo)), "extra.txt")
+}
+
+func TestCommitEditorAborts(t *testing.T) {
+	repo := newTestRepo(t)
+	first := commitFiles(t, repo, "first", map[string]string{"f.txt": "one\n"})
+	writeFile(t, "f.txt", "two\n")
+	runCommand(t, "add", "f.txt")
+
+	t.Setenv("EDITOR", "false")
+	_, err := execCommand(t, "commit")
+	require.ErrorContains(t, err, "aborting commit; supply the message with -m")
+	require.Equal(t, first, headHash(t, repo))
+
+	// An editor that leaves only the comments of the template
+	t.Setenv("EDITOR", "true")
+	_, err = execCommand(t, "commit")
+	require.ErrorContains(t, err, "aborting commit due to empty commit message")
+	require.Equal(t, first, headHash(t, repo))
+
+	_, err = execCommand(t, "commit", "-m", "  \n")
+	require.ErrorContains(t, err, "aborting commit due to empty commit message")
+	require.Equal(t, first, headHash(t, repo))
+
+	script := filepath.Join(t.TempDir(), "editor")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nprintf 'from the editor\\n' > \"$1\"\n"), 0o755))
+	t.Setenv("EDITOR", script)
+	runCommand(t, "commit")
+	c, err := repo.RetrieveCommit(headHash(t, repo))
+	require.NoError(t, err)
+	require.Equal(t, "from the editor", c.Message)
+	require.Equal(t, []string{first}, c.ParentHashes)
+}
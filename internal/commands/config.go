@@ -3,7 +3,6 @@ package commands
 import (
 	"fmt"
 	"os"
-	"os/exec"
 
 	"github.com/Gr1shma/notgit/internal/utils"
 	"github.com/spf13/cobra"
@@ -101,7 +100,7 @@ func setConfigCallback(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to set config key: %w", err)
 	}
 
-	if err := cfg.SaveTo(path); err != nil {
+	if err := utils.SaveConfig(cfg, path); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
 
@@ -130,7 +129,7 @@ func unsetConfigCallback(cmd *cobra.Command, args []string) error {
 	}
 
 	if anyUnset {
-		if err := cfg.SaveTo(path); err != nil {
+		if err := utils.SaveConfig(cfg, path); err != nil {
 			return fmt.Errorf("failed to save config: %w", err)
 		}
 	}
@@ -165,24 +164,18 @@ func editConfigCallback(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	tryEditor := func(ed string) error {
-		cmdExec := exec.Command(ed, configPath)
-		cmdExec.Stdin = os.Stdin
-		cmdExec.Stdout = os.Stdout
-		cmdExec.Stderr = os.Stderr
-		return cmdExec.Run()
-	}
+	return launchEditor(cmd, editor, configPath)
+}
 
-	if err := tryEditor(editor); err != nil {
-		fallbackEditor := os.Getenv("EDITOR")
-		if fallbackEditor != "" && fallbackEditor != editor {
-			fmt.Printf("Failed to open editor %q, falling back to $EDITOR=%q\n", editor, fallbackEditor)
-			if err := tryEditor(fallbackEditor); err != nil {
-				return fmt.Errorf("failed to open fallback editor: %w", err)
+// lookupConfig returns the value of key from the repository config, or from
+// the global config if the repository does not set it; "" if neither does.
+func lookupConfig(key string) string {
+	for _, global := range []bool{false, true} {
+		if cfg, _, err := utils.LoadConfig(global); err == nil {
+			if value, err := utils.GetConfigKeyValue(cfg, key); err == nil && value != "" {
+				return value
 			}
-		} else {
-			return fmt.Errorf("failed to open editor %q: %w", editor, err)
 		}
 	}
-	return nil
+	return ""
 }
@@ -0,0 +1,435 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/diff"
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var diffStagedBool bool
+var diffStatBool bool
+var diffNameOnlyBool bool
+var diffContextLines int
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [--staged] [<revision> [<revision>]]",
+	Short: "Show changes between the working tree, the index and commits",
+	Long: `Show changes as unified diffs.
+
+  notgit diff                    working tree compared to the index
+  notgit diff --staged [<rev>]   index compared to HEAD (or <rev>)
+  notgit diff <rev>              working tree compared to <rev>
+  notgit diff <rev> <rev>        the trees of two commits
+
+Only tracked files are compared against the working tree. Files containing
+NUL bytes are reported as binary instead of being diffed line by line.
+
+During a conflicted merge, each conflicted file is reported as
+"* Unmerged path <file>". Compared with the working tree, the file is then
+diffed against our side of the merge (HEAD's version); --staged only names it.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: diffCallback,
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffStagedBool, "staged", false, "Compare the index with HEAD or the given revision")
+	diffCmd.Flags().BoolVar(&diffStagedBool, "cached", false, "Synonym for --staged")
+	diffCmd.Flags().BoolVar(&diffStatBool, "stat", false, "Show a diffstat instead of the patch")
+	diffCmd.Flags().BoolVar(&diffNameOnlyBool, "name-only", false, "Show only the names of changed files")
+	diffCmd.Flags().IntVarP(&diffContextLines, "unified", "U", 3, "Number of context lines around each change")
+	rootCmd.AddCommand(diffCmd)
+}
+
+// diffSide is one side of a comparison: the blob hash and mode of every file
+// on that side and a way to read a file's content. For the index, unmerged
+// holds the conflicted paths, which are not in files.
+type diffSide struct {
+	files    map[string]string
+	types    map[string]tree.EntryType
+	read     func(path, hash string) ([]byte, error)
+	unmerged map[string]repository.UnmergedEntry
+}
+
+type fileChange struct {
+	path       string
+	oldHash    string
+	newHash    string
+	oldType    tree.EntryType
+	newType    tree.EntryType
+	oldContent []byte
+	newContent []byte
+	// unmerged marks a conflicted path; without hashes there is no diff
+	unmerged bool
+}
+
+func diffCallback(cmd *cobra.Command, args []string) error {
+	if diffStatBool && diffNameOnlyBool {
+		return fmt.Errorf("--stat and --name-only cannot be used together")
+	}
+	if diffStagedBool && len(args) > 1 {
+		return fmt.Errorf("--staged takes at most one revision")
+	}
+
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	var oldSide, newSide *diffSide
+	switch {
+	case len(args) == 2:
+		if oldSide, err = revisionDiffSide(repo, args[0]); err != nil {
+			return err
+		}
+		if newSide, err = revisionDiffSide(repo, args[1]); err != nil {
+			return err
+		}
+	case diffStagedBool:
+		rev := "HEAD"
+		if len(args) == 1 {
+			rev = args[0]
+		}
+		if oldSide, err = revisionDiffSide(repo, rev); err != nil {
+			// Before the first commit everything in the index is new
+			if len(args) == 1 {
+				return err
+			}
+			if head, headErr := repo.GetHEADCommitHash(); headErr != nil || head != "" {
+				return err
+			}
+			oldSide = &diffSide{files: make(map[string]string)}
+		}
+		if newSide, err = indexDiffSide(repo); err != nil {
+			return err
+		}
+	case len(args) == 1:
+		if oldSide, err = revisionDiffSide(repo, args[0]); err != nil {
+			return err
+		}
+		if newSide, err = workingDiffSide(repo, oldSide.files); err != nil {
+			return err
+		}
+	default:
+		if oldSide, err = indexDiffSide(repo); err != nil {
+			return err
+		}
+		// Conflicted files are compared with our side of the merge
+		tracked := maps.Clone(oldSide.files)
+		for path, entry := range oldSide.unmerged {
+			tracked[path] = ""
+			if entry.Ours != nil {
+				oldSide.files[path] = entry.Ours.Hash
+				oldSide.types[path] = entry.Ours.Type
+			}
+		}
+		if newSide, err = workingDiffSide(repo, tracked); err != nil {
+			return err
+		}
+	}
+
+	changes, err := collectChanges(oldSide, newSide)
+	if err != nil {
+		return err
+	}
+	if len(oldSide.unmerged) > 0 {
+		changes = markUnmerged(changes, oldSide.unmerged, true)
+	} else if len(newSide.unmerged) > 0 {
+		changes = markUnmerged(changes, newSide.unmerged, false)
+	}
+
+	out := cmd.OutOrStdout()
+	switch {
+	case diffNameOnlyBool:
+		for _, change := range changes {
+			fmt.Fprintln(out, change.path)
+		}
+	case diffStatBool:
+		writeDiffStat(out, changes)
+	default:
+		for _, change := range changes {
+			if change.unmerged {
+				fmt.Fprintf(out, "* Unmerged path %s\n", change.path)
+				if change.oldHash == "" && change.newHash == "" {
+					continue
+				}
+			}
+			if err := writeFileDiff(out, change, diffContextLines); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func revisionDiffSide(repo *repository.Repository, rev string) (*diffSide, error) {
+	hash, err := repo.ResolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	index, err := commitIndex(repo, hash)
+	if err != nil {
+		return nil, err
+	}
+	return indexEntriesDiffSide(repo, index), nil
+}
+
+func indexDiffSide(repo *repository.Repository) (*diffSide, error) {
+	index, err := repo.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	return indexEntriesDiffSide(repo, index), nil
+}
+
+func indexEntriesDiffSide(repo *repository.Repository, index *repository.Index) *diffSide {
+	side := &diffSide{
+		files: make(map[string]string, len(index.Entries)),
+		types: make(map[string]tree.EntryType, len(index.Entries)),
+		read:  blobReader(repo),
+	}
+	for path, entry := range index.Entries {
+		side.files[path] = entry.Hash
+		side.types[path] = entry.Type
+	}
+	if len(index.Unmerged) > 0 {
+		side.unmerged = index.Unmerged
+	}
+	return side
+}
+
+// workingDiffSide hashes the tracked files of the working tree. A file is
+// tracked if it is in the index or in extraPaths.
+func workingDiffSide(repo *repository.Repository, extraPaths map[string]string) (*diffSide, error) {
+	index, err := repo.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	workingFiles, err := getWorkingDirectoryFiles(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read working tree: %w", err)
+	}
+
+	files := make(map[string]string)
+	types := make(map[string]tree.EntryType)
+	for path, info := range workingFiles {
+		_, inIndex := index.Entries[path]
+		_, inExtra := extraPaths[path]
+		if inIndex || inExtra {
+			files[path] = info.Hash
+			types[path] = info.Type
+		}
+	}
+
+	read := func(path, _ string) ([]byte, error) {
+		fullPath := filepath.Join(repo.BaseDir, filepath.FromSlash(path))
+		info, err := os.Lstat(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		return readWorkingContent(fullPath, info)
+	}
+	return &diffSide{files: files, types: types, read: read}, nil
+}
+
+func blobReader(repo *repository.Repository) func(path, hash string) ([]byte, error) {
+	return func(path, hash string) ([]byte, error) {
+		b, err := repo.RetrieveBlob(hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		return b.Content, nil
+	}
+}
+
+func collectChanges(oldSide, newSide *diffSide) ([]fileChange, error) {
+	allPaths := make(map[string]bool)
+	for path := range oldSide.files {
+		allPaths[path] = true
+	}
+	for path := range newSide.files {
+		allPaths[path] = true
+	}
+
+	var changes []fileChange
+	for _, path := range sortedKeys(allPaths) {
+		oldHash, inOld := oldSide.files[path]
+		newHash, inNew := newSide.files[path]
+		oldType, newType := oldSide.types[path], newSide.types[path]
+		if inOld && inNew && oldHash == newHash && oldType == newType {
+			continue
+		}
+
+		change := fileChange{path: path, oldHash: oldHash, newHash: newHash, oldType: oldType, newType: newType}
+		var err error
+		if inOld {
+			if change.oldContent, err = oldSide.read(path, oldHash); err != nil {
+				return nil, err
+			}
+		}
+		if inNew {
+			if change.newContent, err = newSide.read(path, newHash); err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// markUnmerged flags the changes of conflicted paths and adds a change for
+// each one that has none. Unless keepDiff is set, only the path is kept.
+func markUnmerged(changes []fileChange, unmerged map[string]repository.UnmergedEntry, keepDiff bool) []fileChange {
+	marked := make([]fileChange, 0, len(changes)+len(unmerged))
+	seen := make(map[string]bool)
+	for _, change := range changes {
+		if _, ok := unmerged[change.path]; ok {
+			if !keepDiff {
+				change = fileChange{path: change.path}
+			}
+			change.unmerged = true
+			seen[change.path] = true
+		}
+		marked = append(marked, change)
+	}
+	for _, path := range sortedKeys(unmerged) {
+		if !seen[path] {
+			marked = append(marked, fileChange{path: path, unmerged: true})
+		}
+	}
+	slices.SortFunc(marked, func(a, b fileChange) int { return strings.Compare(a.path, b.path) })
+	return marked
+}
+
+func writeFileDiff(out io.Writer, change fileChange, context int) error {
+	fmt.Fprintf(out, "diff --git a/%s b/%s\n", change.path, change.path)
+
+	oldName, newName := "a/"+change.path, "b/"+change.path
+	oldMode, newMode := tree.ModeForType(change.oldType), tree.ModeForType(change.newType)
+	switch {
+	case change.oldHash == "":
+		fmt.Fprintf(out, "new file mode %s\n", newMode)
+		fmt.Fprintf(out, "index 0000000..%s\n", change.newHash[:7])
+		oldName = "/dev/null"
+	case change.newHash == "":
+		fmt.Fprintf(out, "deleted file mode %s\n", oldMode)
+		fmt.Fprintf(out, "index %s..0000000\n", change.oldHash[:7])
+		newName = "/dev/null"
+	case oldMode != newMode:
+		fmt.Fprintf(out, "old mode %s\nnew mode %s\n", oldMode, newMode)
+		if change.oldHash == change.newHash {
+			return nil
+		}
+		fmt.Fprintf(out, "index %s..%s\n", change.oldHash[:7], change.newHash[:7])
+	default:
+		fmt.Fprintf(out, "index %s..%s %s\n", change.oldHash[:7], change.newHash[:7], newMode)
+	}
+
+	if diff.IsBinary(change.oldContent) || diff.IsBinary(change.newContent) {
+		fmt.Fprintf(out, "Binary files %s and %s differ\n", oldName, newName)
+		return nil
+	}
+
+	oldLines, newLines := diff.SplitLines(change.oldContent), diff.SplitLines(change.newContent)
+	hunks := diff.Hunks(oldLines, newLines, diff.Lines(oldLines, newLines), context)
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", oldName, newName)
+	return diff.WriteHunks(out, hunks)
+}
+
+// maxStatBarWidth caps the +/- bar of --stat; larger changes are scaled down.
+const maxStatBarWidth = 50
+
+func writeDiffStat(out io.Writer, changes []fileChange) {
+	type statLine struct {
+		path       string
+		unmerged   bool
+		binary     bool
+		oldSize    int
+		newSize    int
+		insertions int
+		deletions  int
+	}
+
+	var lines []statLine
+	nameWidth, maxChanges := 0, 0
+	totalInsertions, totalDeletions := 0, 0
+	for _, change := range changes {
+		line := statLine{path: change.path}
+		if change.unmerged && change.oldHash == "" && change.newHash == "" {
+			line.unmerged = true
+		} else if diff.IsBinary(change.oldContent) || diff.IsBinary(change.newContent) {
+			line.binary = true
+			line.oldSize, line.newSize = len(change.oldContent), len(change.newContent)
+		} else {
+			oldLines, newLines := diff.SplitLines(change.oldContent), diff.SplitLines(change.newContent)
+			line.insertions, line.deletions = diff.CountChanges(diff.Lines(oldLines, newLines))
+			totalInsertions += line.insertions
+			totalDeletions += line.deletions
+			maxChanges = max(maxChanges, line.insertions+line.deletions)
+		}
+		nameWidth = max(nameWidth, len(line.path))
+		lines = append(lines, line)
+	}
+
+	countWidth := len(fmt.Sprint(maxChanges))
+	changed := 0
+	for _, line := range lines {
+		if line.unmerged {
+			fmt.Fprintf(out, " %-*s | Unmerged\n", nameWidth, line.path)
+			continue
+		}
+		changed++
+		if line.binary {
+			fmt.Fprintf(out, " %-*s | Bin %d -> %d bytes\n", nameWidth, line.path, line.oldSize, line.newSize)
+			continue
+		}
+		plus, minus := line.insertions, line.deletions
+		if maxChanges > maxStatBarWidth {
+			plus = scaleStat(plus, maxChanges)
+			minus = scaleStat(minus, maxChanges)
+		}
+		fmt.Fprintf(out, " %-*s | %*d %s%s\n", nameWidth, line.path, countWidth,
+			line.insertions+line.deletions, strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+
+	summary := fmt.Sprintf(" %d file%s changed", changed, plural(changed))
+	noLineChanges := totalInsertions == 0 && totalDeletions == 0
+	if totalInsertions > 0 || noLineChanges {
+		summary += fmt.Sprintf(", %d insertion%s(+)", totalInsertions, plural(totalInsertions))
+	}
+	if totalDeletions > 0 || noLineChanges {
+		summary += fmt.Sprintf(", %d deletion%s(-)", totalDeletions, plural(totalDeletions))
+	}
+	if changed > 0 {
+		fmt.Fprintln(out, summary)
+	}
+}
+
+// scaleStat shrinks n proportionally to fit the bar width, keeping at least
+// one character for any non-zero count.
+func scaleStat(n, maxChanges int) int {
+	if n == 0 {
+		return 0
+	}
+	return max(n*maxStatBarWidth/maxChanges, 1)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffUnmergedPath(t *testing.T) {
+	repo := newTestRepo(t)
+	commitFiles(t, repo, "base", map[string]string{"f.txt": "base\n", "g.txt": "g\n"})
+	runCommand(t, "branch", "topic")
+	commitFiles(t, repo, "ours", map[string]string{"f.txt": "ours\n"})
+	runCommand(t, "switch", "topic")
+	commitFiles(t, repo, "theirs", map[string]string{"f.txt": "theirs\n"})
+	runCommand(t, "switch", "master")
+	_, err := execCommand(t, "merge", "topic")
+	require.Error(t, err)
+	writeFile(t, "g.txt", "g changed\n")
+
+	out := runCommand(t, "diff")
+	require.Contains(t, out, "* Unmerged path f.txt\ndiff --git a/f.txt b/f.txt\n")
+	require.Contains(t, out, "--- a/f.txt\n+++ b/f.txt\n@@ -1 +1,5 @@\n+<<<<<<< HEAD\n ours\n+=======\n+theirs\n+>>>>>>> topic\n")
+	require.Contains(t, out, "diff --git a/g.txt b/g.txt\n")
+
+	require.Equal(t, "f.txt\ng.txt\n", runCommand(t, "diff", "--name-only"))
+	require.Equal(t, "* Unmerged path f.txt\n", runCommand(t, "diff", "--staged"))
+	require.Contains(t, runCommand(t, "diff", "--stat"), " f.txt | 4 ++++\n")
+
+	// Resolved to our version, only the path is reported
+	writeFile(t, "f.txt", "ours\n")
+	out = runCommand(t, "diff")
+	require.Contains(t, out, "* Unmerged path f.txt\ndiff --git a/g.txt b/g.txt\n")
+	require.NotContains(t, out, "diff --git a/f.txt")
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// configuredEditor returns the editor set as core.editor in the repository
+// or global config, or $EDITOR; "" if there is none.
+func configuredEditor() string {
+	if editor := strings.TrimSpace(lookupConfig("core.editor")); editor != "" {
+		return editor
+	}
+	return strings.TrimSpace(os.Getenv("EDITOR"))
+}
+
+// launchEditor opens path in editor and waits for it to exit. The editor may
+// include arguments, like "code --wait". If it cannot be run, $EDITOR is
+// tried instead. An editor that runs but exits with an error, as vim does
+// after :cq, is not retried; the error then wraps an *exec.ExitError.
+func launchEditor(cmd *cobra.Command, editor, path string) error {
+	tryEditor := func(ed string) error {
+		fields := strings.Fields(ed)
+		if len(fields) == 0 {
+			return fmt.Errorf("the editor command is empty")
+		}
+		cmdExec := exec.Command(fields[0], append(fields[1:], path)...)
+		cmdExec.Stdin = os.Stdin
+		cmdExec.Stdout = os.Stdout
+		cmdExec.Stderr = os.Stderr
+		return cmdExec.Run()
+	}
+
+	err := tryEditor(editor)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("there was a problem with the editor %q: %w", editor, err)
+	}
+	if err != nil {
+		fallbackEditor := os.Getenv("EDITOR")
+		if strings.TrimSpace(fallbackEditor) != "" && fallbackEditor != editor {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Failed to open editor %q, falling back to $EDITOR=%q\n", editor, fallbackEditor)
+			if err := tryEditor(fallbackEditor); err != nil {
+				return fmt.Errorf("failed to open fallback editor: %w", err)
+			}
+		} else {
+			return fmt.Errorf("failed to open editor %q: %w", editor, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package commands
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/objects/blob"
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/objects/tag"
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var fsckNoDanglingBool bool
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Verify the connectivity and validity of objects in the repository",
+	Long: `Check every loose and packed object in the repository.
+
+Each object is re-hashed to make sure its content matches its name and parsed
+according to its type. Every tree and parent referenced by a commit and every
+entry referenced by a tree must exist, and every ref must point to a commit.
+Objects that nothing points to are reported as dangling.
+
+Exits with a non-zero status if any corrupt or missing objects are found.`,
+	Args: cobra.NoArgs,
+	RunE: fsckCallback,
+}
+
+func init() {
+	fsckCmd.Flags().BoolVar(&fsckNoDanglingBool, "no-dangling", false, "Do not report dangling objects")
+	rootCmd.AddCommand(fsckCmd)
+}
+
+type fsckLink struct {
+	hash       string
+	objectType string
+}
+
+type fsckResult struct {
+	types    map[string]string
+	links    map[string][]fsckLink
+	problems int
+}
+
+func fsckCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	// From here on problems are reported on stderr; usage text is just noise
+	cmd.SilenceUsage = true
+
+	result := &fsckResult{
+		types: make(map[string]string),
+		links: make(map[string][]fsckLink),
+	}
+	errOut := cmd.ErrOrStderr()
+
+	loose, err := repo.LooseObjects()
+	if err != nil {
+		return err
+	}
+	for _, hash := range loose {
+		data, err := repo.ReadLooseObject(hash)
+		checkFsckObject(cmd, result, hash, data, err)
+	}
+
+	packs, err := repo.PackNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range packs {
+		if err := repo.VerifyPack(name); err != nil {
+			fmt.Fprintf(errOut, "error: %v\n", err)
+			result.problems++
+		}
+	}
+
+	packed, err := repo.PackedObjects()
+	if err != nil {
+		return err
+	}
+	for _, hash := range packed {
+		if _, checked := result.types[hash]; checked {
+			continue
+		}
+		data, err := repo.ReadObject(hash)
+		checkFsckObject(cmd, result, hash, data, err)
+	}
+
+	referenced := make(map[string]bool)
+	for _, hash := range sortedKeys(result.links) {
+		for _, link := range result.links[hash] {
+			referenced[link.hash] = true
+
+			actualType, exists := result.types[link.hash]
+			if !exists {
+				fmt.Fprintf(errOut, "missing %s %s (referenced by %s %s)\n", link.objectType, link.hash, result.types[hash], hash)
+				result.problems++
+			} else if actualType != "" && actualType != link.objectType {
+				fmt.Fprintf(errOut, "error: %s %s references %s as a %s, but it is a %s\n", result.types[hash], hash, link.hash, link.objectType, actualType)
+				result.problems++
+			}
+		}
+	}
+
+	roots, err := collectFsckRoots(cmd, repo, result)
+	if err != nil {
+		return err
+	}
+
+	reachable := make(map[string]bool)
+	pending := roots
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if reachable[hash] {
+			continue
+		}
+		reachable[hash] = true
+		for _, link := range result.links[hash] {
+			pending = append(pending, link.hash)
+		}
+	}
+
+	if !fsckNoDanglingBool {
+		for _, hash := range sortedKeys(result.types) {
+			if reachable[hash] || referenced[hash] || result.types[hash] == "" {
+				continue
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "dangling %s %s\n", result.types[hash], hash)
+		}
+	}
+
+	if result.problems > 0 {
+		return fmt.Errorf("fsck found %d problem(s)", result.problems)
+	}
+	return nil
+}
+
+// checkFsckObject records the object's type and outgoing links. Objects that
+// cannot be read or parsed are recorded with an empty type so they are not
+// also reported as missing.
+func checkFsckObject(cmd *cobra.Command, result *fsckResult, hash string, data []byte, readErr error) {
+	errOut := cmd.ErrOrStderr()
+	result.types[hash] = ""
+
+	if readErr != nil {
+		fmt.Fprintf(errOut, "error: corrupt object %s: %v\n", hash, readErr)
+		result.problems++
+		return
+	}
+
+	sum := sha1.Sum(data)
+	if computed := hex.EncodeToString(sum[:]); computed != hash {
+		fmt.Fprintf(errOut, "error: hash mismatch for %s (content hashes to %s)\n", hash, computed)
+		result.problems++
+		return
+	}
+
+	objectType, content, err := parseObjectHeader(data)
+	if err != nil {
+		fmt.Fprintf(errOut, "error: corrupt object %s: %v\n", hash, err)
+		result.problems++
+		return
+	}
+
+	header := string(data[:len(data)-len(content)-1])
+	if size, err := strconv.Atoi(strings.TrimPrefix(header, objectType+" ")); err != nil || size != len(content) {
+		fmt.Fprintf(errOut, "error: corrupt object %s: header size does not match content\n", hash)
+		result.problems++
+		return
+	}
+
+	var links []fsckLink
+	switch objectType {
+	case "blob":
+		_, err = blob.DeserializeBlob(data)
+	case "tree":
+		var treeObj *tree.Tree
+		treeObj, err = tree.DeserializeTree(data)
+		if err == nil {
+			for _, entry := range treeObj.Entries {
+				linkType := "blob"
+				if entry.Type == tree.EntryTypeTree {
+					linkType = "tree"
+				}
+				links = append(links, fsckLink{hash: entry.Hash, objectType: linkType})
+			}
+		}
+	case "commit":
+		var commitObj *commit.Commit
+		commitObj, err = commit.DeserializeCommit(data)
+		if err == nil {
+			links = append(links, fsckLink{hash: commitObj.TreeHash, objectType: "tree"})
+			for _, parent := range commitObj.ParentHashes {
+				links = append(links, fsckLink{hash: parent, objectType: "commit"})
+			}
+		}
+	case "tag":
+		var tagObj *tag.Tag
+		tagObj, err = tag.DeserializeTag(data)
+		if err == nil {
+			links = append(links, fsckLink{hash: tagObj.Object, objectType: tagObj.ObjectType})
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "error: corrupt %s %s: %v\n", objectType, hash, err)
+		result.problems++
+		return
+	}
+
+	result.types[hash] = objectType
+	result.links[hash] = links
+}
+
+func collectFsckRoots(cmd *cobra.Command, repo *repository.Repository, result *fsckResult) ([]string, error) {
+	errOut := cmd.ErrOrStderr()
+
+	refs, err := repo.ListRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	headHash, err := repo.GetHEADCommitHash()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	if headHash != "" {
+		refs["HEAD"] = headHash
+	}
+
+	var roots []string
+	for _, name := range sortedKeys(refs) {
+		hash := refs[name]
+		actualType, exists := result.types[hash]
+		switch {
+		case !exists:
+			fmt.Fprintf(errOut, "error: %s: invalid pointer %s\n", name, hash)
+			result.problems++
+		case actualType != "" && actualType != "commit" && !strings.HasPrefix(name, "refs/tags/"):
+			fmt.Fprintf(errOut, "error: %s: points to a %s, not a commit\n", name, actualType)
+			result.problems++
+		default:
+			roots = append(roots, hash)
+		}
+	}
+
+	// Commits only reachable through a reflog are not dangling
+	reflogHashes, err := repo.ReflogHashes()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range reflogHashes {
+		if _, exists := result.types[hash]; exists {
+			roots = append(roots, hash)
+		}
+	}
+
+	index, err := repo.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	for _, path := range sortedKeys(index.Entries) {
+		hash := index.Entries[path].Hash
+		if _, exists := result.types[hash]; !exists {
+			fmt.Fprintf(errOut, "error: index entry %s: missing blob %s\n", path, hash)
+			result.problems++
+			continue
+		}
+		roots = append(roots, hash)
+	}
+
+	return roots, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Pack reachable objects and remove their loose copies",
+	Long: `Collect every object reachable from refs, HEAD, the reflogs and the
+index, write them into a single delta-compressed packfile under
+.notgit/objects/pack, and delete the loose copies of the packed objects.
+
+Objects from existing packs are carried over into the new pack, which then
+replaces them. Unreachable loose objects are left in place. Only one gc can
+run in a repository at a time.`,
+	Args: cobra.NoArgs,
+	RunE: gcCallback,
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+}
+
+func gcCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	lock, err := repo.LockGC()
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	defer lock.Rollback()
+
+	refs, err := repo.ListRefs()
+	if err != nil {
+		return err
+	}
+
+	roots := make([]string, 0, len(refs)+1)
+	for _, hash := range refs {
+		roots = append(roots, hash)
+	}
+
+	headHash, err := repo.GetHEADCommitHash()
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	roots = append(roots, headHash)
+
+	reflogHashes, err := repo.ReflogHashes()
+	if err != nil {
+		return err
+	}
+	roots = append(roots, reflogHashes...)
+
+	reachable, err := repo.ReachableObjects(roots)
+	if err != nil {
+		return fmt.Errorf("failed to walk history: %w", err)
+	}
+
+	index, err := repo.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+	for path, entry := range index.Entries {
+		if _, seen := reachable[entry.Hash]; !seen {
+			reachable[entry.Hash] = path
+		}
+	}
+
+	packed, err := repo.PackedObjects()
+	if err != nil {
+		return err
+	}
+	for _, hash := range packed {
+		if _, seen := reachable[hash]; !seen {
+			reachable[hash] = ""
+		}
+	}
+
+	if len(reachable) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "Nothing to pack")
+		return nil
+	}
+
+	oldPacks, err := repo.PackNames()
+	if err != nil {
+		return err
+	}
+
+	entries := make([]repository.PackEntry, 0, len(reachable))
+	for hash, path := range reachable {
+		entries = append(entries, repository.PackEntry{Hash: hash, Path: path})
+	}
+
+	stats, err := repo.WritePack(entries)
+	if err != nil {
+		return fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	for _, name := range oldPacks {
+		if name == stats.Name {
+			continue
+		}
+		if err := repo.RemovePack(name); err != nil {
+			return err
+		}
+	}
+
+	loose, err := repo.LooseObjects()
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, hash := range loose {
+		if _, ok := reachable[hash]; !ok {
+			continue
+		}
+		if err := repo.RemoveLooseObject(hash); err != nil {
+			return err
+		}
+		removed++
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Packed %d objects (%d deltas) into %s\n", stats.Objects, stats.Deltas, stats.Name)
+	fmt.Fprintf(cmd.OutOrStdout(), "Removed %d loose objects\n", removed)
+	return nil
+}
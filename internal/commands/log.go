@@ -15,10 +15,10 @@ type LogArgs struct {
 var logArgs = &LogArgs{}
 
 var logCmd = &cobra.Command{
-	Use:   "log",
+	Use:   "log [revision]",
 	Short: "Show commit logs",
-	Long:  `Display the commit history starting from the current HEAD reference. (Only for particular branch for now)`,
-	Args:  cobra.NoArgs,
+	Long:  `Display the commit history starting from the given revision, or from HEAD if none is given. (Only follows first parents for now)`,
+	Args:  cobra.MaximumNArgs(1),
 	RunE:  logCallback,
 }
 
@@ -33,9 +33,17 @@ func logCallback(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("error opening repository: %w", err)
 	}
 
-	currentRef, err := repo.GetHEADCommitHash()
-	if err != nil {
-		return fmt.Errorf("error getting HEAD commit: %w", err)
+	var currentRef string
+	if len(args) == 1 {
+		currentRef, err = repo.ResolveCommit(args[0])
+		if err != nil {
+			return err
+		}
+	} else {
+		currentRef, err = repo.GetHEADCommitHash()
+		if err != nil {
+			return fmt.Errorf("error getting HEAD commit: %w", err)
+		}
 	}
 
 	if currentRef == "" {
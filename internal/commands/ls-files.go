@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var lsFilesStageBool bool
+var lsFilesUnmergedBool bool
+
+var lsFilesCmd = &cobra.Command{
+	Use:   "ls-files [--stage] [--unmerged]",
+	Short: "Show the files in the index",
+	Long: `List the paths in the index, sorted.
+
+With --stage, print "<mode> <object> <stage>\t<path>" for every entry.
+Paths left conflicted by a merge have up to three entries: stage 1 for the
+common ancestor, 2 for ours and 3 for theirs. --unmerged shows only those.`,
+	Args: cobra.NoArgs,
+	RunE: lsFilesCallback,
+}
+
+func init() {
+	lsFilesCmd.Flags().BoolVarP(&lsFilesStageBool, "stage", "s", false, "Show mode, object name and stage of each entry")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesUnmergedBool, "unmerged", "u", false, "Show only unmerged entries (implies --stage)")
+	rootCmd.AddCommand(lsFilesCmd)
+}
+
+func lsFilesCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	index, err := repo.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+
+	paths := make(map[string]bool)
+	if !lsFilesUnmergedBool {
+		for path := range index.Entries {
+			paths[path] = true
+		}
+	}
+	for path := range index.Unmerged {
+		paths[path] = true
+	}
+
+	out := cmd.OutOrStdout()
+	for _, path := range sortedKeys(paths) {
+		if !lsFilesStageBool && !lsFilesUnmergedBool {
+			fmt.Fprintln(out, path)
+			continue
+		}
+
+		if entry, ok := index.Entries[path]; ok {
+			fmt.Fprintf(out, "%s %s 0\t%s\n", tree.ModeForType(entry.Type), entry.Hash, path)
+			continue
+		}
+		for i, entry := range index.Unmerged[path].Stages() {
+			if entry != nil {
+				fmt.Fprintf(out, "%s %s %d\t%s\n", tree.ModeForType(entry.Type), entry.Hash, i+1, path)
+			}
+		}
+	}
+	return nil
+}
@@ -2,29 +2,48 @@ package commands
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/Gr1shma/notgit/internal/diff"
+	"github.com/Gr1shma/notgit/internal/objects/blob"
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/objects/tree"
 	"github.com/Gr1shma/notgit/internal/repository"
 	"github.com/spf13/cobra"
 )
 
 var mergeCmd = &cobra.Command{
-	Use:   "merge <branch-name>",
+	Use:   "merge <revision>",
 	Short: "Merge branches",
-	Long: `Merge the specified branch into the current branch.
+	Long: `Merge the specified branch or commit into the current branch.
 
-Currently only supports fast-forward merges.
-A fast-forward merge occurs when the current branch is an ancestor of the target branch.
+If the current branch is an ancestor of the target, the branch is simply
+fast-forwarded. Otherwise the two histories are combined with a three-way
+merge against their merge base and a merge commit with both parents is
+created.
 
-WARNING: Uncommitted changes may be lost during merge.
-Make sure to commit your changes before merging.`,
+When both sides changed the same lines, the conflicting regions are written
+to the file between <<<<<<< / ======= / >>>>>>> markers and the merge stops.
+Resolve the conflicts, mark them resolved with "notgit add", then run
+"notgit commit" to create the merge commit.
+
+The merge is refused if it would overwrite uncommitted changes or untracked
+files, or if the index has staged changes; the affected files are listed.
+Use --force to let the merge overwrite them.`,
 	Args: cobra.ExactArgs(1),
 	RunE: mergeCallback,
 }
 
+var mergeForceBool bool
+
 func init() {
+	mergeCmd.Flags().BoolVar(&mergeForceBool, "force", false, "Overwrite local changes to files touched by the merge")
 	rootCmd.AddCommand(mergeCmd)
 }
 
@@ -34,10 +53,15 @@ func mergeCallback(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to open repository: %w", err)
 	}
 
-	targetBranch := args[0]
+	if mergeHead, err := repo.ReadMergeHead(); err != nil {
+		return err
+	} else if mergeHead != "" {
+		return fmt.Errorf("you have not concluded your merge (MERGE_HEAD exists); resolve the conflicts and commit first")
+	}
 
-	if strings.Contains(targetBranch, "/") {
-		return fmt.Errorf("nested branch names are not supported")
+	targetBranch, err := repo.ResolveBranchShorthand(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve '%s': %w", args[0], err)
 	}
 
 	currentBranch, err := repo.GetCurrentBranch()
@@ -49,27 +73,14 @@ func mergeCallback(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("cannot merge branch '%s' into itself", targetBranch)
 	}
 
-	targetBranchPath := filepath.Join(repo.NotgitDir, "refs", "heads", targetBranch)
-	if _, err := os.Stat(targetBranchPath); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("branch '%s' does not exist", targetBranch)
-		}
-		return fmt.Errorf("failed to check branch existence: %w", err)
-	}
-
 	currentCommitHash, err := repo.GetHEADCommitHash()
 	if err != nil {
 		return fmt.Errorf("failed to get current commit: %w", err)
 	}
 
-	targetCommitHashBytes, err := os.ReadFile(targetBranchPath)
+	targetCommitHash, err := repo.ResolveCommit(targetBranch)
 	if err != nil {
-		return fmt.Errorf("failed to read target branch: %w", err)
-	}
-	targetCommitHash := strings.TrimSpace(string(targetCommitHashBytes))
-
-	if targetCommitHash == "" {
-		return fmt.Errorf("branch '%s' has no commits", targetBranch)
+		return err
 	}
 
 	if currentCommitHash == targetCommitHash {
@@ -77,77 +88,458 @@ func mergeCallback(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	canFastForward, err := isAncestor(repo, currentCommitHash, targetCommitHash)
+	if currentCommitHash == "" {
+		if err := performFastForwardMerge(cmd, repo, targetBranch, currentCommitHash, targetCommitHash); err != nil {
+			return fmt.Errorf("failed to perform merge: %w", err)
+		}
+		fmt.Printf("Fast-forward merge from '%s' to '%s'\n", currentBranch, targetBranch)
+		return nil
+	}
+
+	mergeBase, err := repo.MergeBase(currentCommitHash, targetCommitHash)
 	if err != nil {
-		return fmt.Errorf("failed to check ancestry: %w", err)
+		return fmt.Errorf("failed to find merge base: %w", err)
+	}
+	if mergeBase == "" {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("refusing to merge unrelated histories")
 	}
 
-	if !canFastForward {
-		return fmt.Errorf("cannot fast-forward merge: branches have diverged. Non-fast-forward merges are not yet supported")
+	if mergeBase == targetCommitHash {
+		fmt.Printf("Already up to date.\n")
+		return nil
+	}
+
+	if mergeBase == currentCommitHash {
+		if err := performFastForwardMerge(cmd, repo, targetBranch, currentCommitHash, targetCommitHash); err != nil {
+			return fmt.Errorf("failed to perform merge: %w", err)
+		}
+		fmt.Printf("Fast-forward merge from '%s' to '%s'\n", currentBranch, targetBranch)
+		return nil
+	}
+
+	return performThreeWayMerge(cmd, repo, targetBranch, currentCommitHash, targetCommitHash, mergeBase)
+}
+
+func performFastForwardMerge(cmd *cobra.Command, repo *repository.Repository, targetName, currentCommitHash, targetCommitHash string) error {
+	if err := checkoutCommit(repo, currentCommitHash, targetCommitHash, "merge", mergeForceBool); err != nil {
+		cmd.SilenceUsage = true
+		return err
 	}
 
-	if err := performFastForwardMerge(repo, currentBranch, targetBranch, targetCommitHash); err != nil {
-		return fmt.Errorf("failed to perform merge: %w", err)
+	reason := fmt.Sprintf("merge %s: Fast-forward", targetName)
+	if err := repo.UpdateHEADFrom(targetCommitHash, currentCommitHash, reflogSignature(), reason); err != nil {
+		return fmt.Errorf("failed to update branch ref: %w", err)
 	}
 
-	fmt.Printf("Fast-forward merge from '%s' to '%s'\n", currentBranch, targetBranch)
 	return nil
 }
 
-func isAncestor(repo *repository.Repository, ancestorHash, descendantHash string) (bool, error) {
-	currentHash := descendantHash
+func performThreeWayMerge(cmd *cobra.Command, repo *repository.Repository, targetName, oursHash, theirsHash, baseHash string) error {
+	out := cmd.OutOrStdout()
+
+	// The identity is needed for the merge commit; check it before the
+	// working tree is touched so a failure leaves nothing half-merged
+	authorName, authorEmail, err := getUserIdentity()
+	if err != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("cannot create merge commit: %w", err)
+	}
+
+	baseIndex, err := commitIndex(repo, baseHash)
+	if err != nil {
+		return err
+	}
+	ourIndex, err := commitIndex(repo, oursHash)
+	if err != nil {
+		return err
+	}
+	theirIndex, err := commitIndex(repo, theirsHash)
+	if err != nil {
+		return err
+	}
+	baseFiles, ourFiles, theirFiles := baseIndex.Entries, ourIndex.Entries, theirIndex.Entries
 
-	for currentHash != "" {
-		if currentHash == ancestorHash {
-			return true, nil
+	index, err := repo.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Rollback()
+
+	allPaths := make(map[string]bool)
+	for _, files := range []map[string]repository.IndexEntry{baseFiles, ourFiles, theirFiles} {
+		for path := range files {
+			allPaths[path] = true
 		}
+	}
 
-		commit, err := repo.RetrieveCommit(currentHash)
-		if err != nil {
-			return false, fmt.Errorf("failed to load commit %s: %w", currentHash, err)
+	if !mergeForceBool {
+		if err := checkMergeLocalChanges(repo, index.Index, baseFiles, ourFiles, theirFiles, allPaths); err != nil {
+			cmd.SilenceUsage = true
+			return err
 		}
+	}
 
-		currentHash = commit.ParentHashes[0]
+	mergedFiles := make(map[string]repository.IndexEntry, len(ourFiles))
+	for path, entry := range ourFiles {
+		mergedFiles[path] = entry
+	}
+
+	// Work out the whole result first; the working tree is only touched
+	// once it is known that every update can be applied
+	var conflicts []string
+	var updates []workingUpdate
+	var report strings.Builder
+	for _, path := range sortedKeys(allPaths) {
+		baseEntry, inBase := baseFiles[path]
+		ourEntry, inOurs := ourFiles[path]
+		theirEntry, inTheirs := theirFiles[path]
+
+		switch {
+		case sameEntry(ourEntry, inOurs, theirEntry, inTheirs):
+			// Both sides agree, nothing to do
+		case sameEntry(baseEntry, inBase, theirEntry, inTheirs):
+			// Only our side changed, keep it
+		case sameEntry(baseEntry, inBase, ourEntry, inOurs):
+			// Only their side changed, take it
+			if !inTheirs {
+				delete(mergedFiles, path)
+				index.RemoveEntry(path)
+				updates = append(updates, workingUpdate{path: path, remove: true})
+				continue
+			}
+			theirBlob, err := repo.RetrieveBlob(theirEntry.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to load blob %s: %w", theirEntry.Hash, err)
+			}
+			updates = append(updates, workingUpdate{path: path, content: theirBlob.Content, entryType: theirEntry.Type})
+			mergedFiles[path] = theirEntry
+			index.AddEntryWithType(path, theirEntry.Hash, theirEntry.Type)
+		case inOurs && inTheirs:
+			mergedType, modeConflict := mergeEntryTypes(baseEntry, inBase, ourEntry, theirEntry)
+			mergedHash, conflicted := ourEntry.Hash, false
+			if ourEntry.Hash != theirEntry.Hash {
+				var content []byte
+				mergedHash, content, conflicted, err = mergeFileContents(repo, path, baseEntry.Hash, ourEntry, theirEntry, targetName)
+				if err != nil {
+					return err
+				}
+				if content != nil {
+					updates = append(updates, workingUpdate{path: path, content: content, entryType: mergedType})
+				}
+			} else if mergedType != ourEntry.Type {
+				// Only the mode changed on their side
+				updates = append(updates, workingUpdate{path: path, entryType: mergedType, modeOnly: true})
+			}
+			if modeConflict {
+				fmt.Fprintf(&report, "CONFLICT (mode): %s has different modes in HEAD and %s\n", path, targetName)
+			}
+			if conflicted {
+				fmt.Fprintf(&report, "CONFLICT (content): Merge conflict in %s\n", path)
+			}
+			if conflicted || modeConflict {
+				conflicts = append(conflicts, path)
+				index.AddUnmerged(path, optionalEntry(baseEntry, inBase), &ourEntry, &theirEntry)
+				continue
+			}
+			if ourEntry.Hash != theirEntry.Hash {
+				fmt.Fprintf(&report, "Auto-merging %s\n", path)
+			}
+			mergedFiles[path] = repository.IndexEntry{Path: path, Hash: mergedHash, Type: mergedType}
+			index.AddEntryWithType(path, mergedHash, mergedType)
+		case inOurs:
+			fmt.Fprintf(&report, "CONFLICT (modify/delete): %s deleted in %s and modified in HEAD\n", path, targetName)
+			conflicts = append(conflicts, path)
+			index.AddUnmerged(path, optionalEntry(baseEntry, inBase), &ourEntry, nil)
+		default:
+			fmt.Fprintf(&report, "CONFLICT (modify/delete): %s deleted in HEAD and modified in %s\n", path, targetName)
+			theirBlob, err := repo.RetrieveBlob(theirEntry.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to load blob %s: %w", theirEntry.Hash, err)
+			}
+			updates = append(updates, workingUpdate{path: path, content: theirBlob.Content, entryType: theirEntry.Type})
+			conflicts = append(conflicts, path)
+			index.AddUnmerged(path, optionalEntry(baseEntry, inBase), nil, &theirEntry)
+		}
 	}
 
-	return false, nil
+	resultPaths := make(map[string]bool, len(mergedFiles)+len(conflicts))
+	for path := range mergedFiles {
+		resultPaths[path] = true
+	}
+	for _, path := range conflicts {
+		resultPaths[path] = true
+	}
+	if err := checkFileDirectoryClashes(repo, resultPaths, updates); err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	if err := applyWorkingUpdates(repo, updates); err != nil {
+		return err
+	}
+	fmt.Fprint(out, report.String())
+
+	message := fmt.Sprintf("Merge commit '%s'", targetName)
+	if branchExists(repo, targetName) {
+		message = fmt.Sprintf("Merge branch '%s'", targetName)
+	}
+
+	if len(conflicts) > 0 {
+		var sb strings.Builder
+		sb.WriteString(message + "\n\n# Conflicts:\n")
+		for _, path := range conflicts {
+			sb.WriteString("#\t" + path + "\n")
+		}
+		if err := index.Commit(); err != nil {
+			return fmt.Errorf("failed to save index: %w", err)
+		}
+		if err := repo.WriteMergeState(theirsHash, sb.String()); err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+		return fmt.Errorf("automatic merge failed; fix conflicts and then commit the result")
+	}
+
+	mergedIndex := repository.NewIndex()
+	for path, entry := range mergedFiles {
+		mergedIndex.AddEntryWithType(path, entry.Hash, entry.Type)
+	}
+	treeHash, err := repo.WriteTree(mergedIndex)
+	if err != nil {
+		return fmt.Errorf("failed to write merged tree: %w", err)
+	}
+	index.Index = mergedIndex
+	if err := index.Commit(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	sig := commit.Signature{Name: authorName, Email: authorEmail, Time: time.Now()}
+	mergeCommit := commit.NewCommit(treeHash, message, []string{oursHash, theirsHash}, sig, sig)
+	commitHash, err := repo.StoreObject(mergeCommit)
+	if err != nil {
+		return fmt.Errorf("failed to write merge commit: %w", err)
+	}
+
+	reason := fmt.Sprintf("merge %s: Merge made by the 'three-way' strategy.", targetName)
+	if err := repo.UpdateHEADFrom(commitHash, oursHash, sig, reason); err != nil {
+		return fmt.Errorf("failed to update HEAD: %w", err)
+	}
+
+	fmt.Fprintf(out, "Merge made by the 'three-way' strategy.\n")
+	fmt.Fprintf(out, "[%s] %s\n", commitHash[:7], message)
+	return nil
 }
 
-func performFastForwardMerge(repo *repository.Repository, currentBranch, targetBranch, targetCommitHash string) error {
-	targetCommit, err := repo.RetrieveCommit(targetCommitHash)
+// checkMergeLocalChanges refuses a three-way merge when the index has staged
+// changes, or when a file the merge will rewrite has unstaged changes or is an
+// untracked file in the way.
+func checkMergeLocalChanges(repo *repository.Repository, index *repository.Index, baseFiles, ourFiles, theirFiles map[string]repository.IndexEntry, allPaths map[string]bool) error {
+	workingFiles, err := getWorkingDirectoryFiles(repo)
 	if err != nil {
-		return fmt.Errorf("failed to load target commit: %w", err)
+		return fmt.Errorf("failed to read working tree: %w", err)
+	}
+
+	var modified, untracked []string
+	for _, path := range sortedKeys(allPaths) {
+		baseEntry, inBase := baseFiles[path]
+		ourEntry, inOurs := ourFiles[path]
+		theirEntry, inTheirs := theirFiles[path]
+		indexEntry, inIndex := index.Entries[path]
+		working, inWorking := workingFiles[path]
+		workingEntry := repository.IndexEntry{Hash: working.Hash, Type: working.Type}
+
+		if !sameEntry(indexEntry, inIndex, ourEntry, inOurs) {
+			modified = append(modified, path)
+			continue
+		}
+
+		touched := !sameEntry(baseEntry, inBase, theirEntry, inTheirs) && !sameEntry(ourEntry, inOurs, theirEntry, inTheirs)
+		if !touched {
+			continue
+		}
+		switch {
+		case inIndex && !sameEntry(workingEntry, inWorking, indexEntry, inIndex):
+			modified = append(modified, path)
+		case !inIndex && inWorking && inTheirs && !sameEntry(workingEntry, inWorking, theirEntry, inTheirs):
+			untracked = append(untracked, path)
+		}
 	}
 
-	targetTree, err := repo.RetrieveTree(targetCommit.TreeHash)
+	// Staged files that are new to both sides are not in allPaths
+	for _, path := range sortedKeys(index.Entries) {
+		if !allPaths[path] {
+			modified = append(modified, path)
+		}
+	}
+
+	if len(modified) > 0 || len(untracked) > 0 {
+		sort.Strings(modified)
+		return overwriteError("merge", modified, untracked)
+	}
+	return nil
+}
+
+// mergeFileContents merges one file changed on both sides and stores the
+// result as a blob, returning its hash and content. Binary files and
+// symlinks are never merged line by line; our version is kept, with no new
+// content to write, and the path reported as conflicted.
+func mergeFileContents(repo *repository.Repository, path, baseHash string, ours, theirs repository.IndexEntry, targetName string) (string, []byte, bool, error) {
+	if ours.Type == tree.EntryTypeSymlink || theirs.Type == tree.EntryTypeSymlink {
+		return ours.Hash, nil, true, nil
+	}
+
+	var baseContent []byte
+	if baseHash != "" {
+		baseBlob, err := repo.RetrieveBlob(baseHash)
+		if err != nil {
+			return "", nil, false, fmt.Errorf("failed to load blob %s: %w", baseHash, err)
+		}
+		baseContent = baseBlob.Content
+	}
+	ourBlob, err := repo.RetrieveBlob(ours.Hash)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("failed to load blob %s: %w", ours.Hash, err)
+	}
+	theirBlob, err := repo.RetrieveBlob(theirs.Hash)
 	if err != nil {
-		return fmt.Errorf("failed to load target tree: %w", err)
+		return "", nil, false, fmt.Errorf("failed to load blob %s: %w", theirs.Hash, err)
 	}
 
-	repoRoot := filepath.Dir(repo.NotgitDir)
+	if diff.IsBinary(baseContent) || diff.IsBinary(ourBlob.Content) || diff.IsBinary(theirBlob.Content) {
+		return ours.Hash, nil, true, nil
+	}
 
-	index, err := repo.LoadIndex()
+	result := diff.Merge3(baseContent, ourBlob.Content, theirBlob.Content, "HEAD", targetName)
+	merged, err := blob.NewBlob(result.Content)
+	if err != nil {
+		return "", nil, false, err
+	}
+	mergedHash, err := repo.StoreObject(merged)
 	if err != nil {
-		return fmt.Errorf("failed to load index: %w", err)
+		return "", nil, false, fmt.Errorf("failed to store merged blob for %s: %w", path, err)
 	}
 
-	trackedFiles := make(map[string]bool)
-	for _, entry := range index.Entries {
-		trackedFiles[entry.Path] = true
+	return mergedHash, result.Content, result.Conflicts > 0, nil
+}
+
+// workingUpdate is one change a merge makes to the working tree: a removal,
+// a mode change, or new content for a file.
+type workingUpdate struct {
+	path      string
+	content   []byte
+	entryType tree.EntryType
+	remove    bool
+	modeOnly  bool
+}
+
+// checkFileDirectoryClashes refuses a merge whose result would need a path
+// to be both a file and a directory, either within the merged tree itself
+// or because of untracked files in the way. resultPaths holds every path
+// left in the working tree after updates are applied.
+func checkFileDirectoryClashes(repo *repository.Repository, resultPaths map[string]bool, updates []workingUpdate) error {
+	removed := make(map[string]bool)
+	for _, u := range updates {
+		if u.remove {
+			removed[u.path] = true
+		}
 	}
 
-	if err := removeTrackedFiles(repoRoot, repo.NotgitDir, trackedFiles); err != nil {
-		return fmt.Errorf("failed to remove tracked files: %w", err)
+	var clashes []string
+	for _, file := range sortedKeys(resultPaths) {
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			if resultPaths[dir] {
+				clashes = append(clashes, fmt.Sprintf("%s (%s)", dir, file))
+				break
+			}
+			info, err := os.Lstat(filepath.Join(repo.BaseDir, filepath.FromSlash(dir)))
+			if err == nil && !info.IsDir() && !removed[dir] {
+				clashes = append(clashes, fmt.Sprintf("%s (%s)", dir, file))
+				break
+			}
+		}
 	}
 
-	if err := restoreTreeToWorkingDirectory(repo, targetTree, repoRoot); err != nil {
-		return fmt.Errorf("failed to restore tree: %w", err)
+	// A file written where a directory is must not lose what is left in it
+	for _, u := range updates {
+		if u.remove || u.modeOnly {
+			continue
+		}
+		fullPath := filepath.Join(repo.BaseDir, filepath.FromSlash(u.path))
+		if info, err := os.Lstat(fullPath); err != nil || !info.IsDir() {
+			continue
+		}
+		err := filepath.WalkDir(fullPath, func(walked string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(repo.BaseDir, walked)
+			if err != nil {
+				return err
+			}
+			if !removed[filepath.ToSlash(rel)] {
+				clashes = append(clashes, fmt.Sprintf("%s (%s)", u.path, filepath.ToSlash(rel)))
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read working tree: %w", err)
+		}
 	}
 
-	currentBranchPath := filepath.Join(repo.NotgitDir, "refs", "heads", currentBranch)
-	if err := os.WriteFile(currentBranchPath, []byte(targetCommitHash+"\n"), 0o644); err != nil {
-		return fmt.Errorf("failed to update branch ref: %w", err)
+	if len(clashes) == 0 {
+		return nil
 	}
+	sort.Strings(clashes)
+	return fmt.Errorf("the merge would need these paths to be both a file and a directory:\n\t%s\nPlease move or remove the files in the way, or rename them on one side, and merge again.", strings.Join(clashes, "\n\t"))
+}
 
+// applyWorkingUpdates writes a planned merge to the working tree. Removals
+// go first so that a file can replace a directory emptied by the merge.
+func applyWorkingUpdates(repo *repository.Repository, updates []workingUpdate) error {
+	for _, u := range updates {
+		if !u.remove {
+			continue
+		}
+		if err := removeWorkingFile(repo, u.path); err != nil {
+			return err
+		}
+	}
+	for _, u := range updates {
+		switch {
+		case u.remove:
+		case u.modeOnly:
+			if err := setWorkingFileMode(repo, u.path, u.entryType); err != nil {
+				return err
+			}
+		default:
+			if err := writeWorkingFile(repo, u.path, u.content, u.entryType); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
+
+func optionalEntry(entry repository.IndexEntry, ok bool) *repository.IndexEntry {
+	if !ok {
+		return nil
+	}
+	return &entry
+}
+
+// mergeEntryTypes merges the modes of a file present on both sides: a mode
+// changed on one side only wins, and differing changes on both sides are a
+// conflict, keeping ours.
+func mergeEntryTypes(base repository.IndexEntry, inBase bool, ours, theirs repository.IndexEntry) (tree.EntryType, bool) {
+	switch {
+	case ours.Type == theirs.Type:
+		return ours.Type, false
+	case inBase && base.Type == ours.Type:
+		return theirs.Type, false
+	case inBase && base.Type == theirs.Type:
+		return ours.Type, false
+	default:
+		return ours.Type, true
+	}
+}
@@ -0,0 +1,164 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var mvForceBool bool
+var mvDryRunBool bool
+var mvVerboseBool bool
+
+var mvCmd = &cobra.Command{
+	Use:   "mv [-f] [-n] <source>... <destination>",
+	Short: "Move or rename a file or a directory",
+	Long: `Rename <source> to <destination> in the working tree and in the index.
+When <destination> is an existing directory, or more than one source is
+given, the sources are moved into it.
+
+A source must be tracked; a directory is moved with everything in it and all
+the tracked files below it are renamed in the index. An existing destination
+file is only overwritten with -f.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: mvCallback,
+}
+
+func init() {
+	mvCmd.Flags().BoolVarP(&mvForceBool, "force", "f", false, "Overwrite an existing destination file")
+	mvCmd.Flags().BoolVarP(&mvDryRunBool, "dry-run", "n", false, "Only show what would be moved")
+	mvCmd.Flags().BoolVarP(&mvVerboseBool, "verbose", "v", false, "Report the names of files as they are moved")
+	rootCmd.AddCommand(mvCmd)
+}
+
+type pathMove struct {
+	source      string
+	destination string
+}
+
+func mvCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	index, err := repo.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Rollback()
+
+	sources, dest := args[:len(args)-1], args[len(args)-1]
+	destRel, err := pathspecPath(repo, dest)
+	if err != nil {
+		return err
+	}
+	destInfo, err := os.Lstat(dest)
+	intoDir := err == nil && destInfo.IsDir()
+	if len(sources) > 1 && !intoDir {
+		return fmt.Errorf("destination '%s' is not a directory", dest)
+	}
+
+	var moves []pathMove
+	targets := make(map[string]string)
+	for _, source := range sources {
+		sourceRel, err := pathspecPath(repo, source)
+		if err != nil {
+			return err
+		}
+		destination := destRel
+		if intoDir {
+			destination = path.Join(destRel, path.Base(sourceRel))
+		}
+
+		if err := checkMove(repo, index.Index, sourceRel, destination, mvForceBool); err != nil {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%w, source=%s, destination=%s", err, sourceRel, destination)
+		}
+		if other, ok := targets[destination]; ok {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("multiple sources for the same target, source=%s, destination=%s (also from %s)", sourceRel, destination, other)
+		}
+		targets[destination] = sourceRel
+		moves = append(moves, pathMove{source: sourceRel, destination: destination})
+	}
+
+	out := cmd.OutOrStdout()
+	for _, m := range moves {
+		if mvVerboseBool || mvDryRunBool {
+			fmt.Fprintf(out, "Renaming %s to %s\n", m.source, m.destination)
+		}
+		if mvDryRunBool {
+			continue
+		}
+
+		sourcePath := filepath.Join(repo.BaseDir, filepath.FromSlash(m.source))
+		destPath := filepath.Join(repo.BaseDir, filepath.FromSlash(m.destination))
+		if err := os.Rename(sourcePath, destPath); err != nil {
+			return fmt.Errorf("failed to rename %s to %s: %w", m.source, m.destination, err)
+		}
+		removeEmptyParents(repo, sourcePath)
+
+		for _, p := range index.PathsUnder(m.source) {
+			if err := index.RenameEntry(p, m.destination+strings.TrimPrefix(p, m.source)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if mvDryRunBool {
+		return nil
+	}
+	if err := index.Commit(); err != nil {
+		return fmt.Errorf("failed to save the index: %w", err)
+	}
+	return nil
+}
+
+// checkMove reports why source cannot be moved to destination, both
+// repository-relative paths, with an error phrased like Git's.
+func checkMove(repo *repository.Repository, index *repository.Index, source, destination string, force bool) error {
+	if source == "" {
+		return fmt.Errorf("bad source")
+	}
+	sourceInfo, err := os.Lstat(filepath.Join(repo.BaseDir, filepath.FromSlash(source)))
+	if err != nil {
+		return fmt.Errorf("bad source")
+	}
+
+	tracked := index.PathsUnder(source)
+	switch {
+	case len(tracked) == 0 && sourceInfo.IsDir():
+		return fmt.Errorf("source directory is empty")
+	case len(tracked) == 0 || (!sourceInfo.IsDir() && tracked[0] != source):
+		return fmt.Errorf("not under version control")
+	case sourceInfo.IsDir() && (destination == source || strings.HasPrefix(destination, source+"/")):
+		return fmt.Errorf("can not move directory into itself")
+	}
+	for _, p := range tracked {
+		if _, ok := index.Unmerged[p]; ok {
+			return fmt.Errorf("conflicted")
+		}
+	}
+
+	destPath := filepath.Join(repo.BaseDir, filepath.FromSlash(destination))
+	if parent, err := os.Stat(filepath.Dir(destPath)); err != nil || !parent.IsDir() {
+		return fmt.Errorf("destination directory does not exist")
+	}
+	if destInfo, err := os.Lstat(destPath); err == nil {
+		if sourceInfo.IsDir() || destInfo.IsDir() {
+			return fmt.Errorf("destination already exists")
+		}
+		if !force {
+			return fmt.Errorf("destination exists")
+		}
+	} else if len(index.PathsUnder(destination)) > 0 && !force {
+		return fmt.Errorf("destination exists in the index")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMvDirectory(t *testing.T) {
+	repo := newTestRepo(t)
+	first := commitFiles(t, repo, "first", map[string]string{"src/a.txt": "a\n", "src/sub/b.txt": "b\n", "other.txt": "other\n"})
+	writeFile(t, "src/untracked.txt", "untracked\n")
+
+	out := runCommand(t, "mv", "-v", "src", "lib")
+
+	require.Equal(t, "Renaming src to lib\n", out)
+	committed := treeEntries(t, repo, first)
+	index := loadIndex(t, repo)
+	require.Equal(t, []string{"lib/a.txt", "lib/sub/b.txt", "other.txt"}, index.PathsUnder(""))
+	require.Equal(t, committed["src/a.txt"].Hash, index.Entries["lib/a.txt"].Hash)
+	require.Equal(t, committed["src/sub/b.txt"].Hash, index.Entries["lib/sub/b.txt"].Hash)
+	require.NoDirExists(t, "src")
+	require.Equal(t, "a\n", readFile(t, "lib/a.txt"))
+	require.Equal(t, "b\n", readFile(t, "lib/sub/b.txt"))
+	require.Equal(t, "untracked\n", readFile(t, "lib/untracked.txt"))
+}
+
+func TestMvIntoDirectory(t *testing.T) {
+	repo := newTestRepo(t)
+	commitFiles(t, repo, "first", map[string]string{"a.txt": "a\n", "b.txt": "b\n", "dest/c.txt": "c\n"})
+
+	runCommand(t, "mv", "a.txt", "b.txt", "dest")
+
+	require.Equal(t, []string{"dest/a.txt", "dest/b.txt", "dest/c.txt"}, loadIndex(t, repo).PathsUnder(""))
+	require.NoFileExists(t, "a.txt")
+	require.Equal(t, "b\n", readFile(t, "dest/b.txt"))
+}
+
+func TestMvRefusals(t *testing.T) {
+	repo := newTestRepo(t)
+	commitFiles(t, repo, "first", map[string]string{"a.txt": "a\n", "b.txt": "b\n", "dir/c.txt": "c\n"})
+	writeFile(t, "untracked.txt", "untracked\n")
+
+	_, err := execCommand(t, "mv", "a.txt", "b.txt")
+	require.ErrorContains(t, err, "destination exists, source=a.txt, destination=b.txt")
+	_, err = execCommand(t, "mv", "untracked.txt", "new.txt")
+	require.ErrorContains(t, err, "not under version control")
+	_, err = execCommand(t, "mv", "dir", "dir/inner")
+	require.ErrorContains(t, err, "can not move directory into itself")
+	_, err = execCommand(t, "mv", "-n", "a.txt", "c.txt")
+	require.NoError(t, err)
+	require.FileExists(t, "a.txt")
+
+	runCommand(t, "mv", "-f", "a.txt", "b.txt")
+	require.Equal(t, []string{"b.txt", "dir/c.txt"}, loadIndex(t, repo).PathsUnder(""))
+	require.Equal(t, "a\n", readFile(t, "b.txt"))
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var packRefsAllBool bool
+
+var packRefsCmd = &cobra.Command{
+	Use:   "pack-refs [--all]",
+	Short: "Pack refs into a single file",
+	Long: `Move refs from one file per ref under .notgit/refs into the
+.notgit/packed-refs file, which is faster to read when there are many of
+them. The loose files are deleted.
+
+By default only tags, which rarely change, and refs that are already packed
+are moved. With --all, branches are packed as well. A packed branch that is
+updated is written as a loose ref again, which takes precedence.`,
+	Args: cobra.NoArgs,
+	RunE: packRefsCallback,
+}
+
+func init() {
+	packRefsCmd.Flags().BoolVar(&packRefsAllBool, "all", false, "Pack all refs, not only tags")
+	rootCmd.AddCommand(packRefsCmd)
+}
+
+func packRefsCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	count, err := repo.Refs().Pack(packRefsAllBool)
+	if err != nil {
+		return fmt.Errorf("failed to pack refs: %w", err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Packed %d %s\n", count, pluralRef(count))
+	return nil
+}
+
+func pluralRef(n int) string {
+	if n == 1 {
+		return "ref"
+	}
+	return "refs"
+}
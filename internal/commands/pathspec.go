@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+)
+
+// pathspecPath converts a path given on the command line to a path relative
+// to the repository root, "" standing for the root itself.
+func pathspecPath(repo *repository.Repository, arg string) (string, error) {
+	relPath, err := repoRelativePath(repo, arg)
+	if err != nil {
+		return "", err
+	}
+	if relPath == "" {
+		absPath, err := filepath.Abs(arg)
+		if err != nil {
+			return "", fmt.Errorf("could not get absolute path for %s: %w", arg, err)
+		}
+		if absPath != repo.BaseDir {
+			return "", fmt.Errorf("'%s' is outside the repository", arg)
+		}
+	}
+	return relPath, nil
+}
+
+// pathspec selects repository paths named on the command line: a file, a
+// directory and everything below it, or a glob. A glob without a slash
+// matches file names in any directory below the current one.
+type pathspec struct {
+	arg  string
+	path string
+	glob bool
+	// dir is the current directory relative to the root, for globs
+	dir string
+}
+
+func parsePathspec(repo *repository.Repository, arg string) (pathspec, error) {
+	if !strings.ContainsAny(arg, "*?[") {
+		relPath, err := pathspecPath(repo, arg)
+		return pathspec{arg: arg, path: relPath}, err
+	}
+
+	dir, err := pathspecPath(repo, ".")
+	if err != nil {
+		return pathspec{}, err
+	}
+	pattern := path.Join(dir, filepath.ToSlash(arg))
+	if _, err := path.Match(pattern, ""); err != nil {
+		return pathspec{}, fmt.Errorf("invalid pathspec '%s': %w", arg, err)
+	}
+	return pathspec{arg: arg, path: pattern, glob: true, dir: dir}, nil
+}
+
+// Matches reports whether a repository-relative path is selected.
+func (p pathspec) Matches(relPath string) bool {
+	if !p.glob {
+		return p.path == "" || relPath == p.path || strings.HasPrefix(relPath, p.path+"/")
+	}
+	// A glob naming a directory selects everything below it
+	for candidate := relPath; candidate != "."; candidate = path.Dir(candidate) {
+		if ok, _ := path.Match(p.path, candidate); ok {
+			return true
+		}
+	}
+	if strings.Contains(p.arg, "/") || (p.dir != "" && !strings.HasPrefix(relPath, p.dir+"/")) {
+		return false
+	}
+	ok, _ := path.Match(filepath.ToSlash(p.arg), path.Base(relPath))
+	return ok
+}
@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathspecMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		spec pathspec
+		path string
+		want bool
+	}{
+		{"root matches everything", pathspec{arg: ".", path: ""}, "a/b.txt", true},
+		{"exact file", pathspec{arg: "a.txt", path: "a.txt"}, "a.txt", true},
+		{"directory selects files below it", pathspec{arg: "docs", path: "docs"}, "docs/sub/x.md", true},
+		{"directory is not a name prefix", pathspec{arg: "docs", path: "docs"}, "docs.txt", false},
+		{"file does not select siblings", pathspec{arg: "a.txt", path: "a.txt"}, "b.txt", false},
+
+		{"glob at the root", pathspec{arg: "*.go", path: "*.go", glob: true}, "main.go", true},
+		{"glob without slash below subdirectories", pathspec{arg: "*.go", path: "*.go", glob: true}, "internal/cmd/main.go", true},
+		{"glob without slash checks the base name", pathspec{arg: "*.go", path: "*.go", glob: true}, "go/README", false},
+		{"glob from a subdirectory stays inside it", pathspec{arg: "*.go", path: "sub/*.go", glob: true, dir: "sub"}, "other/x.go", false},
+		{"glob from a subdirectory reaches deeper files", pathspec{arg: "*.go", path: "sub/*.go", glob: true, dir: "sub"}, "sub/deep/x.go", true},
+		{"glob with slash is anchored", pathspec{arg: "src/*.c", path: "src/*.c", glob: true}, "lib/src/a.c", false},
+		{"glob with slash does not cross directories", pathspec{arg: "src/*.c", path: "src/*.c", glob: true}, "src/sub/a.c", false},
+		{"glob naming a directory selects everything below", pathspec{arg: "d?cs", path: "d?cs", glob: true}, "docs/sub/x.md", true},
+		{"glob naming a nested directory", pathspec{arg: "a/*/c", path: "a/*/c", glob: true}, "a/b/c/d/e.txt", true},
+		{"character class", pathspec{arg: "[ab].txt", path: "[ab].txt", glob: true}, "c.txt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.spec.Matches(tt.path))
+		})
+	}
+}
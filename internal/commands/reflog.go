@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reflogExpire  string
+	reflogAllBool bool
+)
+
+// defaultReflogExpiry matches Git's gc.reflogExpire default of 90 days.
+const defaultReflogExpiry = 90 * 24 * time.Hour
+
+var reflogCmd = &cobra.Command{
+	Use:   "reflog [show] [<ref>]",
+	Short: "Show, expire or delete reflog entries",
+	Long: `Manage the reflogs under .notgit/logs, which record every update of HEAD
+and of each branch.
+
+"notgit reflog" shows the log of HEAD, newest first. Each entry can be used
+as a revision, e.g. "notgit switch -c rescue HEAD@{2}" or "main@{1}".`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: showReflogCallback,
+}
+
+var reflogShowCmd = &cobra.Command{
+	Use:   "show [<ref>]",
+	Short: "Show the entries of a reflog, newest first",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  showReflogCallback,
+}
+
+var reflogExpireCmd = &cobra.Command{
+	Use:   "expire [--expire=<time>] [--all | <ref>...]",
+	Short: "Remove reflog entries older than a given time",
+	Long: `Remove reflog entries older than --expire, which defaults to 90 days.
+
+<time> is "now" or "all" to remove every entry, "never" to keep all of them,
+a number of days such as "30.days", or a duration such as "12h".`,
+	RunE: expireReflogCallback,
+}
+
+var reflogDeleteCmd = &cobra.Command{
+	Use:   "delete <ref>@{<n>}...",
+	Short: "Delete single entries from a reflog",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  deleteReflogCallback,
+}
+
+func init() {
+	reflogExpireCmd.Flags().StringVar(&reflogExpire, "expire", "", "Remove entries older than this time")
+	reflogExpireCmd.Flags().BoolVar(&reflogAllBool, "all", false, "Expire the reflogs of all refs")
+	reflogCmd.AddCommand(reflogShowCmd)
+	reflogCmd.AddCommand(reflogExpireCmd)
+	reflogCmd.AddCommand(reflogDeleteCmd)
+	rootCmd.AddCommand(reflogCmd)
+}
+
+func showReflogCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	name := "HEAD"
+	if len(args) == 1 {
+		name = args[0]
+	}
+	ref, err := repo.ReflogRef(name)
+	if err != nil {
+		return err
+	}
+
+	entries, err := repo.ReadReflog(ref)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	for i := len(entries) - 1; i >= 0; i-- {
+		hash := entries[i].NewHash
+		if hash == "" {
+			hash = strings.Repeat("0", 7)
+		}
+		fmt.Fprintf(out, "%s %s@{%d}: %s\n", hash[:7], name, len(entries)-1-i, entries[i].Message)
+	}
+	return nil
+}
+
+func expireReflogCallback(cmd *cobra.Command, args []string) error {
+	if reflogAllBool == (len(args) > 0) {
+		return fmt.Errorf("specify either --all or at least one ref")
+	}
+
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	cutoff, err := parseReflogExpiry(reflogExpire, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var refs []string
+	if reflogAllBool {
+		if refs, err = repo.ReflogRefs(); err != nil {
+			return err
+		}
+	} else {
+		for _, name := range args {
+			ref, err := repo.ReflogRef(name)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, ref)
+		}
+	}
+
+	for _, ref := range refs {
+		entries, err := repo.ReadReflog(ref)
+		if err != nil {
+			return err
+		}
+
+		kept := entries[:0]
+		for _, entry := range entries {
+			if !entry.Committer.Time.Before(cutoff) {
+				kept = append(kept, entry)
+			}
+		}
+		if removed := len(entries) - len(kept); removed > 0 {
+			if err := repo.WriteReflog(ref, kept); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Expired %d entr%s from %s\n", removed, pluralEntry(removed), ref)
+		}
+	}
+	return nil
+}
+
+// parseReflogExpiry returns the time before which entries are expired. The
+// zero time expires nothing.
+func parseReflogExpiry(value string, now time.Time) (time.Time, error) {
+	switch value {
+	case "":
+		return now.Add(-defaultReflogExpiry), nil
+	case "now", "all":
+		// Entries written in the same second as the expiry still go
+		return now.Add(time.Second), nil
+	case "never", "false":
+		return time.Time{}, nil
+	}
+
+	if days, ok := strings.CutSuffix(strings.TrimSuffix(value, ".ago"), ".days"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry time '%s'", value)
+}
+
+func deleteReflogCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	for _, arg := range args {
+		name, n, ok := repository.ParseReflogSelector(arg)
+		if !ok {
+			return fmt.Errorf("'%s' is not a reflog entry; expected <ref>@{<n>}", arg)
+		}
+		ref, err := repo.ReflogRef(name)
+		if err != nil {
+			return err
+		}
+
+		entries, err := repo.ReadReflog(ref)
+		if err != nil {
+			return err
+		}
+		if n >= len(entries) {
+			return fmt.Errorf("log for '%s' only has %d entries", ref, len(entries))
+		}
+
+		i := len(entries) - 1 - n
+		entries = append(entries[:i], entries[i+1:]...)
+		if err := repo.WriteReflog(ref, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pluralEntry(n int) string {
+	if n == 1 {
+		return "y"
+	}
+	return "ies"
+}
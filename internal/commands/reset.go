@@ -0,0 +1,281 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var resetSoftBool bool
+var resetMixedBool bool
+var resetHardBool bool
+var resetQuietBool bool
+
+var resetCmd = &cobra.Command{
+	Use:   "reset [--soft | --mixed | --hard] [<rev>] [[--] <paths>...]",
+	Short: "Reset the current HEAD to a given commit, or unstage files",
+	Long: `Move the current branch (or a detached HEAD) to <rev>, HEAD by default:
+
+  --soft   only move HEAD; the index and working tree are kept, so the
+           changes of the undone commits show up as staged
+  --mixed  also reset the index to <rev>, keeping the working tree
+           (the default)
+  --hard   also reset the working tree; uncommitted changes to tracked
+           files are lost, untracked files are kept
+
+With paths, HEAD does not move: the index entries for the paths are reset to
+their version in <rev>, which unstages changes ("notgit reset <file>").
+An aborted or conflicted merge in progress is cleared by --mixed and --hard.`,
+	RunE: resetCallback,
+}
+
+func init() {
+	resetCmd.Flags().BoolVar(&resetSoftBool, "soft", false, "Only move HEAD")
+	resetCmd.Flags().BoolVar(&resetMixedBool, "mixed", false, "Move HEAD and reset the index (default)")
+	resetCmd.Flags().BoolVar(&resetHardBool, "hard", false, "Move HEAD and reset the index and working tree")
+	resetCmd.Flags().BoolVarP(&resetQuietBool, "quiet", "q", false, "Only report errors")
+	rootCmd.AddCommand(resetCmd)
+}
+
+func resetCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	mode := "mixed"
+	modes := 0
+	for name, set := range map[string]bool{"soft": resetSoftBool, "mixed": resetMixedBool, "hard": resetHardBool} {
+		if set {
+			mode = name
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("--soft, --mixed and --hard are mutually exclusive")
+	}
+
+	rev, paths, err := splitResetArgs(repo, args, cmd.ArgsLenAtDash())
+	if err != nil {
+		return err
+	}
+
+	oldHash, err := repo.GetHEADCommitHash()
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	// On a branch without commits, HEAD stands for the empty tree
+	targetHash := oldHash
+	if rev != "HEAD" || oldHash != "" {
+		if targetHash, err = repo.ResolveCommit(rev); err != nil {
+			return err
+		}
+	}
+
+	cmd.SilenceUsage = true
+	if paths != nil {
+		if mode != "mixed" {
+			return fmt.Errorf("cannot do %s reset with paths", mode)
+		}
+		if err := resetPaths(repo, targetHash, paths); err != nil {
+			return err
+		}
+		return printUnstagedAfterReset(cmd, repo)
+	}
+
+	mergeHead, err := repo.ReadMergeHead()
+	if err != nil {
+		return err
+	}
+	if mode == "soft" && mergeHead != "" {
+		return fmt.Errorf("cannot do a soft reset in the middle of a merge")
+	}
+
+	switch mode {
+	case "mixed":
+		if err := resetIndex(repo, targetHash); err != nil {
+			return err
+		}
+	case "hard":
+		if err := resetWorkingTree(repo, oldHash, targetHash); err != nil {
+			return err
+		}
+	}
+
+	if targetHash != "" {
+		if err := repo.UpdateHEADFrom(targetHash, oldHash, reflogSignature(), "reset: moving to "+rev); err != nil {
+			return fmt.Errorf("failed to update HEAD: %w", err)
+		}
+	}
+	if mode != "soft" {
+		if err := repo.ClearMergeState(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case mode == "hard" && targetHash != "" && !resetQuietBool:
+		fmt.Fprintf(cmd.OutOrStdout(), "HEAD is now at %s %s\n", repo.ShortHash(targetHash), commitSubject(repo, targetHash))
+	case mode == "mixed":
+		return printUnstagedAfterReset(cmd, repo)
+	}
+	return nil
+}
+
+// splitResetArgs separates the revision from the paths. Without "--", the
+// first argument is the revision if it names a commit and not also a file.
+// paths is nil when no path was given.
+func splitResetArgs(repo *repository.Repository, args []string, dash int) (string, []string, error) {
+	if dash >= 0 {
+		switch dash {
+		case 0:
+			return "HEAD", args, nil
+		case 1:
+			return args[0], args[1:], nil
+		default:
+			return "", nil, fmt.Errorf("only one revision may be given before '--'")
+		}
+	}
+	if len(args) == 0 {
+		return "HEAD", nil, nil
+	}
+
+	_, revErr := repo.ResolveCommit(args[0])
+	_, statErr := os.Lstat(args[0])
+	switch {
+	case revErr == nil && statErr == nil:
+		return "", nil, fmt.Errorf("ambiguous argument '%s': both revision and filename\nUse '--' to separate paths from revisions", args[0])
+	case revErr == nil:
+		if len(args) == 1 {
+			return args[0], nil, nil
+		}
+		return args[0], args[1:], nil
+	case statErr != nil && len(args) == 1:
+		if index, err := repo.LoadIndex(); err != nil || !index.IsTracked(args[0]) {
+			return "", nil, fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree", args[0])
+		}
+	}
+	return "HEAD", args, nil
+}
+
+// resetIndex replaces the index with the tree of commitHash. Entries that do
+// not change keep their cached file metadata.
+func resetIndex(repo *repository.Repository, commitHash string) error {
+	index, err := repo.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Rollback()
+	newIndex, err := commitIndex(repo, commitHash)
+	if err != nil {
+		return err
+	}
+
+	for path, entry := range newIndex.Entries {
+		if old, ok := index.Entries[path]; ok && old.Stat != nil && sameEntry(old, true, entry, true) {
+			newIndex.SetStat(path, *old.Stat)
+		}
+	}
+	index.Index = newIndex
+	if err := index.Commit(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	return nil
+}
+
+// resetWorkingTree makes the index and working tree match the tree of
+// toHash, discarding local changes. checkoutCommit keeps staged files that
+// neither commit has, so those are deleted first.
+func resetWorkingTree(repo *repository.Repository, fromHash, toHash string) error {
+	index, err := repo.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Rollback()
+	fromIndex, err := commitIndex(repo, fromHash)
+	if err != nil {
+		return err
+	}
+	toIndex, err := commitIndex(repo, toHash)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range index.PathsUnder("") {
+		if !fromIndex.IsTracked(path) && !toIndex.IsTracked(path) {
+			if err := removeWorkingFile(repo, path); err != nil {
+				return err
+			}
+			index.RemoveEntry(path)
+		}
+	}
+
+	return checkoutLockedIndex(repo, index, fromHash, toHash, "reset", true)
+}
+
+// resetPaths sets the index entries of the given paths, and of the files
+// below them, to their version in commitHash, removing those it lacks.
+func resetPaths(repo *repository.Repository, commitHash string, paths []string) error {
+	index, err := repo.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Rollback()
+	target, err := commitIndex(repo, commitHash)
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range paths {
+		relPath, err := pathspecPath(repo, arg)
+		if err != nil {
+			return err
+		}
+		matched := append(index.PathsUnder(relPath), target.PathsUnder(relPath)...)
+		for _, path := range slices.Compact(slices.Sorted(slices.Values(matched))) {
+			entry, ok := target.Entries[path]
+			if !ok {
+				index.RemoveEntry(path)
+				continue
+			}
+			if current, tracked := index.Entries[path]; !tracked || !sameEntry(current, true, entry, true) {
+				index.AddEntryWithType(path, entry.Hash, entry.Type)
+			}
+		}
+	}
+
+	if err := index.Commit(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	return nil
+}
+
+// printUnstagedAfterReset lists the tracked files whose working copy no
+// longer matches the reset index.
+func printUnstagedAfterReset(cmd *cobra.Command, repo *repository.Repository) error {
+	if resetQuietBool {
+		return nil
+	}
+	status, err := getRepositoryStatus(repo)
+	if err != nil {
+		return fmt.Errorf("error while getting repository status: %w", err)
+	}
+
+	unstaged := getUnstagedEntries(status.Entries)
+	if len(unstaged) == 0 {
+		return nil
+	}
+	out := cmd.OutOrStdout()
+	fmt.Fprintln(out, "Unstaged changes after reset:")
+	for _, entry := range unstaged {
+		code := "M"
+		if entry.WorkingStatus == StatusDeleted {
+			code = "D"
+		}
+		fmt.Fprintf(out, "%s\t%s\n", code, entry.Path)
+	}
+	return nil
+}
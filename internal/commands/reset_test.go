@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetSoftKeepsIndexAndWorkingTree(t *testing.T) {
+	repo := newTestRepo(t)
+	first := commitFiles(t, repo, "first", map[string]string{"f.txt": "one\n"})
+	second := commitFiles(t, repo, "second", map[string]string{"f.txt": "two\n"})
+
+	runCommand(t, "reset", "--soft", "HEAD~1")
+
+	require.Equal(t, first, headHash(t, repo))
+	require.Equal(t, treeEntries(t, repo, second)["f.txt"].Hash, loadIndex(t, repo).Entries["f.txt"].Hash)
+	require.Equal(t, "two\n", readFile(t, "f.txt"))
+}
+
+func TestResetMixedResetsIndexOnly(t *testing.T) {
+	repo := newTestRepo(t)
+	first := commitFiles(t, repo, "first", map[string]string{"f.txt": "one\n"})
+	commitFiles(t, repo, "second", map[string]string{"f.txt": "two\n", "new.txt": "new\n"})
+
+	out := runCommand(t, "reset", "HEAD~1")
+
+	require.Equal(t, first, headHash(t, repo))
+	index := loadIndex(t, repo)
+	require.Equal(t, treeEntries(t, repo, first)["f.txt"].Hash, index.Entries["f.txt"].Hash)
+	require.False(t, index.IsTracked("new.txt"))
+	require.Equal(t, "two\n", readFile(t, "f.txt"))
+	require.Equal(t, "new\n", readFile(t, "new.txt"))
+	require.Equal(t, "Unstaged changes after reset:\nM\tf.txt\n", out)
+}
+
+func TestResetHardKeepsUntrackedFiles(t *testing.T) {
+	repo := newTestRepo(t)
+	first := commitFiles(t, repo, "first", map[string]string{"f.txt": "one\n"})
+	commitFiles(t, repo, "second", map[string]string{"f.txt": "two\n", "added.txt": "added\n"})
+	writeFile(t, "f.txt", "local edit\n")
+	writeFile(t, "staged.txt", "staged\n")
+	runCommand(t, "add", "staged.txt")
+	writeFile(t, "untracked.txt", "untracked\n")
+
+	out := runCommand(t, "reset", "--hard", "HEAD~1")
+
+	require.Equal(t, first, headHash(t, repo))
+	require.Contains(t, out, "HEAD is now at")
+	require.Equal(t, "one\n", readFile(t, "f.txt"))
+	require.NoFileExists(t, "added.txt")
+	require.NoFileExists(t, "staged.txt")
+	require.Equal(t, "untracked\n", readFile(t, "untracked.txt"))
+	require.Equal(t, treeEntries(t, repo, first), withoutStat(loadIndex(t, repo).Entries))
+}
+
+func TestResetHardClearsMergeState(t *testing.T) {
+	repo := newTestRepo(t)
+	commitFiles(t, repo, "base", map[string]string{"f.txt": "base\n"})
+	runCommand(t, "branch", "topic")
+	ours := commitFiles(t, repo, "ours", map[string]string{"f.txt": "ours\n"})
+	runCommand(t, "switch", "topic")
+	commitFiles(t, repo, "theirs", map[string]string{"f.txt": "theirs\n"})
+	runCommand(t, "switch", "master")
+
+	_, err := execCommand(t, "merge", "topic")
+	require.Error(t, err)
+	mergeHead, err := repo.ReadMergeHead()
+	require.NoError(t, err)
+	require.NotEmpty(t, mergeHead)
+
+	runCommand(t, "reset", "--hard")
+
+	mergeHead, err = repo.ReadMergeHead()
+	require.NoError(t, err)
+	require.Empty(t, mergeHead)
+	require.Equal(t, ours, headHash(t, repo))
+	require.Empty(t, loadIndex(t, repo).Unmerged)
+	require.Equal(t, "ours\n", readFile(t, "f.txt"))
+}
+
+func TestResetSoftRefusedDuringMerge(t *testing.T) {
+	repo := newTestRepo(t)
+	commitFiles(t, repo, "base", map[string]string{"f.txt": "base\n"})
+	runCommand(t, "branch", "topic")
+	commitFiles(t, repo, "ours", map[string]string{"f.txt": "ours\n"})
+	runCommand(t, "switch", "topic")
+	commitFiles(t, repo, "theirs", map[string]string{"f.txt": "theirs\n"})
+	runCommand(t, "switch", "master")
+	_, err := execCommand(t, "merge", "topic")
+	require.Error(t, err)
+
+	_, err = execCommand(t, "reset", "--soft")
+	require.ErrorContains(t, err, "cannot do a soft reset in the middle of a merge")
+}
+
+func TestResetPathUnstagesFile(t *testing.T) {
+	repo := newTestRepo(t)
+	first := commitFiles(t, repo, "first", map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	writeFile(t, "a.txt", "a changed\n")
+	writeFile(t, "b.txt", "b changed\n")
+	writeFile(t, "new.txt", "new\n")
+	runCommand(t, "add", "a.txt", "b.txt", "new.txt")
+
+	out := runCommand(t, "reset", "a.txt", "new.txt")
+
+	require.Equal(t, first, headHash(t, repo))
+	index := loadIndex(t, repo)
+	committed := treeEntries(t, repo, first)
+	require.Equal(t, committed["a.txt"].Hash, index.Entries["a.txt"].Hash)
+	require.NotEqual(t, committed["b.txt"].Hash, index.Entries["b.txt"].Hash)
+	require.False(t, index.IsTracked("new.txt"))
+	require.Equal(t, "a changed\n", readFile(t, "a.txt"))
+	require.Equal(t, "Unstaged changes after reset:\nM\ta.txt\n", out)
+}
+
+func TestResetRevisionPaths(t *testing.T) {
+	repo := newTestRepo(t)
+	first := commitFiles(t, repo, "first", map[string]string{"dir/a.txt": "a1\n", "b.txt": "b1\n"})
+	second := commitFiles(t, repo, "second", map[string]string{"dir/a.txt": "a2\n", "dir/new.txt": "new\n", "b.txt": "b2\n"})
+
+	runCommand(t, "reset", "-q", "HEAD~1", "--", "dir")
+
+	require.Equal(t, second, headHash(t, repo))
+	index := loadIndex(t, repo)
+	require.Equal(t, treeEntries(t, repo, first)["dir/a.txt"].Hash, index.Entries["dir/a.txt"].Hash)
+	require.False(t, index.IsTracked("dir/new.txt"))
+	require.Equal(t, treeEntries(t, repo, second)["b.txt"].Hash, index.Entries["b.txt"].Hash)
+	require.Equal(t, "a2\n", readFile(t, "dir/a.txt"))
+}
+
+func TestResetAmbiguousArgument(t *testing.T) {
+	repo := newTestRepo(t)
+	commitFiles(t, repo, "first", map[string]string{"f.txt": "one\n"})
+	runCommand(t, "branch", "topic")
+	writeFile(t, "topic", "a file named like the branch\n")
+
+	_, err := execCommand(t, "reset", "topic")
+	require.ErrorContains(t, err, "ambiguous argument 'topic': both revision and filename")
+
+	_, err = execCommand(t, "reset", "nosuchthing")
+	require.ErrorContains(t, err, "unknown revision or path not in the working tree")
+
+	// "--" settles which one is meant
+	runCommand(t, "reset", "topic", "--")
+	runCommand(t, "reset", "--", "topic")
+	_, err = os.Stat("topic")
+	require.NoError(t, err)
+}
@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var restoreSource string
+var restoreStagedBool bool
+var restoreWorktreeBool bool
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [--staged] [--worktree] [--source=<rev>] <pathspec>...",
+	Short: "Restore working tree files or unstage changes",
+	Long: `Restore the given paths from a source.
+
+With --worktree (the default), working files are overwritten with their
+version in the index, discarding unstaged changes. With --staged, the index
+entries are reset to HEAD instead, unstaging changes; give both to do both.
+--source takes the content from any commit. Tracked paths the source does
+not have are removed.
+
+A pathspec is a file, a directory (everything below it) or a glob such as
+"*.go"; a glob without a slash matches file names in any directory. An
+untracked working file is only overwritten when it is named exactly.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: restoreCallback,
+}
+
+func init() {
+	restoreCmd.Flags().StringVarP(&restoreSource, "source", "s", "", "Restore from the tree of this commit")
+	restoreCmd.Flags().BoolVarP(&restoreStagedBool, "staged", "S", false, "Restore the index")
+	restoreCmd.Flags().BoolVarP(&restoreWorktreeBool, "worktree", "W", false, "Restore the working tree (default)")
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func restoreCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	worktree := restoreWorktreeBool || !restoreStagedBool
+	source := restoreSource
+	if source == "" && restoreStagedBool {
+		source = "HEAD"
+	}
+
+	cmd.SilenceUsage = true
+	return restorePaths(repo, args, source, restoreStagedBool, worktree)
+}
+
+// restorePaths copies the paths matching pathspecs from the tree of the
+// commit source, or from the index if source is "", into the index and/or
+// the working tree.
+func restorePaths(repo *repository.Repository, pathspecs []string, source string, staged, worktree bool) error {
+	index, err := repo.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Rollback()
+
+	from := index.Index
+	if source != "" {
+		hash, err := repo.GetHEADCommitHash()
+		if err != nil {
+			return fmt.Errorf("failed to read HEAD: %w", err)
+		}
+		// HEAD of a branch without commits is the empty tree
+		if source != "HEAD" || hash != "" {
+			if hash, err = repo.ResolveCommit(source); err != nil {
+				return err
+			}
+		}
+		if from, err = commitIndex(repo, hash); err != nil {
+			return err
+		}
+	}
+
+	var specs []pathspec
+	for _, arg := range pathspecs {
+		spec, err := parsePathspec(repo, arg)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, spec)
+	}
+
+	// Candidates are the paths known to the source or the index
+	known := append(from.PathsUnder(""), index.PathsUnder("")...)
+	selected := make(map[string]bool)
+	explicit := make(map[string]bool)
+	for _, spec := range specs {
+		matched := false
+		for _, path := range known {
+			if spec.Matches(path) {
+				selected[path] = true
+				explicit[path] = explicit[path] || (!spec.glob && path == spec.path)
+				matched = true
+			}
+		}
+		if !matched {
+			return fmt.Errorf("pathspec '%s' did not match any file(s) known to notgit", spec.arg)
+		}
+	}
+	paths := sortedKeys(selected)
+
+	if worktree {
+		if err := restoreWorkingFiles(repo, index.Index, from, source == "", paths, explicit); err != nil {
+			return err
+		}
+	}
+
+	if staged {
+		for _, path := range paths {
+			entry, ok := from.Entries[path]
+			if !ok {
+				index.RemoveEntry(path)
+				continue
+			}
+			if current, tracked := index.Entries[path]; !tracked || !sameEntry(current, true, entry, true) {
+				index.AddEntryWithType(path, entry.Hash, entry.Type)
+			}
+		}
+		if err := index.Commit(); err != nil {
+			return fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+	return nil
+}
+
+// restoreWorkingFiles makes the working files at paths match from. It
+// refuses to restore unmerged paths from the index and to overwrite
+// untracked files that were not named explicitly.
+func restoreWorkingFiles(repo *repository.Repository, index, from *repository.Index, fromIndex bool, paths []string, explicit map[string]bool) error {
+	var unmerged, untracked []string
+	for _, path := range paths {
+		if _, ok := index.Unmerged[path]; ok && fromIndex {
+			unmerged = append(unmerged, path)
+		}
+		if _, inFrom := from.Entries[path]; inFrom && !index.IsTracked(path) && !explicit[path] {
+			if _, err := os.Lstat(filepath.Join(repo.BaseDir, filepath.FromSlash(path))); err == nil {
+				untracked = append(untracked, path)
+			}
+		}
+	}
+	if len(unmerged) > 0 {
+		return fmt.Errorf("the following paths are unmerged:\n\t%s\nresolve them with \"notgit add\" or restore them with --source=HEAD", strings.Join(unmerged, "\n\t"))
+	}
+	if len(untracked) > 0 {
+		return fmt.Errorf("the following untracked working tree files would be overwritten by restore:\n\t%s\nname them explicitly to overwrite them", strings.Join(untracked, "\n\t"))
+	}
+
+	for _, path := range paths {
+		entry, ok := from.Entries[path]
+		if !ok {
+			if index.IsTracked(path) {
+				if err := removeWorkingFile(repo, path); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		fullPath := filepath.Join(repo.BaseDir, filepath.FromSlash(path))
+		if info, err := os.Lstat(fullPath); err == nil && !info.IsDir() {
+			if hash, err := computeFileHash(fullPath, info); err == nil && hash == entry.Hash && fileEntryType(info.Mode()) == entry.Type {
+				continue
+			}
+		}
+
+		b, err := repo.RetrieveBlob(entry.Hash)
+		if err != nil {
+			return fmt.Errorf("failed to load blob %s: %w", entry.Hash, err)
+		}
+		if err := writeWorkingFile(repo, path, b.Content, entry.Type); err != nil {
+			return err
+		}
+	}
+	return nil
+}
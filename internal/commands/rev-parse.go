@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var revParseShortBool bool
+var revParseAbbrevRefBool bool
+
+var revParseCmd = &cobra.Command{
+	Use:   "rev-parse <revision>...",
+	Short: "Resolve revisions to object names",
+	Long: `Print the object name each revision refers to.
+
+Revisions can be full or abbreviated hashes, HEAD, branch names, @{-n} for the
+n-th previously checked out branch, <ref>@{n} for the value of a ref n
+updates ago, and any of them followed by ~<n> or ^<n> to walk to ancestors. <rev>:<path> names the blob or tree at path in a commit
+and :<path> names the blob staged in the index.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: revParseCallback,
+}
+
+func init() {
+	revParseCmd.Flags().BoolVar(&revParseShortBool, "short", false, "Print the shortest unique abbreviation of each object name")
+	revParseCmd.Flags().BoolVar(&revParseAbbrevRefBool, "abbrev-ref", false, "Print the branch name instead of the object name where possible")
+	rootCmd.AddCommand(revParseCmd)
+}
+
+func revParseCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	for _, rev := range args {
+		if revParseAbbrevRefBool {
+			name, err := abbreviatedRefName(repo, rev)
+			if err != nil {
+				return err
+			}
+			if name != "" {
+				fmt.Fprintln(cmd.OutOrStdout(), name)
+				continue
+			}
+		}
+
+		hash, err := repo.ResolveRevision(rev)
+		if err != nil {
+			return err
+		}
+
+		if revParseShortBool {
+			hash = repo.ShortHash(hash)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), hash)
+	}
+
+	return nil
+}
+
+// abbreviatedRefName returns the branch name a revision refers to, or an empty
+// string if it is not a branch (e.g. a hash or a detached HEAD).
+func abbreviatedRefName(repo *repository.Repository, rev string) (string, error) {
+	if rev == "HEAD" || rev == "@" {
+		branch, err := repo.GetCurrentBranch()
+		if err != nil {
+			return "", err
+		}
+		if branch == "" {
+			return "HEAD", nil
+		}
+		return branch, nil
+	}
+
+	name, err := repo.ResolveBranchShorthand(rev)
+	if err != nil {
+		return "", err
+	}
+	if branchExists(repo, name) {
+		return name, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,177 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var rmCachedBool bool
+var rmRecursiveBool bool
+var rmForceBool bool
+var rmQuietBool bool
+var rmIgnoreUnmatchBool bool
+
+var rmCmd = &cobra.Command{
+	Use:   "rm [-r] [--cached] [-f] <pathspec>...",
+	Short: "Remove files from the working tree and from the index",
+	Long: `Remove tracked files from the index and delete them from the working tree,
+so that the next commit no longer contains them. With --cached, the files are
+only removed from the index and stay in the working tree as untracked files.
+
+Directories are only removed with -r. To protect uncommitted work, a file is
+not removed if its working copy or its staged content differs from HEAD;
+--cached allows it as long as the staged content matches either HEAD or the
+working file. Use -f to skip these checks.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: rmCallback,
+}
+
+func init() {
+	rmCmd.Flags().BoolVar(&rmCachedBool, "cached", false, "Only remove from the index")
+	rmCmd.Flags().BoolVarP(&rmRecursiveBool, "recursive", "r", false, "Allow recursive removal of directories")
+	rmCmd.Flags().BoolVarP(&rmForceBool, "force", "f", false, "Override the up-to-date check")
+	rmCmd.Flags().BoolVarP(&rmQuietBool, "quiet", "q", false, "Do not list removed files")
+	rmCmd.Flags().BoolVar(&rmIgnoreUnmatchBool, "ignore-unmatch", false, "Exit with success even if no files matched")
+	rootCmd.AddCommand(rmCmd)
+}
+
+func rmCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	index, err := repo.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Rollback()
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		relPath, err := pathspecPath(repo, arg)
+		if err != nil {
+			return err
+		}
+
+		matched := index.PathsUnder(relPath)
+		if len(matched) == 0 {
+			if rmIgnoreUnmatchBool {
+				continue
+			}
+			return fmt.Errorf("pathspec '%s' did not match any files", arg)
+		}
+		if !rmRecursiveBool && (len(matched) > 1 || matched[0] != relPath) {
+			return fmt.Errorf("not removing '%s' recursively without -r", arg)
+		}
+		for _, path := range matched {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	if !rmForceBool {
+		if err := checkRemovable(repo, index.Index, paths, rmCachedBool); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+	}
+
+	for _, path := range paths {
+		index.RemoveEntry(path)
+		if !rmCachedBool {
+			if err := removeWorkingFile(repo, path); err != nil {
+				return err
+			}
+		}
+		if !rmQuietBool {
+			fmt.Fprintf(cmd.OutOrStdout(), "rm '%s'\n", path)
+		}
+	}
+
+	if err := index.Commit(); err != nil {
+		return fmt.Errorf("failed to save the index: %w", err)
+	}
+	return nil
+}
+
+// checkRemovable refuses to remove paths whose content would be lost: the
+// staged version differs from both HEAD and the working file, or, unless
+// cached is set, the staged or working version differs from HEAD.
+func checkRemovable(repo *repository.Repository, index *repository.Index, paths []string, cached bool) error {
+	headHash, err := repo.GetHEADCommitHash()
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	headIndex, err := commitIndex(repo, headHash)
+	if err != nil {
+		return err
+	}
+
+	var bothDiffer, staged, modified []string
+	refreshed := false
+	for _, path := range paths {
+		entry, ok := index.Entries[path]
+		if !ok {
+			// Removing a conflicted path resolves the conflict
+			continue
+		}
+		headEntry, inHead := headIndex.Entries[path]
+		stagedChange := !sameEntry(entry, true, headEntry, inHead)
+
+		localChange := false
+		fullPath := filepath.Join(repo.BaseDir, filepath.FromSlash(path))
+		if info, err := os.Lstat(fullPath); err == nil {
+			if info.IsDir() {
+				localChange = true
+			} else {
+				hash, err := workingFileHash(index, path, fullPath, info, &refreshed)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", path, err)
+				}
+				localChange = hash != entry.Hash || fileEntryType(info.Mode()) != entry.Type
+			}
+		}
+
+		switch {
+		case stagedChange && localChange:
+			bothDiffer = append(bothDiffer, path)
+		case stagedChange && !cached:
+			staged = append(staged, path)
+		case localChange && !cached:
+			modified = append(modified, path)
+		}
+	}
+
+	if len(bothDiffer)+len(staged)+len(modified) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	writeList := func(what string, list []string, hint string) {
+		if len(list) == 0 {
+			return
+		}
+		noun := "file has"
+		if len(list) > 1 {
+			noun = "files have"
+		}
+		fmt.Fprintf(&sb, "the following %s %s:\n", noun, what)
+		for _, path := range list {
+			fmt.Fprintf(&sb, "\t%s\n", path)
+		}
+		fmt.Fprintf(&sb, "(%s)\n", hint)
+	}
+	writeList("staged content different from both the file and the HEAD", bothDiffer, "use -f to force removal")
+	writeList("changes staged in the index", staged, "use --cached to keep the file, or -f to force removal")
+	writeList("local modifications", modified, "use --cached to keep the file, or -f to force removal")
+	return fmt.Errorf("%s", strings.TrimSuffix(sb.String(), "\n"))
+}
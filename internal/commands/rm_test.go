@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRmRefusesToLoseChanges(t *testing.T) {
+	repo := newTestRepo(t)
+	commitFiles(t, repo, "first", map[string]string{"modified.txt": "one\n", "staged.txt": "one\n", "both.txt": "one\n"})
+	writeFile(t, "modified.txt", "local edit\n")
+	writeFile(t, "staged.txt", "staged edit\n")
+	runCommand(t, "add", "staged.txt")
+	writeFile(t, "both.txt", "staged edit\n")
+	runCommand(t, "add", "both.txt")
+	writeFile(t, "both.txt", "another edit\n")
+
+	_, err := execCommand(t, "rm", "modified.txt")
+	require.ErrorContains(t, err, "the following file has local modifications:\n\tmodified.txt")
+	_, err = execCommand(t, "rm", "staged.txt")
+	require.ErrorContains(t, err, "the following file has changes staged in the index:\n\tstaged.txt")
+	_, err = execCommand(t, "rm", "--cached", "both.txt")
+	require.ErrorContains(t, err, "staged content different from both the file and the HEAD:\n\tboth.txt")
+
+	index := loadIndex(t, repo)
+	for _, path := range []string{"modified.txt", "staged.txt", "both.txt"} {
+		require.True(t, index.IsTracked(path), path)
+		require.FileExists(t, path)
+	}
+
+	// The staged content matches the working file, so nothing is lost
+	runCommand(t, "rm", "--cached", "staged.txt")
+	runCommand(t, "rm", "-f", "modified.txt", "both.txt")
+	index = loadIndex(t, repo)
+	require.Empty(t, index.Entries)
+	require.NoFileExists(t, "modified.txt")
+	require.NoFileExists(t, "both.txt")
+	require.Equal(t, "staged edit\n", readFile(t, "staged.txt"))
+}
+
+func TestRmCachedKeepsFile(t *testing.T) {
+	repo := newTestRepo(t)
+	commitFiles(t, repo, "first", map[string]string{"f.txt": "one\n", "g.txt": "two\n"})
+
+	out := runCommand(t, "rm", "--cached", "f.txt")
+
+	require.Equal(t, "rm 'f.txt'\n", out)
+	require.False(t, loadIndex(t, repo).IsTracked("f.txt"))
+	require.Equal(t, "one\n", readFile(t, "f.txt"))
+
+	runCommand(t, "rm", "-q", "g.txt")
+	require.False(t, loadIndex(t, repo).IsTracked("g.txt"))
+	require.NoFileExists(t, "g.txt")
+}
+
+func TestRmDirectoryNeedsRecursive(t *testing.T) {
+	repo := newTestRepo(t)
+	commitFiles(t, repo, "first", map[string]string{"dir/a.txt": "a\n", "dir/sub/b.txt": "b\n", "keep.txt": "keep\n"})
+
+	_, err := execCommand(t, "rm", "dir")
+	require.ErrorContains(t, err, "not removing 'dir' recursively without -r")
+	require.FileExists(t, "dir/a.txt")
+
+	out := runCommand(t, "rm", "-r", "dir")
+
+	require.Equal(t, "rm 'dir/a.txt'\nrm 'dir/sub/b.txt'\n", out)
+	require.Equal(t, []string{"keep.txt"}, loadIndex(t, repo).PathsUnder(""))
+	require.NoDirExists(t, "dir")
+
+	_, err = execCommand(t, "rm", "missing.txt")
+	require.ErrorContains(t, err, "pathspec 'missing.txt' did not match any files")
+	runCommand(t, "rm", "--ignore-unmatch", "missing.txt")
+}
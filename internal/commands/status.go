@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/Gr1shma/notgit/internal/objects/tree"
 	"github.com/Gr1shma/notgit/internal/repository"
 	"github.com/spf13/cobra"
 )
@@ -27,25 +28,32 @@ type StatusEntry struct {
 	Path          string
 	IndexStatus   FileStatus
 	WorkingStatus FileStatus
+	Unmerged      bool
+	Conflict      string // for unmerged paths, e.g. "both modified"
 	OriginalPath  string // for renames -> TODO: implement it
 }
 
 type RepositoryStatus struct {
 	Branch          string
+	Merging         bool
 	Entries         []StatusEntry
 	UntrackedFiles  []string
 	Repository      *repository.Repository
 	HasChanges      bool
 	StagedChanges   int
 	UnstagedChanges int
+	UnmergedChanges int
 }
 
 type FileInfo struct {
-	Path    string
-	Hash    string
-	Mode    os.FileMode
-	ModTime int64
-	Size    int64
+	Path       string
+	Hash       string
+	Conflicted bool
+	Conflict   string
+	Type       tree.EntryType
+	Mode       os.FileMode
+	ModTime    int64
+	Size       int64
 }
 
 var statusCmd = &cobra.Command{
@@ -87,6 +95,12 @@ func getRepositoryStatus(repo *repository.Repository) (*RepositoryStatus, error)
 	}
 	repoStatus.Branch = repoCurrentBranch
 
+	mergeHead, err := repo.ReadMergeHead()
+	if err != nil {
+		return nil, fmt.Errorf("error: reading merge state: %v", err)
+	}
+	repoStatus.Merging = mergeHead != ""
+
 	latestCommitTree, err := getLatestCommitTree(repo)
 	if err != nil {
 		return nil, fmt.Errorf("error: getting latest commit tree: %v", err)
@@ -107,6 +121,10 @@ func getRepositoryStatus(repo *repository.Repository) (*RepositoryStatus, error)
 	repoStatus.UntrackedFiles = untracked
 
 	for _, entry := range entries {
+		if entry.Unmerged {
+			repoStatus.UnmergedChanges++
+			continue
+		}
 		if entry.IndexStatus != StatusUnmodified {
 			repoStatus.StagedChanges++
 		}
@@ -115,35 +133,18 @@ func getRepositoryStatus(repo *repository.Repository) (*RepositoryStatus, error)
 		}
 	}
 
-	repoStatus.HasChanges = repoStatus.StagedChanges > 0 || repoStatus.UnstagedChanges > 0 || len(repoStatus.UntrackedFiles) > 0
+	repoStatus.HasChanges = repoStatus.StagedChanges > 0 || repoStatus.UnstagedChanges > 0 || repoStatus.UnmergedChanges > 0 || len(repoStatus.UntrackedFiles) > 0
 
 	return repoStatus, nil
 }
 
-func getLatestCommitTree(repo *repository.Repository) (map[string]string, error) {
-	headPath := filepath.Join(repo.NotgitDir, "HEAD")
-	headContent, err := os.ReadFile(headPath)
+func getLatestCommitTree(repo *repository.Repository) (map[string]FileInfo, error) {
+	commitHash, err := repo.GetHEADCommitHash()
 	if err != nil {
-		return nil, fmt.Errorf("error while reading the HEAD file")
-	}
-
-	ref := strings.TrimSpace(string(headContent))
-	var commitHash string
-	if strings.HasPrefix(ref, "ref: ") {
-		refPath := filepath.Join(repo.NotgitDir, strings.TrimPrefix(ref, "ref: "))
-		commitHashBytes, err := os.ReadFile(refPath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return make(map[string]string), nil
-			}
-			return nil, fmt.Errorf("failed to read ref file: %v", err)
-		}
-		commitHash = strings.TrimSpace(string(commitHashBytes))
-	} else {
-		commitHash = ref
+		return nil, err
 	}
 	if commitHash == "" {
-		return make(map[string]string), nil
+		return make(map[string]FileInfo), nil
 	}
 
 	commit, err := repo.RetrieveCommit(commitHash)
@@ -151,17 +152,12 @@ func getLatestCommitTree(repo *repository.Repository) (map[string]string, error)
 		return nil, fmt.Errorf("failed to retrieve commit: %v", err)
 	}
 
-	tree, err := repo.RetrieveTree(commit.TreeHash)
+	treeIndex, err := repo.ReadTree(commit.TreeHash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve tree: %v", err)
 	}
 
-	treeFiles := make(map[string]string)
-	for _, entry := range tree.Entries {
-		treeFiles[entry.Name] = entry.Hash
-	}
-
-	return treeFiles, nil
+	return indexFileInfos(treeIndex), nil
 }
 
 func getIndexFiles(repo *repository.Repository) (map[string]FileInfo, error) {
@@ -169,19 +165,64 @@ func getIndexFiles(repo *repository.Repository) (map[string]FileInfo, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load index: %w", err)
 	}
+	return indexFileInfos(index), nil
+}
+
+// indexFileInfos describes the entries of an index for status comparisons.
+func indexFileInfos(index *repository.Index) map[string]FileInfo {
 	files := make(map[string]FileInfo)
 	for path, entry := range index.Entries {
 		files[path] = FileInfo{
 			Path: entry.Path,
 			Hash: entry.Hash,
+			Type: entry.Type,
 		}
 	}
-	return files, nil
+	for path, unmerged := range index.Unmerged {
+		files[path] = FileInfo{Path: path, Conflicted: true, Conflict: conflictLabel(unmerged)}
+	}
+	return files
+}
+
+// conflictLabel describes an unmerged path by the stages it has, as in the
+// output of git status.
+func conflictLabel(unmerged repository.UnmergedEntry) string {
+	base, ours, theirs := unmerged.Base != nil, unmerged.Ours != nil, unmerged.Theirs != nil
+	switch {
+	case ours && theirs && base:
+		return "both modified"
+	case ours && theirs:
+		return "both added"
+	case ours && base:
+		return "deleted by them"
+	case ours:
+		return "added by us"
+	case theirs && base:
+		return "deleted by us"
+	case theirs:
+		return "added by them"
+	default:
+		return "both deleted"
+	}
 }
 
+// getWorkingDirectoryFiles hashes the files of the working tree. Untracked
+// files matched by the ignore rules are left out, and ignored directories
+// are not entered unless they contain tracked files.
 func getWorkingDirectoryFiles(repo *repository.Repository) (map[string]FileInfo, error) {
+	index, err := repo.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	matcher, err := repo.IgnoreMatcher()
+	if err != nil {
+		return nil, err
+	}
+	trackedDirs := trackedDirectories(index)
+	refreshed := false
+
 	files := make(map[string]FileInfo)
-	err := filepath.Walk(repo.BaseDir, func(path string, info fs.FileInfo, err error) error {
+	err = filepath.Walk(repo.BaseDir, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -190,20 +231,39 @@ func getWorkingDirectoryFiles(repo *repository.Repository) (map[string]FileInfo,
 			return err
 		}
 
-		if strings.HasPrefix(relPath, ".notgit") {
+		if isNotgitDir(relPath) {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		if info.IsDir() || relPath == "." {
+		if relPath == "." {
 			return nil
 		}
 
 		relPath = filepath.ToSlash(relPath)
 
-		hash, err := computeFileHash(path)
+		if info.IsDir() {
+			if !trackedDirs[relPath] {
+				if ignored, err := matcher.IsIgnored(relPath, true); err != nil {
+					return err
+				} else if ignored {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+
+		if !index.IsTracked(relPath) {
+			if ignored, err := matcher.IsIgnored(relPath, false); err != nil {
+				return err
+			} else if ignored {
+				return nil
+			}
+		}
+
+		hash, err := workingFileHash(index, relPath, path, info, &refreshed)
 		if err != nil {
 			return nil
 		}
@@ -211,6 +271,7 @@ func getWorkingDirectoryFiles(repo *repository.Repository) (map[string]FileInfo,
 		files[relPath] = FileInfo{
 			Path:    relPath,
 			Hash:    hash,
+			Type:    fileEntryType(info.Mode()),
 			Mode:    info.Mode(),
 			ModTime: info.ModTime().Unix(),
 			Size:    info.Size(),
@@ -218,12 +279,71 @@ func getWorkingDirectoryFiles(repo *repository.Repository) (map[string]FileInfo,
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return files, err
+	// Remember the metadata of files that were hashed and found unchanged so
+	// the next run can skip them
+	if refreshed {
+		if err := repo.RefreshIndex(index); err != nil {
+			return nil, fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+
+	return files, nil
 }
 
-func computeFileHash(path string) (string, error) {
-	data, err := os.ReadFile(path)
+// workingFileHash returns the blob hash of a working file, taking it from the
+// index when the file's metadata shows it is unchanged. When a tracked file
+// is hashed and matches its entry, the entry's metadata is updated and
+// refreshed is set.
+func workingFileHash(index *repository.Index, relPath, fullPath string, info fs.FileInfo, refreshed *bool) (string, error) {
+	stat := repository.StatFromFileInfo(info)
+	entry, tracked := index.Entries[relPath]
+	if tracked && index.IsStatClean(relPath, stat) {
+		return entry.Hash, nil
+	}
+
+	hash, err := computeFileHash(fullPath, info)
+	if err != nil {
+		return "", err
+	}
+	if tracked && entry.Hash == hash && entry.Type == fileEntryType(info.Mode()) {
+		if entry.Stat == nil || *entry.Stat != stat {
+			index.SetStat(relPath, stat)
+			*refreshed = true
+		}
+	}
+	return hash, nil
+}
+
+// isNotgitDir reports whether a path relative to the repository root is the
+// .notgit directory or inside it.
+func isNotgitDir(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	return relPath == ".notgit" || strings.HasPrefix(relPath, ".notgit/")
+}
+
+// trackedDirectories returns every directory containing a tracked file.
+func trackedDirectories(index *repository.Index) map[string]bool {
+	dirs := make(map[string]bool)
+	addParents := func(path string) {
+		for dir := filepath.ToSlash(filepath.Dir(path)); dir != "." && !dirs[dir]; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			dirs[dir] = true
+		}
+	}
+	for path := range index.Entries {
+		addParents(path)
+	}
+	for path := range index.Unmerged {
+		addParents(path)
+	}
+	return dirs
+}
+
+func computeFileHash(path string, info fs.FileInfo) (string, error) {
+	data, err := readWorkingContent(path, info)
 	if err != nil {
 		return "", err
 	}
@@ -234,7 +354,7 @@ func computeFileHash(path string) (string, error) {
 	return hex.EncodeToString(hash[:]), nil
 }
 
-func buildCompleteStatusEntries(headTree map[string]string, indexFiles map[string]FileInfo, workingFiles map[string]FileInfo) ([]StatusEntry, []string) {
+func buildCompleteStatusEntries(headTree map[string]FileInfo, indexFiles map[string]FileInfo, workingFiles map[string]FileInfo) ([]StatusEntry, []string) {
 	var entries []StatusEntry
 	var untracked []string
 	processedFiles := make(map[string]bool)
@@ -253,10 +373,18 @@ func buildCompleteStatusEntries(headTree map[string]string, indexFiles map[strin
 	for path := range allPaths {
 		entry := StatusEntry{Path: path}
 
-		headHash, inHead := headTree[path]
+		headFile, inHead := headTree[path]
 		indexFile, inIndex := indexFiles[path]
 		workingFile, inWorking := workingFiles[path]
 
+		if inIndex && indexFile.Conflicted {
+			entry.Unmerged = true
+			entry.Conflict = indexFile.Conflict
+			entries = append(entries, entry)
+			processedFiles[path] = true
+			continue
+		}
+
 		// Determine index status (HEAD vs Index comparison)
 		if !inHead && inIndex {
 			// New file added to index
@@ -266,7 +394,7 @@ func buildCompleteStatusEntries(headTree map[string]string, indexFiles map[strin
 			entry.IndexStatus = StatusDeleted
 		} else if inHead && inIndex {
 			// File exists in both, check if modified
-			if headHash != indexFile.Hash {
+			if headFile.Hash != indexFile.Hash || headFile.Type != indexFile.Type {
 				entry.IndexStatus = StatusModified
 			} else {
 				entry.IndexStatus = StatusUnmodified
@@ -278,21 +406,19 @@ func buildCompleteStatusEntries(headTree map[string]string, indexFiles map[strin
 
 		// Determine working status (Index vs Working Directory comparison)
 		if !inIndex && inWorking {
-			// File exists in working dir but not in index
+			// File exists in working dir but not in index, so it is
+			// untracked even if its removal from HEAD is staged
+			untracked = append(untracked, path)
 			if !inHead {
-				// File is completely untracked
-				untracked = append(untracked, path)
 				continue
-			} else {
-				// File was deleted from index but still exists in working dir
-				entry.WorkingStatus = StatusModified
 			}
+			entry.WorkingStatus = StatusUnmodified
 		} else if inIndex && !inWorking {
 			// File deleted from working directory
 			entry.WorkingStatus = StatusDeleted
 		} else if inIndex && inWorking {
 			// File exists in both, check if modified
-			if indexFile.Hash != workingFile.Hash {
+			if indexFile.Hash != workingFile.Hash || indexFile.Type != workingFile.Type {
 				entry.WorkingStatus = StatusModified
 			} else {
 				entry.WorkingStatus = StatusUnmodified
@@ -321,27 +447,48 @@ func buildCompleteStatusEntries(headTree map[string]string, indexFiles map[strin
 
 func printStatus(cmd *cobra.Command, status *RepositoryStatus) {
 	out := cmd.OutOrStdout()
-	fmt.Fprintf(out, "On branch %s\n", status.Branch)
+	if status.Branch == "" {
+		fmt.Fprintln(out, detachedHEADLabel(status.Repository))
+	} else {
+		fmt.Fprintf(out, "On branch %s\n", status.Branch)
+	}
+
+	if status.Merging {
+		if status.UnmergedChanges > 0 {
+			fmt.Fprintf(out, "You have unmerged paths.\n  (fix conflicts and run \"notgit commit\")\n")
+		} else {
+			fmt.Fprintf(out, "All conflicts fixed but you are still merging.\n  (use \"notgit commit\" to conclude merge)\n")
+		}
+	}
 
 	if !status.HasChanges {
-		fmt.Fprintf(out, "nothing to commit, working tree clean")
+		fmt.Fprintln(out, "nothing to commit, working tree clean")
 		return
 	}
 
 	stagedEntries := getStagedEntries(status.Entries)
 	if len(stagedEntries) > 0 {
 		fmt.Fprintf(out, "\nChanges to be committed:")
-		fmt.Fprintf(out, "  (use \"notgit reset HEAD <file>...\" to unstage)\n")
+		fmt.Fprintf(out, "  (use \"notgit restore --staged <file>...\" to unstage)\n")
 		for _, entry := range stagedEntries {
 			fmt.Fprintf(out, "  %s: %s\n", getStatusString(entry.IndexStatus), entry.Path)
 		}
 	}
 
+	unmergedEntries := getUnmergedEntries(status.Entries)
+	if len(unmergedEntries) > 0 {
+		fmt.Fprintf(out, "\nUnmerged paths:")
+		fmt.Fprintf(out, "  (use \"notgit add <file>...\" to mark resolution)\n")
+		for _, entry := range unmergedEntries {
+			fmt.Fprintf(out, "  %s: %s\n", entry.Conflict, entry.Path)
+		}
+	}
+
 	unstagedEntries := getUnstagedEntries(status.Entries)
 	if len(unstagedEntries) > 0 {
 		fmt.Fprintf(out, "\nChanges not staged for commit:")
 		fmt.Fprintf(out, "  (use \"notgit add <file>...\" to update what will be committed)")
-		fmt.Fprintf(out, "  (use \"notgit checkout -- <file>...\" to discard changes in working directory)\n")
+		fmt.Fprintf(out, "  (use \"notgit restore <file>...\" to discard changes in working directory)\n")
 		for _, entry := range unstagedEntries {
 			fmt.Fprintf(out, "  %s: %s\n", getStatusString(entry.WorkingStatus), entry.Path)
 		}
@@ -356,14 +503,14 @@ func printStatus(cmd *cobra.Command, status *RepositoryStatus) {
 	}
 
 	if len(stagedEntries) == 0 && (len(unstagedEntries) > 0 || len(status.UntrackedFiles) > 0) {
-		fmt.Fprintf(out, "\nno changes added to commit (use \"notgit add\" and/or \"notgit commit -a\")")
+		fmt.Fprintln(out, "\nno changes added to commit (use \"notgit add\" and/or \"notgit commit -a\")")
 	}
 }
 
 func getStagedEntries(entries []StatusEntry) []StatusEntry {
 	var staged []StatusEntry
 	for _, entry := range entries {
-		if entry.IndexStatus != StatusUnmodified {
+		if !entry.Unmerged && entry.IndexStatus != StatusUnmodified {
 			staged = append(staged, entry)
 		}
 	}
@@ -376,7 +523,7 @@ func getStagedEntries(entries []StatusEntry) []StatusEntry {
 func getUnstagedEntries(entries []StatusEntry) []StatusEntry {
 	var unstaged []StatusEntry
 	for _, entry := range entries {
-		if entry.WorkingStatus != StatusUnmodified {
+		if !entry.Unmerged && entry.WorkingStatus != StatusUnmodified {
 			unstaged = append(unstaged, entry)
 		}
 	}
@@ -386,6 +533,16 @@ func getUnstagedEntries(entries []StatusEntry) []StatusEntry {
 	return unstaged
 }
 
+func getUnmergedEntries(entries []StatusEntry) []StatusEntry {
+	var unmerged []StatusEntry
+	for _, entry := range entries {
+		if entry.Unmerged {
+			unmerged = append(unmerged, entry)
+		}
+	}
+	return unmerged
+}
+
 func getStatusString(status FileStatus) string {
 	switch status {
 	case StatusModified:
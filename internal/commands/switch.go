@@ -1,34 +1,45 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
-	"github.com/Gr1shma/notgit/internal/objects/tree"
 	"github.com/Gr1shma/notgit/internal/repository"
 	"github.com/spf13/cobra"
 )
 
 var createAndSwitch bool
+var switchForceBool bool
+var switchDetachBool bool
 
 var switchCmd = &cobra.Command{
-	Use:   "switch <branch-name>",
+	Use:   "switch [--detach] <branch-name> [<start-point>]",
 	Short: "Switch branches",
 	Long: `Switch to a specified branch.
 
 With -c flag, creates a new branch if it doesn't exist and switches to it.
-
-WARNING: Uncommitted changes will be lost when switching branches.
-Make sure to commit your changes before switching.
-Untracked files will be preserved.`,
-	Args: cobra.ExactArgs(1),
+The new branch starts at <start-point> (any revision) or at HEAD if omitted.
+Use "-" or @{-n} to switch back to a previously checked out branch.
+
+With --detach, check out any commit instead and point HEAD directly at it
+("detached HEAD"). Commits made there belong to no branch; create one with
+"notgit switch -c <name>" to keep them.
+
+Local changes to files that are the same on both branches are carried over.
+If a file with uncommitted changes differs between the branches, or an
+untracked file would be overwritten, the switch is refused and the files are
+listed. Use --force (or --discard-changes) to throw such changes away.
+Untracked files are otherwise preserved.`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: switchCallback,
 }
 
 func init() {
 	switchCmd.Flags().BoolVarP(&createAndSwitch, "create", "c", false, "Create the branch if it doesn't exist")
+	switchCmd.Flags().BoolVarP(&switchForceBool, "force", "f", false, "Discard local changes that would be overwritten")
+	switchCmd.Flags().BoolVar(&switchForceBool, "discard-changes", false, "Synonym for --force")
+	switchCmd.Flags().BoolVarP(&switchDetachBool, "detach", "d", false, "Check out a commit with a detached HEAD")
 	rootCmd.AddCommand(switchCmd)
 }
 
@@ -38,203 +49,201 @@ func switchCallback(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to open repository: %w", err)
 	}
 
-	branchName := args[0]
-
-	if strings.Contains(branchName, "/") {
-		return fmt.Errorf("nested branch names are not supported")
+	if switchDetachBool {
+		if createAndSwitch || len(args) != 1 {
+			return fmt.Errorf("--detach takes a single revision and cannot be used with -c")
+		}
+		return detachHEAD(cmd, repo, args[0], switchForceBool)
 	}
 
-	branchPath := filepath.Join(repo.NotgitDir, "refs", "heads", branchName)
+	branchName, err := repo.ResolveBranchShorthand(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve '%s': %w", args[0], err)
+	}
 
-	_, err = os.Stat(branchPath)
-	branchExists := err == nil
+	startPoint := ""
+	if len(args) == 2 {
+		if !createAndSwitch {
+			return fmt.Errorf("a start point can only be given together with -c")
+		}
+		startPoint = args[1]
+	}
 
-	if !branchExists {
-		if createAndSwitch {
-			if err := createBranchFromHEAD(repo, branchName); err != nil {
+	if !branchExists(repo, branchName) {
+		switch {
+		case branchName != args[0] && !createAndSwitch:
+			// "-" or @{-n} naming a commit that was checked out detached
+			return detachHEAD(cmd, repo, branchName, switchForceBool)
+		case createAndSwitch:
+			if err := repository.ValidateBranchName(branchName); err != nil {
+				return err
+			}
+			if err := createBranch(cmd, repo, branchName, startPoint); err != nil {
 				return fmt.Errorf("failed to create branch: %w", err)
 			}
-		} else {
+		default:
+			if _, err := repo.ResolveCommit(branchName); err == nil {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("a branch is expected, got '%s'\nhint: to check out the commit with a detached HEAD, use --detach", args[0])
+			}
 			return fmt.Errorf("branch '%s' does not exist. Use -c to create it", branchName)
 		}
 	}
 
-	if err := switchToBranch(repo, branchName); err != nil {
+	if err := switchToBranch(cmd, repo, branchName, switchForceBool); err != nil {
 		return fmt.Errorf("failed to switch branch: %w", err)
 	}
 
 	return nil
 }
 
-func switchToBranch(repo *repository.Repository, branchName string) error {
+func switchToBranch(cmd *cobra.Command, repo *repository.Repository, branchName string, force bool) error {
 	currentBranch, err := repo.GetCurrentBranch()
 	if err != nil {
 		return fmt.Errorf("failed to get current branch: %w", err)
 	}
 
 	if currentBranch == branchName {
-		fmt.Printf("Already on '%s'\n", branchName)
+		fmt.Fprintf(cmd.OutOrStdout(), "Already on '%s'\n", branchName)
 		return nil
 	}
 
-	branchPath := filepath.Join(repo.NotgitDir, "refs", "heads", branchName)
-	if _, err := os.Stat(branchPath); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("branch '%s' does not exist", branchName)
-		}
-		return fmt.Errorf("failed to check branch existence: %w", err)
+	if !branchExists(repo, branchName) {
+		return fmt.Errorf("branch '%s' does not exist", branchName)
 	}
 
-	if err := updateWorkingDirectory(repo, branchName); err != nil {
-		return fmt.Errorf("failed to update working directory: %w", err)
+	oldHash, err := repo.GetHEADCommitHash()
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD: %w", err)
 	}
 
-	headPath := filepath.Join(repo.NotgitDir, "HEAD")
-	newHeadContent := fmt.Sprintf("ref: refs/heads/%s\n", branchName)
-	if err := os.WriteFile(headPath, []byte(newHeadContent), 0o644); err != nil {
+	if err := updateWorkingDirectory(cmd, repo, oldHash, branchName, force); err != nil {
+		return err
+	}
+
+	from := currentBranch
+	if from == "" {
+		from = oldHash
+	}
+	tx := repo.Refs().Transaction()
+	tx.SetSymbolic("HEAD", "refs/heads/"+branchName, fmt.Sprintf("checkout: moving from %s to %s", from, branchName))
+	if err := tx.Commit(reflogSignature()); err != nil {
 		return fmt.Errorf("failed to update HEAD: %w", err)
 	}
 
-	fmt.Printf("Switched to branch '%s'\n", branchName)
+	if currentBranch == "" {
+		newHash, _ := repo.GetHEADCommitHash()
+		warnOrphanedCommits(cmd, repo, oldHash, newHash)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Switched to branch '%s'\n", branchName)
 	return nil
 }
 
-func updateWorkingDirectory(repo *repository.Repository, branchName string) error {
-	branchPath := filepath.Join(repo.NotgitDir, "refs", "heads", branchName)
-	commitHashBytes, err := os.ReadFile(branchPath)
+// detachHEAD checks out the commit rev names and points HEAD directly at it.
+func detachHEAD(cmd *cobra.Command, repo *repository.Repository, rev string, force bool) error {
+	commitHash, err := repo.ResolveCommit(rev)
 	if err != nil {
-		return fmt.Errorf("failed to read branch ref: %w", err)
-	}
-
-	commitHash := strings.TrimSpace(string(commitHashBytes))
-	if commitHash == "" {
-		return fmt.Errorf("branch '%s' has no commits", branchName)
+		return err
 	}
-
-	commit, err := repo.RetrieveCommit(commitHash)
+	currentBranch, err := repo.GetCurrentBranch()
 	if err != nil {
-		return fmt.Errorf("failed to load commit: %w", err)
+		return fmt.Errorf("failed to get current branch: %w", err)
 	}
-
-	targetTree, err := repo.RetrieveTree(commit.TreeHash)
+	oldHash, err := repo.GetHEADCommitHash()
 	if err != nil {
-		return fmt.Errorf("failed to load tree: %w", err)
+		return fmt.Errorf("failed to read HEAD: %w", err)
 	}
 
-	repoRoot := filepath.Dir(repo.NotgitDir)
-
-	index, err := repo.LoadIndex()
-	if err != nil {
-		return fmt.Errorf("failed to load index: %w", err)
+	if err := checkoutCommit(repo, oldHash, commitHash, "checkout", force); err != nil {
+		cmd.SilenceUsage = true
+		return err
 	}
 
-	trackedFiles := make(map[string]bool)
-	for _, entry := range index.Entries {
-		trackedFiles[entry.Path] = true
+	from := currentBranch
+	if from == "" {
+		from = oldHash
 	}
-
-	if err := removeTrackedFiles(repoRoot, repo.NotgitDir, trackedFiles); err != nil {
-		return fmt.Errorf("failed to remove tracked files: %w", err)
+	tx := repo.Refs().Transaction()
+	tx.Queue(repository.RefUpdate{
+		Name:    "HEAD",
+		NewHash: commitHash,
+		NoDeref: true,
+		Message: fmt.Sprintf("checkout: moving from %s to %s", from, rev),
+	})
+	if err := tx.Commit(reflogSignature()); err != nil {
+		return fmt.Errorf("failed to update HEAD: %w", err)
 	}
 
-	if err := restoreTreeToWorkingDirectory(repo, targetTree, repoRoot); err != nil {
-		return fmt.Errorf("failed to restore tree: %w", err)
+	if currentBranch == "" {
+		warnOrphanedCommits(cmd, repo, oldHash, commitHash)
 	}
-
+	fmt.Fprintf(cmd.OutOrStdout(), "HEAD is now at %s %s\n", repo.ShortHash(commitHash), commitSubject(repo, commitHash))
 	return nil
 }
 
-func removeTrackedFiles(repoRoot, notgitDir string, trackedFiles map[string]bool) error {
-	absNotgitDir, err := filepath.Abs(notgitDir)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path for .notgit: %w", err)
-	}
-
-	for trackedPath := range trackedFiles {
-		fullPath := filepath.Join(repoRoot, trackedPath)
-		absPath, err := filepath.Abs(fullPath)
-		if err != nil {
-			continue
-		}
+// maxOrphansListed is how many lost commits are named before summarizing.
+const maxOrphansListed = 4
 
-		if strings.HasPrefix(absPath, absNotgitDir+string(filepath.Separator)) {
-			continue
-		}
-
-		if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to remove %s: %w", fullPath, err)
-		}
+// warnOrphanedCommits lists the commits made on a detached HEAD that no
+// branch can reach any more after HEAD moved from oldHash to newHash.
+func warnOrphanedCommits(cmd *cobra.Command, repo *repository.Repository, oldHash, newHash string) {
+	if oldHash == "" || oldHash == newHash {
+		return
+	}
+	lost, err := repo.UnreferencedCommits(oldHash, newHash)
+	if err != nil || len(lost) == 0 {
+		return
 	}
 
-	err = filepath.Walk(repoRoot, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			return nil
-		}
-
-		if absPath == absNotgitDir || strings.HasPrefix(absPath, absNotgitDir+string(filepath.Separator)) {
-			if info.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		if absPath == repoRoot {
-			return nil
-		}
-
-		if info.IsDir() {
-			entries, err := os.ReadDir(path)
-			if err != nil {
-				return nil
-			}
-			if len(entries) == 0 {
-				os.Remove(path)
-			}
+	noun, pronoun := "commit", "it"
+	if len(lost) > 1 {
+		noun, pronoun = "commits", "them"
+	}
+	out := cmd.ErrOrStderr()
+	fmt.Fprintf(out, "Warning: you are leaving %d %s behind, not connected to\nany of your branches:\n\n", len(lost), noun)
+	for i, hash := range lost {
+		if i == maxOrphansListed {
+			fmt.Fprintf(out, " ... and %d more.\n", len(lost)-i)
+			break
 		}
-
-		return nil
-	})
-
-	return err
+		fmt.Fprintf(out, "  %s %s\n", repo.ShortHash(hash), commitSubject(repo, hash))
+	}
+	fmt.Fprintf(out, "\nIf you want to keep %s by creating a new branch, this may be a good time\nto do so with:\n\n notgit branch <new-branch-name> %s\n\n", pronoun, repo.ShortHash(oldHash))
 }
 
-func restoreTreeToWorkingDirectory(repo *repository.Repository, tr *tree.Tree, basePath string) error {
-	for _, entry := range tr.Entries {
-		entryPath := filepath.Join(basePath, entry.Name)
-
-		if entry.Type == tree.EntryTypeTree {
-			subtree, err := repo.RetrieveTree(entry.Hash)
-			if err != nil {
-				return fmt.Errorf("failed to load subtree %s: %w", entry.Hash, err)
-			}
-
-			if err := os.MkdirAll(entryPath, 0o755); err != nil {
-				return fmt.Errorf("failed to create directory %s: %w", entryPath, err)
-			}
+// detachedHEADLabel describes a detached HEAD as status and branch show it.
+func detachedHEADLabel(repo *repository.Repository) string {
+	name, at, err := repo.DetachedFrom()
+	if err != nil || name == "" {
+		hash, _ := repo.GetHEADCommitHash()
+		return "HEAD detached at " + repo.ShortHash(hash)
+	}
+	if at {
+		return "HEAD detached at " + name
+	}
+	return "HEAD detached from " + name
+}
 
-			if err := restoreTreeToWorkingDirectory(repo, subtree, entryPath); err != nil {
-				return err
-			}
-		} else {
-			blob, err := repo.RetrieveBlob(entry.Hash)
-			if err != nil {
-				return fmt.Errorf("failed to load blob %s: %w", entry.Hash, err)
-			}
+func commitSubject(repo *repository.Repository, hash string) string {
+	c, err := repo.RetrieveCommit(hash)
+	if err != nil {
+		return ""
+	}
+	return strings.SplitN(c.Message, "\n", 2)[0]
+}
 
-			parentDir := filepath.Dir(entryPath)
-			if err := os.MkdirAll(parentDir, 0o755); err != nil {
-				return fmt.Errorf("failed to create parent directory for %s: %w", entryPath, err)
-			}
+func updateWorkingDirectory(cmd *cobra.Command, repo *repository.Repository, oldHash, branchName string, force bool) error {
+	commitHash, err := repo.Refs().Resolve("refs/heads/" + branchName)
+	if errors.Is(err, repository.ErrRefNotFound) {
+		return fmt.Errorf("branch '%s' has no commits", branchName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read branch ref: %w", err)
+	}
 
-			if err := os.WriteFile(entryPath, blob.Content, 0o644); err != nil {
-				return fmt.Errorf("failed to write file %s: %w", entryPath, err)
-			}
-		}
+	if err := checkoutCommit(repo, oldHash, commitHash, "checkout", force); err != nil {
+		cmd.SilenceUsage = true
+		return err
 	}
 
 	return nil
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var symbolicRefMessage string
+var symbolicRefDeleteBool bool
+var symbolicRefQuietBool bool
+var symbolicRefShortBool bool
+
+var symbolicRefCmd = &cobra.Command{
+	Use:   "symbolic-ref [-m <reason>] <name> [<ref>]",
+	Short: "Read, modify and delete symbolic refs",
+	Long: `With one argument, print the ref the symbolic ref <name> (usually HEAD)
+points to, e.g. "refs/heads/master". With two arguments, point <name> at
+<ref>, which must be under refs/. With -d, delete the symbolic ref <name>.
+
+Unlike switch, this only changes the ref and leaves the index and working
+tree alone.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: symbolicRefCallback,
+}
+
+func init() {
+	symbolicRefCmd.Flags().StringVarP(&symbolicRefMessage, "message", "m", "", "Reason recorded in the reflog")
+	symbolicRefCmd.Flags().BoolVarP(&symbolicRefDeleteBool, "delete", "d", false, "Delete the symbolic ref")
+	symbolicRefCmd.Flags().BoolVarP(&symbolicRefQuietBool, "quiet", "q", false, "Do not print an error if <name> is not a symbolic ref")
+	symbolicRefCmd.Flags().BoolVar(&symbolicRefShortBool, "short", false, "Print the ref name without refs/heads/ or refs/tags/")
+	rootCmd.AddCommand(symbolicRefCmd)
+}
+
+func symbolicRefCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	name := args[0]
+	if err := repository.ValidateRefName(name); err != nil {
+		return err
+	}
+
+	if len(args) == 2 {
+		if symbolicRefDeleteBool {
+			return fmt.Errorf("-d takes only the name of the symbolic ref")
+		}
+		target := args[1]
+		if !strings.HasPrefix(target, "refs/") {
+			return fmt.Errorf("refusing to point %s outside of refs/", name)
+		}
+		tx := repo.Refs().Transaction()
+		tx.SetSymbolic(name, target, symbolicRefMessage)
+		if err := tx.Commit(reflogSignature()); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		return nil
+	}
+
+	ref, err := repo.Refs().Read(name)
+	if err != nil && !errors.Is(err, repository.ErrRefNotFound) {
+		return err
+	}
+	if !ref.IsSymbolic() {
+		cmd.SilenceUsage = true
+		if symbolicRefQuietBool {
+			cmd.SilenceErrors = true
+		}
+		return fmt.Errorf("ref %s is not a symbolic ref", name)
+	}
+
+	if symbolicRefDeleteBool {
+		if name == "HEAD" {
+			return fmt.Errorf("deleting HEAD is not allowed")
+		}
+		tx := repo.Refs().Transaction()
+		tx.Queue(repository.RefUpdate{Name: name, NewHash: repository.ZeroHash, NoDeref: true})
+		return tx.Commit(reflogSignature())
+	}
+
+	target := ref.Target
+	if symbolicRefShortBool {
+		target = shortRefName(target)
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), target)
+	return nil
+}
+
+// shortRefName strips the prefix a ref name can be abbreviated by.
+func shortRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/"} {
+		if short, ok := strings.CutPrefix(ref, prefix); ok {
+			return short
+		}
+	}
+	return ref
+}
@@ -0,0 +1,263 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/objects/tag"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagAnnotateBool bool
+	tagMessage      string
+	tagDeleteBool   bool
+	tagListBool     bool
+	tagForceBool    bool
+	tagShowBool     bool
+	tagLinesBool    bool
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag [<name> [<revision>]]",
+	Short: "Create, list, delete or show tags",
+	Long: `Manage tags in notgit.
+
+Without arguments, or with -l, this lists the existing tags. Patterns given
+to -l are shell globs, e.g. "notgit tag -l 'v1.*'".
+
+With a name, a lightweight tag pointing to HEAD (or <revision>) is created
+under refs/tags. With -a or -m, an annotated tag object recording the tagger
+and a message is stored and the ref points to it instead.
+
+With -d, deletes the named tags. With --show, prints the tag and the commit
+it points to.`,
+	RunE: tagCallback,
+}
+
+func init() {
+	tagCmd.Flags().BoolVarP(&tagAnnotateBool, "annotate", "a", false, "Create an annotated tag object")
+	tagCmd.Flags().StringVarP(&tagMessage, "message", "m", "", "Tag message (implies -a)")
+	tagCmd.Flags().BoolVarP(&tagDeleteBool, "delete", "d", false, "Delete the named tags")
+	tagCmd.Flags().BoolVarP(&tagListBool, "list", "l", false, "List tags, optionally matching the given patterns")
+	tagCmd.Flags().BoolVarP(&tagForceBool, "force", "f", false, "Replace an existing tag")
+	tagCmd.Flags().BoolVar(&tagShowBool, "show", false, "Show the named tag and the commit it points to")
+	tagCmd.Flags().BoolVarP(&tagLinesBool, "annotations", "n", false, "When listing, print the first line of each tag message")
+	rootCmd.AddCommand(tagCmd)
+}
+
+func tagCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	switch {
+	case tagDeleteBool:
+		if len(args) == 0 {
+			return fmt.Errorf("tag name required for -d")
+		}
+		for _, name := range args {
+			if err := deleteTag(cmd, repo, name); err != nil {
+				return err
+			}
+		}
+	case tagShowBool:
+		if len(args) != 1 {
+			return fmt.Errorf("--show takes exactly one tag name")
+		}
+		return showTag(cmd, repo, args[0])
+	case tagListBool || len(args) == 0:
+		return listTags(cmd, repo, args)
+	default:
+		if len(args) > 2 {
+			return fmt.Errorf("too many arguments")
+		}
+		target := "HEAD"
+		if len(args) == 2 {
+			target = args[1]
+		}
+		annotated := tagAnnotateBool || cmd.Flags().Changed("message")
+		return createTag(cmd, repo, args[0], target, annotated)
+	}
+
+	return nil
+}
+
+// readTag returns the object a tag ref points to.
+func readTag(repo *repository.Repository, name string) (string, error) {
+	hash, err := repo.Refs().Resolve("refs/tags/" + name)
+	if errors.Is(err, repository.ErrRefNotFound) {
+		return "", fmt.Errorf("tag '%s' not found", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read tag '%s': %w", name, err)
+	}
+	return hash, nil
+}
+
+func validateTagName(name string) error {
+	if strings.HasPrefix(name, "-") || repository.ValidateRefName("refs/tags/"+name) != nil {
+		return fmt.Errorf("'%s' is not a valid tag name", name)
+	}
+	return nil
+}
+
+func createTag(cmd *cobra.Command, repo *repository.Repository, name, target string, annotated bool) error {
+	if err := validateTagName(name); err != nil {
+		return err
+	}
+
+	refName := "refs/tags/" + name
+	oldHash := repository.ZeroHash
+	if tagForceBool {
+		oldHash = ""
+	} else if repo.Refs().Exists(refName) {
+		return fmt.Errorf("tag '%s' already exists", name)
+	}
+
+	objectHash, err := repo.ResolveRevision(target)
+	if err != nil {
+		return err
+	}
+
+	refHash := objectHash
+	if annotated {
+		if tagMessage == "" {
+			return fmt.Errorf("an annotated tag needs a message; use -m <message>")
+		}
+
+		taggerName, taggerEmail, err := getUserIdentity()
+		if err != nil {
+			return fmt.Errorf("cannot create annotated tag: %w", err)
+		}
+
+		objectType, err := repo.ObjectType(objectHash)
+		if err != nil {
+			return fmt.Errorf("failed to read object %s: %w", objectHash, err)
+		}
+
+		tagger := commit.Signature{Name: taggerName, Email: taggerEmail, Time: time.Now()}
+		tagObj := tag.NewTag(objectHash, objectType, name, tagger, tagMessage)
+		refHash, err = repo.StoreObject(tagObj)
+		if err != nil {
+			return fmt.Errorf("failed to write tag object: %w", err)
+		}
+	}
+
+	tx := repo.Refs().Transaction()
+	tx.Update(refName, refHash, oldHash, "tag: tagging "+objectHash)
+	if err := tx.Commit(reflogSignature()); err != nil {
+		return fmt.Errorf("failed to write tag: %w", err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Created tag '%s' at %s\n", name, objectHash[:7])
+	return nil
+}
+
+func deleteTag(cmd *cobra.Command, repo *repository.Repository, name string) error {
+	if err := validateTagName(name); err != nil {
+		return err
+	}
+
+	hash, err := readTag(repo, name)
+	if err != nil {
+		return err
+	}
+
+	tx := repo.Refs().Transaction()
+	tx.Delete("refs/tags/"+name, hash, "")
+	if err := tx.Commit(reflogSignature()); err != nil {
+		return fmt.Errorf("failed to delete tag '%s': %w", name, err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Deleted tag '%s' (was %s)\n", name, hash[:min(len(hash), 7)])
+	return nil
+}
+
+func listTags(cmd *cobra.Command, repo *repository.Repository, patterns []string) error {
+	refs, err := repo.ListRefs()
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range sortedKeys(refs) {
+		name, ok := strings.CutPrefix(ref, "refs/tags/")
+		if !ok || !matchesAnyPattern(name, patterns) {
+			continue
+		}
+
+		if !tagLinesBool {
+			fmt.Fprintln(cmd.OutOrStdout(), name)
+			continue
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %s\n", name, tagSubject(repo, refs[ref]))
+	}
+	return nil
+}
+
+func matchesAnyPattern(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tagSubject returns the first line of a tag's message, or of the commit
+// message for lightweight tags.
+func tagSubject(repo *repository.Repository, hash string) string {
+	if t, err := repo.RetrieveTag(hash); err == nil {
+		return strings.SplitN(t.Message, "\n", 2)[0]
+	}
+	if c, err := repo.RetrieveCommit(hash); err == nil {
+		return strings.SplitN(c.Message, "\n", 2)[0]
+	}
+	return ""
+}
+
+func showTag(cmd *cobra.Command, repo *repository.Repository, name string) error {
+	if err := validateTagName(name); err != nil {
+		return err
+	}
+
+	hash, err := readTag(repo, name)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if t, err := repo.RetrieveTag(hash); err == nil {
+		fmt.Fprintf(out, "tag %s\n", t.Name)
+		fmt.Fprintf(out, "Tagger: %s <%s>\n", t.Tagger.Name, t.Tagger.Email)
+		fmt.Fprintf(out, "Date:   %s\n", t.Tagger.Time.Format("Mon Jan 2 15:04:05 2006 -0700"))
+		fmt.Fprintf(out, "\n%s\n\n", t.Message)
+	}
+
+	target, err := repo.PeelTag(hash)
+	if err != nil {
+		return err
+	}
+	c, err := repo.RetrieveCommit(target)
+	if err != nil {
+		objectType, _ := repo.ObjectType(target)
+		fmt.Fprintf(out, "%s %s\n", objectType, target)
+		return nil
+	}
+
+	fmt.Fprintf(out, "commit %s\n", target)
+	fmt.Fprintf(out, "Author: %s <%s>\n", c.Author.Name, c.Author.Email)
+	fmt.Fprintf(out, "Date:   %s\n", c.Author.Time.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	fmt.Fprintf(out, "\n    %s\n", c.Message)
+	return nil
+}
@@ -0,0 +1,177 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/spf13/cobra"
+)
+
+var updateRefMessage string
+var updateRefDeleteBool bool
+var updateRefNoDerefBool bool
+var updateRefStdinBool bool
+
+var updateRefCmd = &cobra.Command{
+	Use:   "update-ref [-m <reason>] [--no-deref] (<ref> <new-value> [<old-value>] | -d <ref> [<old-value>] | --stdin)",
+	Short: "Update the object name stored in a ref safely",
+	Long: `Point <ref> at <new-value>, or delete it with -d.
+
+If <old-value> is given, the ref is only changed if it still points to
+<old-value>; an empty <old-value> or 40 zeros means the ref must not exist
+yet. Updating a symbolic ref such as HEAD updates the ref it points to,
+unless --no-deref is given. Each update is recorded in the reflog with the
+reason given by -m.
+
+With --stdin, read one command per line and apply all of them in a single
+transaction: either every ref is updated or none is.
+
+  update <ref> <new-value> [<old-value>]
+  create <ref> <new-value>
+  delete <ref> [<old-value>]
+  verify <ref> [<old-value>]
+
+verify only checks that <ref> has <old-value>, or does not exist if it is
+omitted.`,
+	RunE: updateRefCallback,
+}
+
+func init() {
+	updateRefCmd.Flags().StringVarP(&updateRefMessage, "message", "m", "", "Reason recorded in the reflog")
+	updateRefCmd.Flags().BoolVarP(&updateRefDeleteBool, "delete", "d", false, "Delete the ref")
+	updateRefCmd.Flags().BoolVar(&updateRefNoDerefBool, "no-deref", false, "Update a symbolic ref itself instead of the ref it points to")
+	updateRefCmd.Flags().BoolVar(&updateRefStdinBool, "stdin", false, "Read updates from standard input and apply them atomically")
+	rootCmd.AddCommand(updateRefCmd)
+}
+
+func updateRefCallback(cmd *cobra.Command, args []string) error {
+	repo, err := repository.OpenRepository(".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	tx := repo.Refs().Transaction()
+	switch {
+	case updateRefStdinBool:
+		if len(args) > 0 || updateRefDeleteBool {
+			return fmt.Errorf("--stdin takes no other arguments")
+		}
+		if err := queueStdinRefUpdates(cmd, repo, tx); err != nil {
+			return err
+		}
+	case updateRefDeleteBool:
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("usage: notgit update-ref -d <ref> [<old-value>]")
+		}
+		oldHash := ""
+		if len(args) == 2 {
+			if oldHash, err = resolveOldValue(repo, args[1]); err != nil {
+				return err
+			}
+		}
+		queueRefUpdate(tx, args[0], repository.ZeroHash, oldHash)
+	default:
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("usage: notgit update-ref <ref> <new-value> [<old-value>]")
+		}
+		newHash, err := repo.ResolveRevision(args[1])
+		if err != nil {
+			return err
+		}
+		oldHash := ""
+		if len(args) == 3 {
+			if oldHash, err = resolveOldValue(repo, args[2]); err != nil {
+				return err
+			}
+		}
+		queueRefUpdate(tx, args[0], newHash, oldHash)
+	}
+
+	if err := tx.Commit(reflogSignature()); err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	return nil
+}
+
+func queueRefUpdate(tx *repository.RefTransaction, ref, newHash, oldHash string) {
+	tx.Queue(repository.RefUpdate{
+		Name:    ref,
+		NewHash: newHash,
+		OldHash: oldHash,
+		NoDeref: updateRefNoDerefBool,
+		Message: updateRefMessage,
+	})
+}
+
+// resolveOldValue turns an <old-value> argument into the expected hash,
+// where an empty value or the zero hash means the ref must not exist.
+func resolveOldValue(repo *repository.Repository, value string) (string, error) {
+	if value == "" || value == repository.ZeroHash {
+		return repository.ZeroHash, nil
+	}
+	return repo.ResolveRevision(value)
+}
+
+func queueStdinRefUpdates(cmd *cobra.Command, repo *repository.Repository, tx *repository.RefTransaction) error {
+	scanner := bufio.NewScanner(cmd.InOrStdin())
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		command, args := fields[0], fields[1:]
+
+		var valid bool
+		switch command {
+		case "update":
+			valid = len(args) == 2 || len(args) == 3
+		case "create":
+			valid = len(args) == 2
+		case "delete", "verify":
+			valid = len(args) == 1 || len(args) == 2
+		default:
+			return fmt.Errorf("line %d: unknown command '%s'", lineNo, command)
+		}
+		if !valid {
+			return fmt.Errorf("line %d: wrong number of arguments for %s", lineNo, command)
+		}
+
+		ref := args[0]
+		newHash := repository.ZeroHash
+		if command == "update" || command == "create" {
+			hash, err := repo.ResolveRevision(args[1])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			newHash = hash
+		}
+
+		oldHash := ""
+		oldArgs := args[1:]
+		if command == "update" {
+			oldArgs = args[2:]
+		}
+		switch {
+		case command == "create":
+			oldHash = repository.ZeroHash
+		case len(oldArgs) == 1:
+			hash, err := resolveOldValue(repo, oldArgs[0])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			oldHash = hash
+		case command == "verify":
+			oldHash = repository.ZeroHash
+		}
+
+		if command == "verify" {
+			tx.Verify(ref, oldHash)
+			continue
+		}
+		queueRefUpdate(tx, ref, newHash, oldHash)
+	}
+	return scanner.Err()
+}
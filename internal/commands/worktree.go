@@ -0,0 +1,309 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/objects/blob"
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+	"github.com/Gr1shma/notgit/internal/repository"
+)
+
+// writeWorkingFile writes content to a repository-relative path, creating
+// any missing parent directories. Executable files get mode 0755 and for
+// symlinks the content is the link target.
+func writeWorkingFile(repo *repository.Repository, relPath string, content []byte, entryType tree.EntryType) error {
+	fullPath := filepath.Join(repo.BaseDir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create parent directory for %s: %w", relPath, err)
+	}
+
+	// Replace symlinks instead of writing through them, and let a file take
+	// the place of a symlink
+	if info, err := os.Lstat(fullPath); err == nil && (info.Mode()&os.ModeSymlink != 0 || entryType == tree.EntryTypeSymlink) {
+		if err := os.Remove(fullPath); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", relPath, err)
+		}
+	}
+
+	if entryType == tree.EntryTypeSymlink {
+		if err := os.Symlink(string(content), fullPath); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %w", relPath, err)
+		}
+		return nil
+	}
+
+	perm := os.FileMode(0o644)
+	if entryType == tree.EntryTypeExecutable {
+		perm = 0o755
+	}
+	if err := os.WriteFile(fullPath, content, perm); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", relPath, err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(fullPath, perm); err != nil {
+		return fmt.Errorf("failed to set mode of %s: %w", relPath, err)
+	}
+	return nil
+}
+
+// setWorkingFileMode switches a working file between regular and executable.
+func setWorkingFileMode(repo *repository.Repository, relPath string, entryType tree.EntryType) error {
+	perm := os.FileMode(0o644)
+	if entryType == tree.EntryTypeExecutable {
+		perm = 0o755
+	}
+	fullPath := filepath.Join(repo.BaseDir, filepath.FromSlash(relPath))
+	if err := os.Chmod(fullPath, perm); err != nil {
+		return fmt.Errorf("failed to set mode of %s: %w", relPath, err)
+	}
+	return nil
+}
+
+// fileEntryType returns the tree entry type for a file mode as reported by
+// os.Lstat.
+func fileEntryType(mode os.FileMode) tree.EntryType {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return tree.EntryTypeSymlink
+	case mode&0o111 != 0:
+		return tree.EntryTypeExecutable
+	default:
+		return tree.EntryTypeBlob
+	}
+}
+
+// readWorkingContent returns what Git stores for a file in the working
+// tree: its content, or the link target for a symlink.
+func readWorkingContent(fullPath string, info os.FileInfo) ([]byte, error) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(target), nil
+	}
+	return os.ReadFile(fullPath)
+}
+
+// stageFile stores the content of the working file at fullPath as a blob
+// and records it in the index under relPath.
+func stageFile(repo *repository.Repository, index *repository.Index, relPath, fullPath string, info os.FileInfo) error {
+	data, err := readWorkingContent(fullPath, info)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", fullPath, err)
+	}
+
+	b, err := blob.NewBlob(data)
+	if err != nil {
+		return fmt.Errorf("failed to create blob for %s: %w", fullPath, err)
+	}
+
+	hash, err := repo.StoreObject(b)
+	if err != nil {
+		return fmt.Errorf("failed to store object for %s: %w", fullPath, err)
+	}
+
+	index.AddEntryWithType(relPath, hash, fileEntryType(info.Mode()))
+	index.SetStat(relPath, repository.StatFromFileInfo(info))
+	return nil
+}
+
+// sameEntry reports whether two optional index entries have the same content
+// and mode.
+func sameEntry(a repository.IndexEntry, inA bool, b repository.IndexEntry, inB bool) bool {
+	return inA == inB && a.Hash == b.Hash && a.Type == b.Type
+}
+
+// removeWorkingFile deletes a repository-relative path and then any parent
+// directories that were left empty.
+func removeWorkingFile(repo *repository.Repository, relPath string) error {
+	fullPath := filepath.Join(repo.BaseDir, filepath.FromSlash(relPath))
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", relPath, err)
+	}
+	removeEmptyParents(repo, fullPath)
+	return nil
+}
+
+// removeEmptyParents deletes the directories above fullPath that are empty,
+// up to the repository root.
+func removeEmptyParents(repo *repository.Repository, fullPath string) {
+	for dir := filepath.Dir(fullPath); dir != repo.BaseDir && dir != "."; dir = filepath.Dir(dir) {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			break
+		}
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+}
+
+// commitIndex returns an index matching the tree of a commit. An empty commit
+// hash yields an empty index.
+func commitIndex(repo *repository.Repository, commitHash string) (*repository.Index, error) {
+	if commitHash == "" {
+		return repository.NewIndex(), nil
+	}
+
+	c, err := repo.RetrieveCommit(commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit %s: %w", commitHash, err)
+	}
+
+	return repo.ReadTree(c.TreeHash)
+}
+
+// checkoutCommit moves the working tree and index from the tree of fromHash
+// to the tree of toHash. Paths that are the same in both trees keep any local
+// changes. Unless force is set, nothing is touched when a path that differs
+// between the trees has uncommitted changes or would overwrite an untracked
+// file; the error lists those paths. With force, local changes are discarded.
+//
+// The index is rebuilt from the target tree, with carried over changes and
+// newly staged files applied on top, so that it agrees with the new HEAD.
+func checkoutCommit(repo *repository.Repository, fromHash, toHash, operation string, force bool) error {
+	index, err := repo.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Rollback()
+	return checkoutLockedIndex(repo, index, fromHash, toHash, operation, force)
+}
+
+// checkoutLockedIndex is checkoutCommit for a caller already holding the
+// index lock. The index is committed on success.
+func checkoutLockedIndex(repo *repository.Repository, index *repository.LockedIndex, fromHash, toHash, operation string, force bool) error {
+	fromIndex, err := commitIndex(repo, fromHash)
+	if err != nil {
+		return err
+	}
+	newIndex, err := commitIndex(repo, toHash)
+	if err != nil {
+		return err
+	}
+
+	if len(index.Unmerged) > 0 && !force {
+		return fmt.Errorf("you need to resolve your current index first:\n\t%s", strings.Join(index.ConflictedPaths(), "\n\t"))
+	}
+	workingFiles, err := getWorkingDirectoryFiles(repo)
+	if err != nil {
+		return fmt.Errorf("failed to read working tree: %w", err)
+	}
+
+	allPaths := make(map[string]bool)
+	for path := range fromIndex.Entries {
+		allPaths[path] = true
+	}
+	for path := range newIndex.Entries {
+		allPaths[path] = true
+	}
+	for path := range index.Entries {
+		allPaths[path] = true
+	}
+
+	var updates, carried, modified, untracked []string
+	for _, path := range sortedKeys(allPaths) {
+		fromEntry, inFrom := fromIndex.Entries[path]
+		toEntry, inTo := newIndex.Entries[path]
+		indexEntry, inIndex := index.Entries[path]
+		working, inWorking := workingFiles[path]
+		workingEntry := repository.IndexEntry{Hash: working.Hash, Type: working.Type}
+
+		if !inFrom && !inTo {
+			// Staged new files unknown to both commits stay staged
+			carried = append(carried, path)
+			continue
+		}
+
+		if force {
+			updates = append(updates, path)
+			continue
+		}
+
+		if sameEntry(fromEntry, inFrom, toEntry, inTo) {
+			// Unchanged between the two commits, local changes carry over
+			carried = append(carried, path)
+			continue
+		}
+
+		// Already matching the target, e.g. the same change made by hand
+		if sameEntry(indexEntry, inIndex, toEntry, inTo) && sameEntry(workingEntry, inWorking, toEntry, inTo) {
+			continue
+		}
+
+		staged := !sameEntry(indexEntry, inIndex, fromEntry, inFrom)
+		unstaged := inIndex && !sameEntry(workingEntry, inWorking, indexEntry, inIndex)
+		switch {
+		case !inIndex && !inFrom && inWorking:
+			untracked = append(untracked, path)
+		case staged || unstaged:
+			modified = append(modified, path)
+		default:
+			updates = append(updates, path)
+		}
+	}
+
+	if len(modified) > 0 || len(untracked) > 0 {
+		return overwriteError(operation, modified, untracked)
+	}
+
+	// Removals go first so that a file can take the place of a directory
+	// the checkout empties
+	for _, path := range updates {
+		if _, inTo := newIndex.Entries[path]; !inTo {
+			if err := removeWorkingFile(repo, path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range updates {
+		toEntry, inTo := newIndex.Entries[path]
+		if !inTo {
+			continue
+		}
+
+		b, err := repo.RetrieveBlob(toEntry.Hash)
+		if err != nil {
+			return fmt.Errorf("failed to load blob %s: %w", toEntry.Hash, err)
+		}
+		if err := writeWorkingFile(repo, path, b.Content, toEntry.Type); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range carried {
+		if entry, ok := index.Entries[path]; ok {
+			newIndex.Entries[path] = entry
+		} else {
+			delete(newIndex.Entries, path)
+		}
+	}
+
+	index.Index = newIndex
+	if err := index.Commit(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	return nil
+}
+
+func overwriteError(operation string, modified, untracked []string) error {
+	var sb strings.Builder
+	if len(modified) > 0 {
+		fmt.Fprintf(&sb, "your local changes to the following files would be overwritten by %s:\n", operation)
+		for _, path := range modified {
+			fmt.Fprintf(&sb, "\t%s\n", path)
+		}
+	}
+	if len(untracked) > 0 {
+		fmt.Fprintf(&sb, "the following untracked working tree files would be overwritten by %s:\n", operation)
+		for _, path := range untracked {
+			fmt.Fprintf(&sb, "\t%s\n", path)
+		}
+	}
+	sb.WriteString("Please commit your changes or remove them, or use --force to discard them.")
+	return fmt.Errorf("%s", sb.String())
+}
@@ -0,0 +1,168 @@
+package diff
+
+import (
+	"bytes"
+	"slices"
+)
+
+type OpKind int
+
+const (
+	OpEqual OpKind = iota
+	OpInsert
+	OpDelete
+)
+
+// Edit is one step of a line-level edit script. OldIndex is the line in the
+// old input (unset for inserts) and NewIndex the line in the new input
+// (unset for deletes).
+type Edit struct {
+	Kind     OpKind
+	OldIndex int
+	NewIndex int
+}
+
+// SplitLines splits data into lines, keeping the trailing newline on each.
+// The last line has no newline if the data does not end with one.
+func SplitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// Lines computes the shortest edit script turning a into b using the
+// linear-space variant of Myers' O(ND) algorithm, which splits the problem at
+// the middle snake of an optimal path instead of keeping every round of the
+// search. Within each run of changes, deletions come before insertions.
+func Lines(a, b []string) []Edit {
+	s := &script{a: a, b: b}
+	s.compare(0, len(a), 0, len(b))
+	groupChanges(s.edits)
+	return s.edits
+}
+
+type script struct {
+	a, b  []string
+	edits []Edit
+}
+
+// compare appends the edits turning a[aLo:aHi] into b[bLo:bHi].
+func (s *script) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && s.a[aLo] == s.b[bLo] {
+		s.edits = append(s.edits, Edit{Kind: OpEqual, OldIndex: aLo, NewIndex: bLo})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && s.a[aHi-suffix-1] == s.b[bHi-suffix-1] {
+		suffix++
+	}
+	aEnd, bEnd := aHi-suffix, bHi-suffix
+
+	switch {
+	case aLo == aEnd:
+		for j := bLo; j < bEnd; j++ {
+			s.edits = append(s.edits, Edit{Kind: OpInsert, OldIndex: -1, NewIndex: j})
+		}
+	case bLo == bEnd:
+		for i := aLo; i < aEnd; i++ {
+			s.edits = append(s.edits, Edit{Kind: OpDelete, OldIndex: i, NewIndex: -1})
+		}
+	default:
+		// Both sides are non-empty and differ at both ends, so the edit
+		// distance is at least 2 and both halves are strictly smaller
+		x, y := s.middleSnake(aLo, aEnd, bLo, bEnd)
+		s.compare(aLo, x, bLo, y)
+		s.compare(x, aEnd, y, bEnd)
+	}
+
+	for i := 0; i < suffix; i++ {
+		s.edits = append(s.edits, Edit{Kind: OpEqual, OldIndex: aEnd + i, NewIndex: bEnd + i})
+	}
+}
+
+// middleSnake runs the forward and reverse searches at the same time until
+// they overlap and returns a point on an optimal path through the middle.
+func (s *script) middleSnake(aLo, aHi, bLo, bHi int) (int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	// vf holds the furthest x reached on each forward diagonal k = x - y,
+	// vb the same for the reverse search on the reversed inputs
+	vf := make([]int, 2*maxD+3)
+	vb := make([]int, 2*maxD+3)
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && s.a[aLo+x] == s.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+
+			// With an odd delta the paths meet after a forward step
+			j := delta - k
+			if delta%2 != 0 && j >= -(d-1) && j <= d-1 && x+vb[offset+j] >= n {
+				return aLo + x, bLo + y
+			}
+		}
+
+		for j := -d; j <= d; j += 2 {
+			var x int
+			if j == -d || (j != d && vb[offset+j-1] < vb[offset+j+1]) {
+				x = vb[offset+j+1]
+			} else {
+				x = vb[offset+j-1] + 1
+			}
+			y := x - j
+			for x < n && y < m && s.a[aHi-1-x] == s.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[offset+j] = x
+
+			k := delta - j
+			if delta%2 == 0 && k >= -d && k <= d && vf[offset+k]+x >= n {
+				return aHi - x, bHi - y
+			}
+		}
+	}
+
+	// Unreachable: the searches meet by round ceil((n+m)/2)
+	return aHi, bHi
+}
+
+// groupChanges reorders each run of changes between equal lines so that its
+// deletions come before its insertions.
+func groupChanges(edits []Edit) {
+	for i := 0; i < len(edits); {
+		if edits[i].Kind == OpEqual {
+			i++
+			continue
+		}
+		end := i
+		for end < len(edits) && edits[end].Kind != OpEqual {
+			end++
+		}
+		slices.SortStableFunc(edits[i:end], func(x, y Edit) int {
+			return int(y.Kind) - int(x.Kind)
+		})
+		i = end
+	}
+}
@@ -0,0 +1,173 @@
+package diff_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gr1shma/notgit/internal/diff"
+	"github.com/stretchr/testify/require"
+)
+
+// applyEdits rebuilds the new input from the old one using an edit script
+func applyEdits(a, b []string, edits []diff.Edit) []string {
+	var result []string
+	for _, edit := range edits {
+		switch edit.Kind {
+		case diff.OpEqual:
+			result = append(result, a[edit.OldIndex])
+		case diff.OpInsert:
+			result = append(result, b[edit.NewIndex])
+		}
+	}
+	return result
+}
+
+func TestSplitLines(t *testing.T) {
+	require.Equal(t, []string{"a\n", "b\n"}, diff.SplitLines([]byte("a\nb\n")))
+	require.Equal(t, []string{"a\n", "b"}, diff.SplitLines([]byte("a\nb")))
+	require.Empty(t, diff.SplitLines(nil))
+}
+
+func TestLinesProducesMinimalScript(t *testing.T) {
+	a := strings.Split("A B C A B B A", " ")
+	b := strings.Split("C B A B A C", " ")
+
+	edits := diff.Lines(a, b)
+	require.Equal(t, b, applyEdits(a, b, edits))
+
+	changes := 0
+	for _, edit := range edits {
+		if edit.Kind != diff.OpEqual {
+			changes++
+		}
+	}
+	// The classic example from Myers' paper has an edit distance of 5
+	require.Equal(t, 5, changes)
+}
+
+func TestLinesEdgeCases(t *testing.T) {
+	require.Empty(t, diff.Lines(nil, nil))
+
+	onlyInserts := diff.Lines(nil, []string{"x", "y"})
+	require.Len(t, onlyInserts, 2)
+	require.Equal(t, diff.OpInsert, onlyInserts[0].Kind)
+
+	onlyDeletes := diff.Lines([]string{"x", "y"}, nil)
+	require.Len(t, onlyDeletes, 2)
+	require.Equal(t, diff.OpDelete, onlyDeletes[1].Kind)
+
+	same := []string{"x", "y", "z"}
+	for _, edit := range diff.Lines(same, same) {
+		require.Equal(t, diff.OpEqual, edit.Kind)
+	}
+}
+
+func unifiedDiff(t *testing.T, a, b string, context int) string {
+	t.Helper()
+	oldLines, newLines := diff.SplitLines([]byte(a)), diff.SplitLines([]byte(b))
+	hunks := diff.Hunks(oldLines, newLines, diff.Lines(oldLines, newLines), context)
+
+	var sb strings.Builder
+	require.NoError(t, diff.WriteHunks(&sb, hunks))
+	return sb.String()
+}
+
+func TestHunks(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\neleven\n"
+
+	require.Equal(t, "@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n"+
+		"@@ -8,3 +8,4 @@\n 8\n 9\n 10\n+eleven\n", unifiedDiff(t, a, b, 3))
+
+	// Wide enough context merges both changes into one hunk
+	require.Equal(t, 1, strings.Count(unifiedDiff(t, a, b, 4), "@@ -"))
+
+	require.Equal(t, "@@ -3 +3 @@\n-3\n+three\n@@ -10,0 +11 @@\n+eleven\n", unifiedDiff(t, a, b, 0))
+	require.Empty(t, unifiedDiff(t, a, a, 3))
+}
+
+func TestHunksNewAndMissingNewline(t *testing.T) {
+	require.Equal(t, "@@ -0,0 +1,2 @@\n+a\n+b\n", unifiedDiff(t, "", "a\nb\n", 3))
+	require.Equal(t, "@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n", unifiedDiff(t, "a", "a\n", 3))
+}
+
+func TestCountChangesAndBinary(t *testing.T) {
+	oldLines, newLines := diff.SplitLines([]byte("a\nb\nc\n")), diff.SplitLines([]byte("a\nB\nc\nd\n"))
+	insertions, deletions := diff.CountChanges(diff.Lines(oldLines, newLines))
+	require.Equal(t, 2, insertions)
+	require.Equal(t, 1, deletions)
+
+	require.True(t, diff.IsBinary([]byte("PNG\x00\x01")))
+	require.False(t, diff.IsBinary([]byte("plain text\n")))
+}
+
+// editDistance is the number of inserted and deleted lines in a shortest
+// edit script, computed from the longest common subsequence
+func editDistance(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	return len(a) + len(b) - 2*lcs[0][0]
+}
+
+func TestLinesMatchesShortestEditScript(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	randomLines := func() []string {
+		var lines []string
+		for range rng.IntN(12) {
+			lines = append(lines, string(rune('a'+rng.IntN(3))))
+		}
+		return lines
+	}
+
+	for range 500 {
+		a, b := randomLines(), randomLines()
+		edits := diff.Lines(a, b)
+		require.Equal(t, b, applyEdits(a, b, edits), "a=%v b=%v", a, b)
+
+		insertions, deletions := diff.CountChanges(edits)
+		require.Equal(t, editDistance(a, b), insertions+deletions, "a=%v b=%v", a, b)
+
+		// Changes between two equal lines list deletions first
+		for i := 1; i < len(edits); i++ {
+			require.False(t, edits[i-1].Kind == diff.OpInsert && edits[i].Kind == diff.OpDelete, "a=%v b=%v", a, b)
+		}
+	}
+}
+
+func TestLinesLargeRewrite(t *testing.T) {
+	// Every line changes, the worst case for the edit distance
+	a := make([]string, 4000)
+	b := make([]string, 4000)
+	for i := range a {
+		a[i] = fmt.Sprintf("old %d\n", i)
+		b[i] = fmt.Sprintf("new %d\n", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	edits := diff.Lines(a, b)
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	insertions, deletions := diff.CountChanges(edits)
+	require.Equal(t, 4000, insertions)
+	require.Equal(t, 4000, deletions)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(64<<20))
+	require.Less(t, elapsed, 10*time.Second)
+}
@@ -0,0 +1,112 @@
+package diff
+
+import "strings"
+
+type MergeResult struct {
+	Content   []byte
+	Conflicts int
+}
+
+// Merge3 performs a line-level three-way merge of ours and theirs against
+// their common ancestor base. Regions changed on only one side are taken from
+// that side; regions changed differently on both sides are written between
+// <<<<<<< / ======= / >>>>>>> markers labelled with oursLabel and theirsLabel.
+func Merge3(base, ours, theirs []byte, oursLabel, theirsLabel string) MergeResult {
+	baseLines := SplitLines(base)
+	ourLines := SplitLines(ours)
+	theirLines := SplitLines(theirs)
+
+	ourMatch := matchLines(baseLines, ourLines)
+	theirMatch := matchLines(baseLines, theirLines)
+
+	var out strings.Builder
+	result := MergeResult{}
+	b, o, t := 0, 0, 0
+
+	for {
+		// Find the next base line kept unchanged by both sides
+		sync := b
+		for sync < len(baseLines) && (ourMatch[sync] == -1 || theirMatch[sync] == -1) {
+			sync++
+		}
+
+		nextO, nextT := len(ourLines), len(theirLines)
+		if sync < len(baseLines) {
+			nextO, nextT = ourMatch[sync], theirMatch[sync]
+		}
+
+		if sync == b && nextO == o && nextT == t {
+			if sync == len(baseLines) {
+				break
+			}
+			out.WriteString(baseLines[b])
+			b, o, t = b+1, o+1, t+1
+			continue
+		}
+
+		baseChunk := baseLines[b:sync]
+		ourChunk := ourLines[o:nextO]
+		theirChunk := theirLines[t:nextT]
+
+		switch {
+		case equalLines(ourChunk, baseChunk):
+			writeLines(&out, theirChunk)
+		case equalLines(theirChunk, baseChunk), equalLines(ourChunk, theirChunk):
+			writeLines(&out, ourChunk)
+		default:
+			result.Conflicts++
+			out.WriteString("<<<<<<< " + oursLabel + "\n")
+			writeConflictSide(&out, ourChunk)
+			out.WriteString("=======\n")
+			writeConflictSide(&out, theirChunk)
+			out.WriteString(">>>>>>> " + theirsLabel + "\n")
+		}
+
+		b, o, t = sync, nextO, nextT
+	}
+
+	result.Content = []byte(out.String())
+	return result
+}
+
+// matchLines maps every line of base to the line of other it is kept as, or
+// to -1 if the line was deleted.
+func matchLines(base, other []string) []int {
+	match := make([]int, len(base))
+	for i := range match {
+		match[i] = -1
+	}
+	for _, edit := range Lines(base, other) {
+		if edit.Kind == OpEqual {
+			match[edit.OldIndex] = edit.NewIndex
+		}
+	}
+	return match
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
+
+// writeConflictSide makes sure a marker always starts on its own line, even
+// when the side ends without a trailing newline.
+func writeConflictSide(out *strings.Builder, lines []string) {
+	writeLines(out, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		out.WriteString("\n")
+	}
+}
@@ -0,0 +1,43 @@
+package diff_test
+
+import (
+	"testing"
+
+	"github.com/Gr1shma/notgit/internal/diff"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge3CombinesIndependentChanges(t *testing.T) {
+	base := []byte("one\ntwo\nthree\nfour\nfive\n")
+	ours := []byte("ONE\ntwo\nthree\nfour\nfive\n")
+	theirs := []byte("one\ntwo\nthree\nfour\nFIVE\nsix\n")
+
+	result := diff.Merge3(base, ours, theirs, "HEAD", "topic")
+	require.Zero(t, result.Conflicts)
+	require.Equal(t, "ONE\ntwo\nthree\nfour\nFIVE\nsix\n", string(result.Content))
+}
+
+func TestMerge3IdenticalChangesAreNotConflicts(t *testing.T) {
+	base := []byte("a\nb\nc\n")
+	changed := []byte("a\nB\nc\n")
+
+	result := diff.Merge3(base, changed, changed, "HEAD", "topic")
+	require.Zero(t, result.Conflicts)
+	require.Equal(t, string(changed), string(result.Content))
+}
+
+func TestMerge3WritesConflictMarkers(t *testing.T) {
+	base := []byte("a\nb\nc\n")
+	ours := []byte("a\nours\nc\n")
+	theirs := []byte("a\ntheirs\nc\n")
+
+	result := diff.Merge3(base, ours, theirs, "HEAD", "topic")
+	require.Equal(t, 1, result.Conflicts)
+	require.Equal(t, "a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\nc\n", string(result.Content))
+}
+
+func TestMerge3ConflictWithoutTrailingNewline(t *testing.T) {
+	result := diff.Merge3(nil, []byte("ours"), []byte("theirs"), "HEAD", "topic")
+	require.Equal(t, 1, result.Conflicts)
+	require.Equal(t, "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\n", string(result.Content))
+}
@@ -0,0 +1,152 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Hunk is one block of a unified diff. Lines carry their " ", "-" or "+"
+// prefix and keep the newline of the line they came from.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []string
+}
+
+// Hunks groups an edit script of a into b into unified diff hunks with the
+// given number of context lines around each change.
+func Hunks(a, b []string, edits []Edit, context int) []Hunk {
+	if context < 0 {
+		context = 0
+	}
+
+	var hunks []Hunk
+	i := 0
+	for i < len(edits) {
+		// Skip ahead to the next change
+		for i < len(edits) && edits[i].Kind == OpEqual {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		start := max(i-context, 0)
+
+		// Extend the hunk while the gap to the next change is small enough
+		// for their context lines to touch
+		end := i
+		for end < len(edits) {
+			if edits[end].Kind != OpEqual {
+				end++
+				continue
+			}
+			gap := end
+			for gap < len(edits) && edits[gap].Kind == OpEqual {
+				gap++
+			}
+			if gap == len(edits) || gap-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end = gap
+		}
+
+		hunks = append(hunks, buildHunk(a, b, edits, start, end))
+		i = end
+	}
+
+	return hunks
+}
+
+func buildHunk(a, b []string, edits []Edit, start, end int) Hunk {
+	var h Hunk
+
+	// Lines consumed before the hunk give its starting positions
+	oldPos, newPos := 0, 0
+	for _, edit := range edits[:start] {
+		if edit.Kind != OpInsert {
+			oldPos++
+		}
+		if edit.Kind != OpDelete {
+			newPos++
+		}
+	}
+
+	for _, edit := range edits[start:end] {
+		switch edit.Kind {
+		case OpEqual:
+			h.Lines = append(h.Lines, " "+a[edit.OldIndex])
+			h.OldLines++
+			h.NewLines++
+		case OpDelete:
+			h.Lines = append(h.Lines, "-"+a[edit.OldIndex])
+			h.OldLines++
+		case OpInsert:
+			h.Lines = append(h.Lines, "+"+b[edit.NewIndex])
+			h.NewLines++
+		}
+	}
+
+	h.OldStart, h.NewStart = oldPos, newPos
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+	return h
+}
+
+// Header returns the "@@ -l,s +l,s @@" line of the hunk without a newline.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// WriteHunks writes hunks in unified format, marking lines that lack a
+// trailing newline the way Git does.
+func WriteHunks(w io.Writer, hunks []Hunk) error {
+	var sb strings.Builder
+	for _, h := range hunks {
+		sb.WriteString(h.Header() + "\n")
+		for _, line := range h.Lines {
+			sb.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// CountChanges returns the number of inserted and deleted lines in an edit
+// script.
+func CountChanges(edits []Edit) (insertions, deletions int) {
+	for _, edit := range edits {
+		switch edit.Kind {
+		case OpInsert:
+			insertions++
+		case OpDelete:
+			deletions++
+		}
+	}
+	return insertions, deletions
+}
+
+// IsBinary uses Git's heuristic: content with a NUL byte in its first 8000
+// bytes is treated as binary.
+func IsBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) != -1
+}
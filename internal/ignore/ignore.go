@@ -0,0 +1,279 @@
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Pattern is one line of an ignore file.
+type Pattern struct {
+	Source string // file the pattern was read from
+	Line   int    // 1-based line number in Source
+	Text   string // the pattern as written, including any leading "!"
+
+	Negate   bool
+	DirOnly  bool
+	anchored bool
+	base     string // directory of the ignore file, relative to the repository
+	re       *regexp.Regexp
+}
+
+// ParsePatterns parses the contents of an ignore file located in base, a
+// slash-separated directory relative to the repository root ("" for the
+// root). Blank lines, comments and invalid patterns are skipped.
+func ParsePatterns(data []byte, base, source string) []*Pattern {
+	var patterns []*Pattern
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if p := parsePattern(line); p != nil {
+			p.Source, p.Line, p.base = source, lineNo, base
+			patterns = append(patterns, p)
+		}
+	}
+
+	return patterns
+}
+
+func parsePattern(line string) *Pattern {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	// Trailing spaces are dropped unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" {
+		return nil
+	}
+
+	p := &Pattern{Text: line}
+	if strings.HasPrefix(line, "!") {
+		p.Negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.DirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+
+	re, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return nil
+	}
+	p.re = re
+	return p
+}
+
+// globToRegexp translates a wildmatch pattern. "*" and "?" do not match "/",
+// "**/" matches zero or more leading directories, "/**" everything inside a
+// directory and "/**/" zero or more directories in between.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			atSegmentStart := i == 0 || glob[i-1] == '/'
+			if atSegmentStart && strings.HasPrefix(glob[i:], "**") {
+				rest := glob[i+2:]
+				if rest == "" {
+					sb.WriteString(".*")
+					i++
+					continue
+				}
+				if strings.HasPrefix(rest, "/") {
+					sb.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+			}
+			for i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			class, n := bracketClass(glob[i:])
+			if n == 0 {
+				sb.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			sb.WriteString(class)
+			i += n - 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// bracketClass translates a "[...]" class at the start of glob and returns
+// it with the number of bytes consumed, or 0 if the class is not closed.
+func bracketClass(glob string) (string, int) {
+	i := 1
+	negate := false
+	if i < len(glob) && (glob[i] == '!' || glob[i] == '^') {
+		negate = true
+		i++
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[")
+	if negate {
+		sb.WriteString("^/")
+	}
+	for first := true; i < len(glob); i++ {
+		c := glob[i]
+		if c == ']' && !first {
+			sb.WriteString("]")
+			return sb.String(), i + 1
+		}
+		first = false
+		switch c {
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		case '-':
+			sb.WriteByte('-')
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return "", 0
+}
+
+// Matches reports whether the pattern applies to a slash-separated path
+// relative to the repository root. The negation of the pattern is not taken
+// into account.
+func (p *Pattern) Matches(relPath string, isDir bool) bool {
+	if p.DirOnly && !isDir {
+		return false
+	}
+
+	if p.base != "" {
+		rest, ok := strings.CutPrefix(relPath, p.base+"/")
+		if !ok {
+			return false
+		}
+		relPath = rest
+	}
+
+	if !p.anchored {
+		relPath = path.Base(relPath)
+	}
+	return p.re.MatchString(relPath)
+}
+
+// Matcher decides whether paths are ignored, combining global patterns with
+// the ignore files found in each directory. Patterns in deeper directories
+// take precedence over those above them, which take precedence over the
+// global ones, and within one file the last matching pattern wins.
+type Matcher struct {
+	global []*Pattern
+	load   func(dir string) ([]*Pattern, error)
+	dirs   map[string][]*Pattern
+}
+
+// NewMatcher returns a matcher using global patterns, lowest precedence
+// first, and load to read the patterns of the ignore file in a directory.
+func NewMatcher(global []*Pattern, load func(dir string) ([]*Pattern, error)) *Matcher {
+	return &Matcher{global: global, load: load, dirs: make(map[string][]*Pattern)}
+}
+
+// Match returns the pattern deciding whether relPath is ignored, or nil if
+// no pattern applies. The path is ignored if the pattern is not negated.
+// A path inside an ignored directory is ignored by the directory's pattern,
+// since Git does not look into excluded directories.
+func (m *Matcher) Match(relPath string, isDir bool) (*Pattern, error) {
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		p, err := m.matchPath(strings.Join(parts[:i], "/"), true)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil && !p.Negate {
+			return p, nil
+		}
+	}
+	return m.matchPath(relPath, isDir)
+}
+
+// IsIgnored reports whether relPath is ignored.
+func (m *Matcher) IsIgnored(relPath string, isDir bool) (bool, error) {
+	p, err := m.Match(relPath, isDir)
+	if err != nil {
+		return false, err
+	}
+	return p != nil && !p.Negate, nil
+}
+
+// matchPath checks relPath itself, assuming its parent directories are not
+// ignored.
+func (m *Matcher) matchPath(relPath string, isDir bool) (*Pattern, error) {
+	dir := path.Dir(relPath)
+	for {
+		if dir == "." {
+			dir = ""
+		}
+		patterns, err := m.dirPatterns(dir)
+		if err != nil {
+			return nil, err
+		}
+		if p := lastMatch(patterns, relPath, isDir); p != nil {
+			return p, nil
+		}
+		if dir == "" {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+
+	return lastMatch(m.global, relPath, isDir), nil
+}
+
+func (m *Matcher) dirPatterns(dir string) ([]*Pattern, error) {
+	if patterns, ok := m.dirs[dir]; ok {
+		return patterns, nil
+	}
+	patterns, err := m.load(dir)
+	if err != nil {
+		return nil, err
+	}
+	m.dirs[dir] = patterns
+	return patterns, nil
+}
+
+func lastMatch(patterns []*Pattern, relPath string, isDir bool) *Pattern {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if patterns[i].Matches(relPath, isDir) {
+			return patterns[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package ignore_test
+
+import (
+	"testing"
+
+	"github.com/Gr1shma/notgit/internal/ignore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatternMatches(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		matches bool
+	}{
+		{"*.o", "main.o", false, true},
+		{"*.o", "src/lib/main.o", false, true},
+		{"*.o", "main.c", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/api/notes.txt", false, false},
+		{"**/logs", "logs", true, true},
+		{"**/logs", "a/b/logs", true, true},
+		{"**/logs/debug.log", "x/logs/debug.log", false, true},
+		{"logs/**", "logs/a/b.txt", false, true},
+		{"logs/**", "logs", true, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "a/x/c", false, false},
+		{"file?.txt", "file1.txt", false, true},
+		{"file?.txt", "file10.txt", false, false},
+		{"[abc].txt", "b.txt", false, true},
+		{"[!abc].txt", "b.txt", false, false},
+		{"[a-c].txt", "c.txt", false, true},
+		{"\\#notes", "#notes", false, true},
+		{"\\!important", "!important", false, true},
+		{"trailing   ", "trailing", false, true},
+	}
+
+	for _, tc := range cases {
+		patterns := ignore.ParsePatterns([]byte(tc.pattern), "", ".notgitignore")
+		require.Len(t, patterns, 1, tc.pattern)
+		require.Equal(t, tc.matches, patterns[0].Matches(tc.path, tc.isDir), "%s vs %s", tc.pattern, tc.path)
+	}
+}
+
+func TestParsePatternsSkipsCommentsAndBlankLines(t *testing.T) {
+	patterns := ignore.ParsePatterns([]byte("# comment\n\n*.log\n!keep.log\n   \n"), "sub", "sub/.notgitignore")
+	require.Len(t, patterns, 2)
+
+	require.Equal(t, "*.log", patterns[0].Text)
+	require.Equal(t, 3, patterns[0].Line)
+	require.False(t, patterns[0].Negate)
+
+	require.Equal(t, "!keep.log", patterns[1].Text)
+	require.Equal(t, 4, patterns[1].Line)
+	require.True(t, patterns[1].Negate)
+
+	// Patterns only apply below the directory of their file
+	require.True(t, patterns[0].Matches("sub/a.log", false))
+	require.False(t, patterns[0].Matches("a.log", false))
+}
+
+func TestMatcherPrecedence(t *testing.T) {
+	files := map[string]string{
+		"":    "*.log\nbuild/\n!important.log\nvendor/\n",
+		"sub": "!*.log\n",
+	}
+	global := ignore.ParsePatterns([]byte("*.swp\n*.tmp\n"), "", "exclude")
+	global = append(global, ignore.ParsePatterns([]byte("!keep.tmp\n"), "", "info/exclude")...)
+
+	m := ignore.NewMatcher(global, func(dir string) ([]*ignore.Pattern, error) {
+		return ignore.ParsePatterns([]byte(files[dir]), dir, dir+"/.notgitignore"), nil
+	})
+
+	cases := map[string]bool{
+		"debug.log":          true,
+		"important.log":      false,
+		"sub/debug.log":      false,
+		"build/out.bin":      true,
+		"src/build/out.bin":  true,
+		".main.c.swp":        true,
+		"scratch.tmp":        true,
+		"keep.tmp":           false,
+		"main.c":             false,
+		"vendor/lib/keep.go": true,
+	}
+	for path, expected := range cases {
+		ignored, err := m.IsIgnored(path, false)
+		require.NoError(t, err)
+		require.Equal(t, expected, ignored, path)
+	}
+
+	p, err := m.Match("build/out.bin", false)
+	require.NoError(t, err)
+	require.Equal(t, "build/", p.Text)
+	require.Equal(t, 2, p.Line)
+
+	p, err = m.Match("sub/debug.log", false)
+	require.NoError(t, err)
+	require.Equal(t, "!*.log", p.Text)
+	require.Equal(t, "sub/.notgitignore", p.Source)
+
+	p, err = m.Match("main.c", false)
+	require.NoError(t, err)
+	require.Nil(t, p)
+}
@@ -0,0 +1,188 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked is returned, wrapped in a *LockedError, when another process
+// holds the lock.
+var ErrLocked = errors.New("file is locked")
+
+// DefaultTimeout is how long Acquire waits for another process to release a
+// lock before giving up. Background commands only hold locks briefly.
+const DefaultTimeout = time.Second
+
+// StaleAfter is the age after which a lock is assumed to be left behind by a
+// process that crashed, and is removed.
+const StaleAfter = 10 * time.Minute
+
+// LockedError reports a lock held by another process.
+type LockedError struct {
+	LockPath string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("unable to create '%s': File exists.\n\n"+
+		"Another notgit process seems to be running in this repository. Please make\n"+
+		"sure all processes are terminated, then try again. If it still fails, a\n"+
+		"notgit process may have crashed in this repository earlier: remove the\n"+
+		"file manually to continue.", e.LockPath)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// LockFile is an exclusive lock on a file, taken by creating "<path>.lock".
+// The new content is written to the lock file, which then atomically
+// replaces the original on Commit, so readers never see a partial write.
+type LockFile struct {
+	path     string
+	lockPath string
+	file     *os.File
+	// done is set once the lock is committed or rolled back
+	done bool
+}
+
+// Acquire locks path, waiting up to DefaultTimeout for another holder.
+func Acquire(path string) (*LockFile, error) {
+	return AcquireWithTimeout(path, DefaultTimeout)
+}
+
+// AcquireWithTimeout locks path, waiting up to timeout for another holder.
+func AcquireWithTimeout(path string, timeout time.Duration) (*LockFile, error) {
+	lockPath := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	backoff := 5 * time.Millisecond
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			return &LockFile{path: path, lockPath: lockPath, file: file}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("unable to create '%s': %w", lockPath, err)
+		}
+
+		if removeStaleLock(lockPath) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, &LockedError{LockPath: lockPath}
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 100*time.Millisecond)
+	}
+}
+
+// removeStaleLock removes the lock file if it is older than StaleAfter. The
+// lock is first renamed away, and only deleted if it is still the file that
+// was judged stale: another waiter may have removed that one and taken a
+// fresh lock in the meantime, which is put back.
+func removeStaleLock(lockPath string) bool {
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		// Released in the meantime
+		return os.IsNotExist(err)
+	}
+	if time.Since(info.ModTime()) < StaleAfter {
+		return false
+	}
+
+	stalePath := fmt.Sprintf("%s.stale-%d-%d", lockPath, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(lockPath, stalePath); err != nil {
+		return os.IsNotExist(err)
+	}
+	moved, err := os.Stat(stalePath)
+	if err == nil && (!os.SameFile(info, moved) || !moved.ModTime().Equal(info.ModTime())) {
+		// Not ours to remove; restoring fails if yet another lock was taken,
+		// in which case both holders had it anyway
+		os.Link(stalePath, lockPath)
+		os.Remove(stalePath)
+		return false
+	}
+	return os.Remove(stalePath) == nil
+}
+
+func (l *LockFile) Write(p []byte) (int, error) {
+	return l.file.Write(p)
+}
+
+// Stat returns the metadata of the lock file. Its modification time is the
+// one the file will have once committed.
+func (l *LockFile) Stat() (os.FileInfo, error) {
+	return l.file.Stat()
+}
+
+// Reset discards everything written so far.
+func (l *LockFile) Reset() error {
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate %s: %w", l.lockPath, err)
+	}
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind %s: %w", l.lockPath, err)
+	}
+	return nil
+}
+
+// Commit replaces the locked file with what was written and releases the
+// lock.
+func (l *LockFile) Commit(perm os.FileMode) error {
+	if l.done {
+		return fmt.Errorf("lock on %s already released", l.path)
+	}
+	l.done = true
+	if err := l.file.Sync(); err != nil {
+		l.file.Close()
+		os.Remove(l.lockPath)
+		return fmt.Errorf("failed to flush %s: %w", l.lockPath, err)
+	}
+	if err := l.file.Close(); err != nil {
+		os.Remove(l.lockPath)
+		return fmt.Errorf("failed to close %s: %w", l.lockPath, err)
+	}
+	if err := os.Chmod(l.lockPath, perm); err != nil {
+		os.Remove(l.lockPath)
+		return fmt.Errorf("failed to set mode of %s: %w", l.lockPath, err)
+	}
+	if err := os.Rename(l.lockPath, l.path); err != nil {
+		os.Remove(l.lockPath)
+		return fmt.Errorf("failed to replace %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// Rollback releases the lock, leaving the original file untouched. It does
+// nothing once the lock was committed, so it can be deferred.
+func (l *LockFile) Rollback() error {
+	if l.done {
+		return nil
+	}
+	l.done = true
+	l.file.Close()
+	if err := os.Remove(l.lockPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", l.lockPath, err)
+	}
+	return nil
+}
+
+// WriteFile atomically replaces the content of path while holding its lock.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	lock, err := Acquire(path)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write(data); err != nil {
+		lock.Rollback()
+		return fmt.Errorf("failed to write %s: %w", lock.lockPath, err)
+	}
+	return lock.Commit(perm)
+}
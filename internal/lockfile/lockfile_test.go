@@ -0,0 +1,99 @@
+package lockfile_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gr1shma/notgit/internal/lockfile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockFileCommitAndRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0o644))
+
+	lock, err := lockfile.Acquire(path)
+	require.NoError(t, err)
+	_, err = lock.Write([]byte("new"))
+	require.NoError(t, err)
+
+	// The original stays readable until the commit
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "old", string(data))
+
+	require.NoError(t, lock.Commit(0o644))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+	require.NoFileExists(t, path+".lock")
+
+	lock, err = lockfile.Acquire(path)
+	require.NoError(t, err)
+	_, err = lock.Write([]byte("discarded"))
+	require.NoError(t, err)
+	require.NoError(t, lock.Rollback())
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+	require.NoFileExists(t, path+".lock")
+}
+
+func TestLockFileHeld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "HEAD")
+
+	lock, err := lockfile.Acquire(path)
+	require.NoError(t, err)
+
+	_, err = lockfile.AcquireWithTimeout(path, 0)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, lockfile.ErrLocked))
+	require.True(t, strings.Contains(err.Error(), path+".lock"))
+
+	err = lockfile.WriteFile(path, []byte("ref: refs/heads/master\n"), 0o644)
+	require.True(t, errors.Is(err, lockfile.ErrLocked))
+	require.NoFileExists(t, path)
+
+	require.NoError(t, lock.Rollback())
+	require.NoError(t, lockfile.WriteFile(path, []byte("ref: refs/heads/master\n"), 0o644))
+}
+
+func TestLockFileStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "refs", "heads", "master")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path+".lock", nil, 0o644))
+
+	old := time.Now().Add(-2 * lockfile.StaleAfter)
+	require.NoError(t, os.Chtimes(path+".lock", old, old))
+
+	require.NoError(t, lockfile.WriteFile(path, []byte("abc\n"), 0o644))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "abc\n", string(data))
+}
+
+func TestLockFileStaleLeavesFreshLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	require.NoError(t, os.WriteFile(path+".lock", nil, 0o644))
+	old := time.Now().Add(-2 * lockfile.StaleAfter)
+	require.NoError(t, os.Chtimes(path+".lock", old, old))
+
+	first, err := lockfile.AcquireWithTimeout(path, 0)
+	require.NoError(t, err)
+
+	// The lock that replaced the stale one is respected, and nothing is left
+	// behind by the takeover
+	_, err = lockfile.AcquireWithTimeout(path, 0)
+	require.ErrorIs(t, err, lockfile.ErrLocked)
+	require.FileExists(t, path+".lock")
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NoError(t, first.Rollback())
+}
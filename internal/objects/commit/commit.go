@@ -52,19 +52,8 @@ func (c *Commit) Serialize() ([]byte, error) {
 		buffer.WriteString(fmt.Sprintf("parent %s\n", parent))
 	}
 
-	buffer.WriteString(fmt.Sprintf("author %s <%s> %d %s\n",
-		c.Author.Name,
-		c.Author.Email,
-		c.Author.Time.Unix(),
-		c.Author.Time.Format("-0700"), // Git-style timezone offset
-	))
-
-	buffer.WriteString(fmt.Sprintf("committer %s <%s> %d %s\n",
-		c.Committer.Name,
-		c.Committer.Email,
-		c.Committer.Time.Unix(),
-		c.Committer.Time.Format("-0700"),
-	))
+	buffer.WriteString(fmt.Sprintf("author %s\n", c.Author))
+	buffer.WriteString(fmt.Sprintf("committer %s\n", c.Committer))
 
 	buffer.WriteString("\n")
 	buffer.WriteString(c.Message)
@@ -96,6 +85,10 @@ func DeserializeCommit(data []byte) (*Commit, error) {
 		return nil, fmt.Errorf("invalid commit format: missing null byte separator")
 	}
 
+	if !bytes.HasPrefix(data, []byte("commit ")) {
+		return nil, fmt.Errorf("not a commit object: %s", data[:nullByteIndex])
+	}
+
 	content := data[nullByteIndex+1:]
 	lines := bytes.Split(content, []byte("\n"))
 
@@ -118,14 +111,14 @@ func DeserializeCommit(data []byte) (*Commit, error) {
 			commit.ParentHashes = append(commit.ParentHashes, parentHash)
 
 		case strings.HasPrefix(line, "author "):
-			sig, err := parseSignature(line[len("author "):])
+			sig, err := ParseSignature(line[len("author "):])
 			if err != nil {
 				return nil, fmt.Errorf("invalid author line: %w", err)
 			}
 			commit.Author = sig
 
 		case strings.HasPrefix(line, "committer "):
-			sig, err := parseSignature(line[len("committer "):])
+			sig, err := ParseSignature(line[len("committer "):])
 			if err != nil {
 				return nil, fmt.Errorf("invalid committer line: %w", err)
 			}
@@ -140,7 +133,17 @@ func DeserializeCommit(data []byte) (*Commit, error) {
 	return commit, nil
 }
 
-func parseSignature(input string) (Signature, error) {
+// String formats the signature as it appears in commit headers.
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s",
+		s.Name,
+		s.Email,
+		s.Time.Unix(),
+		s.Time.Format("-0700"), // Git-style timezone offset
+	)
+}
+
+func ParseSignature(input string) (Signature, error) {
 	var sig Signature
 
 	nameEmailParts := strings.SplitN(input, " <", 2)
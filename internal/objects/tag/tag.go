@@ -0,0 +1,124 @@
+package tag
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/objects"
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+)
+
+// Tag is an annotated tag: a named, signed pointer to another object,
+// usually a commit.
+type Tag struct {
+	Object     string
+	ObjectType string
+	Name       string
+	Tagger     commit.Signature
+	Message    string
+	Hash       string
+}
+
+var _ objects.Object = (*Tag)(nil)
+
+func NewTag(object, objectType, name string, tagger commit.Signature, message string) *Tag {
+	return &Tag{
+		Object:     object,
+		ObjectType: objectType,
+		Name:       name,
+		Tagger:     tagger,
+		Message:    message,
+	}
+}
+
+func (t *Tag) Type() string {
+	return "tag"
+}
+
+func (t *Tag) Serialize() ([]byte, error) {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(fmt.Sprintf("object %s\n", t.Object))
+	buffer.WriteString(fmt.Sprintf("type %s\n", t.ObjectType))
+	buffer.WriteString(fmt.Sprintf("tag %s\n", t.Name))
+	buffer.WriteString(fmt.Sprintf("tagger %s\n", t.Tagger))
+
+	buffer.WriteString("\n")
+	buffer.WriteString(t.Message)
+
+	content := buffer.Bytes()
+	header := fmt.Sprintf("tag %d\x00", len(content))
+	full := append([]byte(header), content...)
+
+	return full, nil
+}
+
+func (t *Tag) ComputeHash() error {
+	serialized, err := t.Serialize()
+	if err != nil {
+		return err
+	}
+	hash := sha1.Sum(serialized)
+	t.Hash = hex.EncodeToString(hash[:])
+	return nil
+}
+
+func (t *Tag) GetHash() string {
+	return t.Hash
+}
+
+func DeserializeTag(data []byte) (*Tag, error) {
+	nullByteIndex := bytes.IndexByte(data, 0)
+	if nullByteIndex == -1 {
+		return nil, fmt.Errorf("invalid tag format: missing null byte separator")
+	}
+
+	if !bytes.HasPrefix(data, []byte("tag ")) {
+		return nil, fmt.Errorf("not a tag object: %s", data[:nullByteIndex])
+	}
+
+	content := data[nullByteIndex+1:]
+	lines := bytes.Split(content, []byte("\n"))
+
+	t := &Tag{}
+
+	for i, lineBytes := range lines {
+		line := string(lineBytes)
+
+		if line == "" {
+			t.Message = string(bytes.Join(lines[i+1:], []byte("\n")))
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(line, "object "):
+			t.Object = strings.TrimPrefix(line, "object ")
+
+		case strings.HasPrefix(line, "type "):
+			t.ObjectType = strings.TrimPrefix(line, "type ")
+
+		case strings.HasPrefix(line, "tag "):
+			t.Name = strings.TrimPrefix(line, "tag ")
+
+		case strings.HasPrefix(line, "tagger "):
+			sig, err := commit.ParseSignature(line[len("tagger "):])
+			if err != nil {
+				return nil, fmt.Errorf("invalid tagger line: %w", err)
+			}
+			t.Tagger = sig
+		}
+	}
+
+	if t.Object == "" || t.ObjectType == "" || t.Name == "" {
+		return nil, fmt.Errorf("invalid tag: missing object, type or tag header")
+	}
+
+	if err := t.ComputeHash(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
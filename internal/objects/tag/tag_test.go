@@ -0,0 +1,43 @@
+package tag_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/objects/tag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagSerializeRoundTrip(t *testing.T) {
+	tagger := commit.Signature{
+		Name:  "Grishma",
+		Email: "hey@grishmadhakal.com.np",
+		Time:  time.Unix(1600000000, 0),
+	}
+	original := tag.NewTag("0123456789abcdef0123456789abcdef01234567", "commit", "v1.0", tagger, "First release\n")
+	require.NoError(t, original.ComputeHash())
+
+	serialized, err := original.Serialize()
+	require.NoError(t, err)
+	require.Contains(t, string(serialized), "object 0123456789abcdef0123456789abcdef01234567\ntype commit\ntag v1.0\n")
+	require.Contains(t, string(serialized), "tagger Grishma <hey@grishmadhakal.com.np> 1600000000")
+
+	parsed, err := tag.DeserializeTag(serialized)
+	require.NoError(t, err)
+	require.Equal(t, original.Object, parsed.Object)
+	require.Equal(t, original.ObjectType, parsed.ObjectType)
+	require.Equal(t, original.Name, parsed.Name)
+	require.Equal(t, original.Tagger.Email, parsed.Tagger.Email)
+	require.Equal(t, original.Tagger.Time.Unix(), parsed.Tagger.Time.Unix())
+	require.Equal(t, original.Message, parsed.Message)
+	require.Equal(t, original.Hash, parsed.Hash)
+}
+
+func TestDeserializeTagRejectsOtherObjects(t *testing.T) {
+	_, err := tag.DeserializeTag([]byte("commit 4\x00tree"))
+	require.Error(t, err)
+
+	_, err = tag.DeserializeTag([]byte("tag 12\x00type commit\n"))
+	require.Error(t, err)
+}
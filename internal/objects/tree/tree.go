@@ -15,8 +15,16 @@ type EntryType int
 const (
 	EntryTypeBlob EntryType = iota
 	EntryTypeTree
+	EntryTypeExecutable
+	EntryTypeSymlink
 )
 
+// IsFile reports whether entries of this type point at a blob: regular and
+// executable files as well as symlinks, whose blob holds the link target.
+func (e EntryType) IsFile() bool {
+	return e != EntryTypeTree
+}
+
 type Entry struct {
 	Name string
 	Hash string
@@ -145,7 +153,7 @@ func parseTreeContent(data []byte) (*Tree, error) {
 			return nil, fmt.Errorf("invalid entry mode: %s", mode)
 		}
 
-		entryType, err := parseEntryType(typeStr)
+		entryType, err := parseEntryType(mode, typeStr)
 		if err != nil {
 			return nil, err
 		}
@@ -171,15 +179,28 @@ func (t *Tree) GetHash() string {
 }
 
 func isValidMode(mode string) bool {
-	return mode == "100644" || mode == "040000"
+	switch mode {
+	case "100644", "100755", "120000", "040000":
+		return true
+	}
+	return false
 }
 
 func (t *Tree) getModeForType(entryType EntryType) string {
+	return ModeForType(entryType)
+}
+
+// ModeForType returns the Git file mode written for entries of a type.
+func ModeForType(entryType EntryType) string {
 	switch entryType {
 	case EntryTypeBlob:
 		return "100644"
 	case EntryTypeTree:
 		return "040000"
+	case EntryTypeExecutable:
+		return "100755"
+	case EntryTypeSymlink:
+		return "120000"
 	default:
 		return "100644"
 	}
@@ -187,8 +208,6 @@ func (t *Tree) getModeForType(entryType EntryType) string {
 
 func (t *Tree) getTypeString(entryType EntryType) string {
 	switch entryType {
-	case EntryTypeBlob:
-		return "blob"
 	case EntryTypeTree:
 		return "tree"
 	default:
@@ -196,13 +215,19 @@ func (t *Tree) getTypeString(entryType EntryType) string {
 	}
 }
 
-func parseEntryType(typeStr string) (EntryType, error) {
-	switch typeStr {
-	case "blob":
-		return EntryTypeBlob, nil
-	case "tree":
+func parseEntryType(mode, typeStr string) (EntryType, error) {
+	switch {
+	case typeStr == "tree" && mode == "040000":
 		return EntryTypeTree, nil
-	default:
+	case typeStr == "blob" && mode == "100644":
+		return EntryTypeBlob, nil
+	case typeStr == "blob" && mode == "100755":
+		return EntryTypeExecutable, nil
+	case typeStr == "blob" && mode == "120000":
+		return EntryTypeSymlink, nil
+	case typeStr != "blob" && typeStr != "tree":
 		return 0, fmt.Errorf("invalid entry type: %s", typeStr)
+	default:
+		return 0, fmt.Errorf("entry mode %s does not match type %s", mode, typeStr)
 	}
 }
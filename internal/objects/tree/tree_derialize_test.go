@@ -78,3 +78,26 @@ func TestTreeDeserialize_MultipleEntries(t *testing.T) {
 	require.Equal(t, tree.EntryTypeTree, treeEntry.Type)
 	require.Equal(t, subTree.GetHash(), treeEntry.Hash)
 }
+
+func TestTreeDeserialize_FileModes(t *testing.T) {
+	origTree := tree.NewTree()
+	origTree.AddEntry("run.sh", "1111111111111111111111111111111111111111", tree.EntryTypeExecutable)
+	origTree.AddEntry("link", "2222222222222222222222222222222222222222", tree.EntryTypeSymlink)
+	origTree.AddEntry("lib", "3333333333333333333333333333333333333333", tree.EntryTypeTree)
+
+	content, err := origTree.SerializeContent()
+	require.NoError(t, err)
+	require.Contains(t, string(content), "100755 blob 1111111111111111111111111111111111111111\trun.sh\n")
+	require.Contains(t, string(content), "120000 blob 2222222222222222222222222222222222222222\tlink\n")
+
+	serialized, err := origTree.Serialize()
+	require.NoError(t, err)
+	deserializedTree, err := tree.DeserializeTree(serialized)
+	require.NoError(t, err)
+	require.Equal(t, tree.EntryTypeExecutable, deserializedTree.GetEntry("run.sh").Type)
+	require.Equal(t, tree.EntryTypeSymlink, deserializedTree.GetEntry("link").Type)
+	require.Equal(t, tree.EntryTypeTree, deserializedTree.GetEntry("lib").Type)
+
+	_, err = tree.DeserializeTree([]byte("120000 tree 3333333333333333333333333333333333333333\tbad\n"))
+	require.Error(t, err)
+}
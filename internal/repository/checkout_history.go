@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkoutMove is a branch switch as recorded in the HEAD reflog: where HEAD
+// moved from and to, as named on the command line, and the commit it ended
+// up at.
+type checkoutMove struct {
+	from string
+	to   string
+	hash string
+}
+
+// checkoutHistory returns the checkouts recorded in the HEAD reflog, most
+// recent first.
+func (r *Repository) checkoutHistory() ([]checkoutMove, error) {
+	entries, err := r.ReadReflog("HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	var moves []checkoutMove
+	for i := len(entries) - 1; i >= 0; i-- {
+		rest, ok := strings.CutPrefix(entries[i].Message, "checkout: moving from ")
+		if !ok {
+			continue
+		}
+		from, to, _ := strings.Cut(rest, " to ")
+		moves = append(moves, checkoutMove{from: from, to: to, hash: entries[i].NewHash})
+	}
+	return moves, nil
+}
+
+// PreviousBranch returns the branch (or commit, if HEAD was detached) that
+// was checked out before the n-th most recent checkout, as used by @{-n}.
+func (r *Repository) PreviousBranch(n int) (string, error) {
+	moves, err := r.checkoutHistory()
+	if err != nil {
+		return "", err
+	}
+	if n < 1 || n > len(moves) {
+		return "", fmt.Errorf("not enough checkouts in the reflog")
+	}
+	return moves[n-1].from, nil
+}
+
+// DetachedFrom describes a detached HEAD the way status does: it returns the
+// target of the last checkout, as the ref name if one was checked out and
+// otherwise as a short hash, and whether HEAD still points there. The name
+// is empty if no checkout was recorded.
+func (r *Repository) DetachedFrom() (string, bool, error) {
+	moves, err := r.checkoutHistory()
+	if err != nil || len(moves) == 0 || moves[0].to == "" {
+		return "", false, err
+	}
+	head, err := r.GetHEADCommitHash()
+	if err != nil {
+		return "", false, err
+	}
+
+	last := moves[0]
+	name := r.ShortHash(last.hash)
+	if _, isRef := r.expandRefName(last.to); isRef {
+		name = last.to
+	}
+	return name, last.hash == head, nil
+}
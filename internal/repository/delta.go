@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Deltas use Git's instruction format: the header holds the base and target
+// sizes as little-endian varints, followed by a stream of instructions.
+// An instruction with the high bit set copies a range of the base; any other
+// non-zero byte n inserts the next n literal bytes.
+const (
+	deltaBlockSize = 16
+	maxDeltaInsert = 0x7f
+	maxDeltaCopy   = 0xffffff
+)
+
+func createDelta(base, target []byte) []byte {
+	var out bytes.Buffer
+	out.Write(encodeDeltaSize(len(base)))
+	out.Write(encodeDeltaSize(len(target)))
+
+	blocks := make(map[string]int)
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		key := string(base[i : i+deltaBlockSize])
+		if _, exists := blocks[key]; !exists {
+			blocks[key] = i
+		}
+	}
+
+	var pending []byte
+	pos := 0
+	for pos < len(target) {
+		if pos+deltaBlockSize > len(target) {
+			pending = append(pending, target[pos:]...)
+			break
+		}
+
+		baseOffset, ok := blocks[string(target[pos:pos+deltaBlockSize])]
+		if !ok {
+			pending = append(pending, target[pos])
+			pos++
+			continue
+		}
+
+		// Grow the match backwards into bytes we were about to insert
+		for baseOffset > 0 && len(pending) > 0 && base[baseOffset-1] == pending[len(pending)-1] {
+			baseOffset--
+			pending = pending[:len(pending)-1]
+			pos--
+		}
+
+		length := 0
+		for baseOffset+length < len(base) && pos+length < len(target) && base[baseOffset+length] == target[pos+length] {
+			length++
+		}
+
+		writeDeltaInsert(&out, pending)
+		pending = pending[:0]
+		writeDeltaCopy(&out, baseOffset, length)
+		pos += length
+	}
+	writeDeltaInsert(&out, pending)
+
+	return out.Bytes()
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, n := decodeDeltaSize(delta)
+	if n == 0 {
+		return nil, fmt.Errorf("invalid delta: truncated header")
+	}
+	delta = delta[n:]
+	if baseSize != len(base) {
+		return nil, fmt.Errorf("invalid delta: base size mismatch: expected %d, got %d", baseSize, len(base))
+	}
+
+	targetSize, n := decodeDeltaSize(delta)
+	if n == 0 {
+		return nil, fmt.Errorf("invalid delta: truncated header")
+	}
+	delta = delta[n:]
+
+	result := make([]byte, 0, targetSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		if op&0x80 == 0 {
+			if op == 0 {
+				return nil, fmt.Errorf("invalid delta: reserved instruction")
+			}
+			if int(op) > len(delta) {
+				return nil, fmt.Errorf("invalid delta: insert past end of data")
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+			continue
+		}
+
+		var offset, size int
+		for i := 0; i < 4; i++ {
+			if op&(1<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, fmt.Errorf("invalid delta: truncated copy instruction")
+				}
+				offset |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if op&(1<<(4+i)) != 0 {
+				if len(delta) == 0 {
+					return nil, fmt.Errorf("invalid delta: truncated copy instruction")
+				}
+				size |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(base) {
+			return nil, fmt.Errorf("invalid delta: copy past end of base")
+		}
+		result = append(result, base[offset:offset+size]...)
+	}
+
+	if len(result) != targetSize {
+		return nil, fmt.Errorf("invalid delta: result size mismatch: expected %d, got %d", targetSize, len(result))
+	}
+	return result, nil
+}
+
+func writeDeltaInsert(out *bytes.Buffer, data []byte) {
+	for len(data) > 0 {
+		n := min(len(data), maxDeltaInsert)
+		out.WriteByte(byte(n))
+		out.Write(data[:n])
+		data = data[n:]
+	}
+}
+
+func writeDeltaCopy(out *bytes.Buffer, offset, length int) {
+	for length > 0 {
+		size := min(length, maxDeltaCopy)
+
+		op := byte(0x80)
+		var args []byte
+		for i := 0; i < 4; i++ {
+			if b := byte(offset >> (8 * i)); b != 0 {
+				op |= 1 << i
+				args = append(args, b)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if b := byte(size >> (8 * i)); b != 0 {
+				op |= 1 << (4 + i)
+				args = append(args, b)
+			}
+		}
+		out.WriteByte(op)
+		out.Write(args)
+
+		offset += size
+		length -= size
+	}
+}
+
+func encodeDeltaSize(size int) []byte {
+	var buf []byte
+	for {
+		b := byte(size & 0x7f)
+		size >>= 7
+		if size == 0 {
+			return append(buf, b)
+		}
+		buf = append(buf, b|0x80)
+	}
+}
+
+// decodeDeltaSize returns the decoded size and the number of bytes consumed,
+// or zero bytes consumed if the input is truncated.
+func decodeDeltaSize(data []byte) (int, int) {
+	size, shift := 0, 0
+	for i, b := range data {
+		size |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return size, i + 1
+		}
+	}
+	return 0, 0
+}
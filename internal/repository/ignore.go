@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/ignore"
+	"github.com/Gr1shma/notgit/internal/utils"
+)
+
+// IgnoreFileName is the per-directory ignore file, the counterpart of
+// .gitignore.
+const IgnoreFileName = ".notgitignore"
+
+// IgnoreMatcher returns a matcher for the ignore rules of the repository:
+// .notgitignore files in any directory, .notgit/info/exclude and the global
+// excludes file named by core.excludesFile (by default
+// $XDG_CONFIG_HOME/notgit/ignore).
+func (r *Repository) IgnoreMatcher() (*ignore.Matcher, error) {
+	var global []*ignore.Pattern
+
+	if excludesFile := globalExcludesFile(); excludesFile != "" {
+		patterns, err := readIgnoreFile(excludesFile, "", excludesFile)
+		if err != nil {
+			return nil, err
+		}
+		global = append(global, patterns...)
+	}
+
+	infoExclude := filepath.Join(r.NotgitDir, "info", "exclude")
+	patterns, err := readIgnoreFile(infoExclude, "", ".notgit/info/exclude")
+	if err != nil {
+		return nil, err
+	}
+	global = append(global, patterns...)
+
+	load := func(dir string) ([]*ignore.Pattern, error) {
+		source := path.Join(dir, IgnoreFileName)
+		return readIgnoreFile(filepath.Join(r.BaseDir, filepath.FromSlash(source)), dir, source)
+	}
+	return ignore.NewMatcher(global, load), nil
+}
+
+// readIgnoreFile parses an ignore file; a missing file has no patterns.
+func readIgnoreFile(filePath, base, source string) ([]*ignore.Pattern, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	return ignore.ParsePatterns(data, base, source), nil
+}
+
+func globalExcludesFile() string {
+	var excludesFile string
+	if cfg, _, err := utils.LoadConfig(false); err == nil {
+		excludesFile, _ = utils.GetConfigKeyValue(cfg, "core.excludesFile")
+	}
+	if excludesFile == "" {
+		if cfg, _, err := utils.LoadConfig(true); err == nil {
+			excludesFile, _ = utils.GetConfigKeyValue(cfg, "core.excludesFile")
+		}
+	}
+
+	if rest, ok := strings.CutPrefix(excludesFile, "~/"); ok {
+		return filepath.Join(os.Getenv("HOME"), rest)
+	}
+	if excludesFile != "" {
+		return excludesFile
+	}
+
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "notgit", "ignore")
+}
@@ -2,57 +2,382 @@ package repository
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/lockfile"
+	"github.com/Gr1shma/notgit/internal/objects/tree"
 )
 
 type IndexEntry struct {
-	Path string `json:"path"`
-	Hash string `json:"hash"`
+	Path string
+	Hash string
+	// Type is the file mode: regular (the zero value), executable or
+	// symlink.
+	Type tree.EntryType
+	// Stat is the metadata of the working file when it was last known to
+	// match Hash; nil if unknown.
+	Stat *FileStat
+}
+
+// UnmergedEntry holds the versions of a path left conflicted by a merge, as
+// index stages 1 (the common ancestor), 2 (ours) and 3 (theirs). A version
+// is nil if the path does not exist on that side.
+type UnmergedEntry struct {
+	Base   *IndexEntry
+	Ours   *IndexEntry
+	Theirs *IndexEntry
 }
 
 type Index struct {
-	Entries map[string]IndexEntry `json:"entries"`
+	// Entries holds the merged (stage 0) entries.
+	Entries map[string]IndexEntry
+	// Unmerged holds the paths with conflicts; they have no stage 0 entry.
+	Unmerged map[string]UnmergedEntry
+
+	// mtime is the modification time of the index file when it was loaded,
+	// in nanoseconds, used to detect racily clean entries
+	mtime int64
 }
 
 func NewIndex() *Index {
-	return &Index{Entries: make(map[string]IndexEntry)}
+	return &Index{
+		Entries:  make(map[string]IndexEntry),
+		Unmerged: make(map[string]UnmergedEntry),
+	}
 }
 
 func (r *Repository) IndexPath() string {
+	return filepath.Join(r.NotgitDir, "index")
+}
+
+// legacyIndexPath is the JSON index written by earlier versions. It is read
+// when no binary index exists and removed once the index is saved.
+func (r *Repository) legacyIndexPath() string {
 	return filepath.Join(r.NotgitDir, "index.json")
 }
 
+// LoadIndex reads the index. A missing index file is created, and one in
+// the old JSON format upgraded, unless another process holds the lock and
+// is about to write it anyway.
 func (r *Repository) LoadIndex() (*Index, error) {
+	idx, exists, err := r.readIndex()
+	if err != nil || exists {
+		return idx, err
+	}
+
+	lock, err := lockfile.AcquireWithTimeout(r.IndexPath(), 0)
+	if errors.Is(err, lockfile.ErrLocked) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Rollback()
+
+	// Another process may have written it before the lock was taken
+	if idx, exists, err = r.readIndex(); err != nil || exists {
+		return idx, err
+	}
+	if err := r.writeIndex(lock, idx); err != nil {
+		return nil, fmt.Errorf("failed to create new index file: %w", err)
+	}
+	return idx, nil
+}
+
+// readIndex reads the index file, falling back to the legacy JSON index or
+// an empty one. exists reports whether the binary index file was found.
+func (r *Repository) readIndex() (idx *Index, exists bool, err error) {
 	indexPath := r.IndexPath()
 	data, err := os.ReadFile(indexPath)
+	if os.IsNotExist(err) {
+		idx, err := r.loadLegacyIndex()
+		return idx, false, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	idx, err = decodeIndex(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse index file: %w", err)
+	}
+	if info, err := os.Stat(indexPath); err == nil {
+		idx.mtime = info.ModTime().UnixNano()
+	}
+	return idx, true, nil
+}
+
+// loadLegacyIndex reads an index.json file, or returns an empty index if
+// there is none.
+func (r *Repository) loadLegacyIndex() (*Index, error) {
+	data, err := os.ReadFile(r.legacyIndexPath())
 	if err != nil {
 		if os.IsNotExist(err) {
-			idx := NewIndex()
-			if err := r.SaveIndex(idx); err != nil {
-				return nil, fmt.Errorf("failed to create new index file: %w", err)
-			}
-			return idx, nil
+			return NewIndex(), nil
 		}
 		return nil, fmt.Errorf("failed to read index: %w", err)
 	}
-	var idx Index
-	if err := json.Unmarshal(data, &idx); err != nil {
+
+	var legacy struct {
+		Entries map[string]struct {
+			Path       string         `json:"path"`
+			Hash       string         `json:"hash"`
+			Type       tree.EntryType `json:"type"`
+			Conflicted bool           `json:"conflicted"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
 		return nil, fmt.Errorf("failed to parse index file: %w", err)
 	}
-	return &idx, nil
+
+	idx := NewIndex()
+	for path, entry := range legacy.Entries {
+		if entry.Conflicted {
+			// Only one version of a conflicted path was recorded
+			idx.AddUnmerged(path, nil, &IndexEntry{Path: path, Hash: entry.Hash, Type: entry.Type}, nil)
+			continue
+		}
+		idx.AddEntryWithType(path, entry.Hash, entry.Type)
+	}
+	return idx, nil
 }
 
+// SaveIndex replaces the index with idx. Commands that modify the index they
+// read must use LockIndex instead, so that no concurrent change is lost.
 func (r *Repository) SaveIndex(idx *Index) error {
-	path := r.IndexPath()
-	data, err := json.MarshalIndent(idx, "", "  ")
+	lock, err := lockfile.Acquire(r.IndexPath())
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	defer lock.Rollback()
+	return r.writeIndex(lock, idx)
+}
+
+// writeIndex writes idx through the held index lock and commits it.
+//
+// An entry whose file was changed at or after the timestamp of the new index
+// file is racily clean: the file could change again within the timestamp
+// granularity without its metadata changing, and would then wrongly compare
+// as clean against every later index. Like Git, such entries are smudged by
+// writing them without their cached metadata.
+func (r *Repository) writeIndex(lock *lockfile.LockFile, idx *Index) error {
+	data, err := encodeIndex(idx, math.MaxInt64)
+	if err != nil {
+		return fmt.Errorf("failed to encode the index: %w", err)
+	}
+	if _, err := lock.Write(data); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	info, err := lock.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if mtime := info.ModTime().UnixNano(); idx.hasRacyEntries(mtime) {
+		// Rewriting only moves the timestamp forward, so entries older than
+		// mtime stay safe
+		if data, err = encodeIndex(idx, mtime); err != nil {
+			return fmt.Errorf("failed to encode the index: %w", err)
+		}
+		if err := lock.Reset(); err != nil {
+			return err
+		}
+		if _, err := lock.Write(data); err != nil {
+			return fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+	if err := lock.Commit(0o644); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := os.Remove(r.legacyIndexPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old index file: %w", err)
+	}
+	return nil
+}
+
+// LockedIndex is the index read while holding index.lock, like Git's
+// hold_locked_index: no other process can write the index until it is
+// written back with Commit or released with Rollback. Index may be
+// replaced with a new one before committing.
+type LockedIndex struct {
+	*Index
+	repo *Repository
+	lock *lockfile.LockFile
+}
+
+// LockIndex takes the index lock, waiting briefly for another holder, and
+// reads the index under it.
+func (r *Repository) LockIndex() (*LockedIndex, error) {
+	lock, err := lockfile.Acquire(r.IndexPath())
 	if err != nil {
-		return fmt.Errorf("failed to marsal the index: %w", err)
+		return nil, fmt.Errorf("failed to lock the index: %w", err)
 	}
-	return os.WriteFile(path, data, 0o644)
+	idx, _, err := r.readIndex()
+	if err != nil {
+		lock.Rollback()
+		return nil, err
+	}
+	return &LockedIndex{Index: idx, repo: r, lock: lock}, nil
+}
+
+// Commit writes the index and releases the lock.
+func (l *LockedIndex) Commit() error {
+	defer l.lock.Rollback()
+	return l.repo.writeIndex(l.lock, l.Index)
+}
+
+// Rollback releases the lock without writing the index. It does nothing once
+// the index was committed, so it can be deferred.
+func (l *LockedIndex) Rollback() error {
+	return l.lock.Rollback()
+}
+
+// RefreshIndex saves idx when only cached file metadata changed. As the
+// cache is an optimization, it does not wait for the lock and skips the write
+// when another process holds it or rewrote the index since idx was loaded.
+func (r *Repository) RefreshIndex(idx *Index) error {
+	lock, err := lockfile.AcquireWithTimeout(r.IndexPath(), 0)
+	if errors.Is(err, lockfile.ErrLocked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+
+	info, err := os.Stat(r.IndexPath())
+	if err != nil || info.ModTime().UnixNano() != idx.mtime {
+		return nil
+	}
+	return r.writeIndex(lock, idx)
 }
 
 func (idx *Index) AddEntry(path, hash string) {
-	idx.Entries[path] = IndexEntry{Path: path, Hash: hash}
+	idx.AddEntryWithType(path, hash, tree.EntryTypeBlob)
+}
+
+// AddEntryWithType stages a file, resolving any conflict on the path.
+func (idx *Index) AddEntryWithType(path, hash string, entryType tree.EntryType) {
+	delete(idx.Unmerged, path)
+	idx.Entries[path] = IndexEntry{Path: path, Hash: hash, Type: entryType}
+}
+
+// AddUnmerged records a conflicted path with the versions of each side,
+// replacing any merged entry for it.
+func (idx *Index) AddUnmerged(path string, base, ours, theirs *IndexEntry) {
+	delete(idx.Entries, path)
+	idx.Unmerged[path] = UnmergedEntry{Base: base, Ours: ours, Theirs: theirs}
+}
+
+// RemoveEntry drops a path from the index, including any conflict on it.
+func (idx *Index) RemoveEntry(path string) {
+	delete(idx.Entries, path)
+	delete(idx.Unmerged, path)
+}
+
+// RenameEntry moves the entry at oldPath to newPath, keeping its content,
+// mode and cached metadata. Any entry at newPath is replaced.
+func (idx *Index) RenameEntry(oldPath, newPath string) error {
+	if _, ok := idx.Unmerged[oldPath]; ok {
+		return fmt.Errorf("%s: path is unmerged", oldPath)
+	}
+	entry, ok := idx.Entries[oldPath]
+	if !ok {
+		return fmt.Errorf("%s: not in the index", oldPath)
+	}
+
+	delete(idx.Entries, oldPath)
+	idx.RemoveEntry(newPath)
+	entry.Path = newPath
+	idx.Entries[newPath] = entry
+	return nil
+}
+
+// PathsUnder returns the sorted tracked paths, merged or not, that are path
+// itself or inside the directory path. An empty path matches every entry.
+func (idx *Index) PathsUnder(path string) []string {
+	var paths []string
+	matches := func(p string) bool {
+		return path == "" || p == path || strings.HasPrefix(p, path+"/")
+	}
+	for p := range idx.Entries {
+		if matches(p) {
+			paths = append(paths, p)
+		}
+	}
+	for p := range idx.Unmerged {
+		if matches(p) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// IsTracked reports whether path is in the index, merged or not.
+func (idx *Index) IsTracked(path string) bool {
+	if _, ok := idx.Entries[path]; ok {
+		return true
+	}
+	_, ok := idx.Unmerged[path]
+	return ok
+}
+
+// SetStat records the metadata of the working file at path after its
+// content was found to match the entry.
+func (idx *Index) SetStat(path string, stat FileStat) {
+	if entry, ok := idx.Entries[path]; ok {
+		entry.Stat = &stat
+		idx.Entries[path] = entry
+	}
+}
+
+// IsStatClean reports whether the working file at path can be assumed to
+// match its entry without hashing it: the cached metadata must equal stat,
+// and the file must not have been modified or changed at or after the time
+// the index was written. Such racily clean files could have changed again
+// within the timestamp granularity, so they are always hashed.
+func (idx *Index) IsStatClean(path string, stat FileStat) bool {
+	entry, ok := idx.Entries[path]
+	if !ok || entry.Stat == nil {
+		return false
+	}
+	return *entry.Stat == stat && stat.MTime < idx.mtime && stat.CTime < idx.mtime
+}
+
+// isRacy reports whether the cached metadata of the entry records a change at
+// or after time t, in nanoseconds.
+func (e IndexEntry) isRacy(t int64) bool {
+	return e.Stat != nil && (e.Stat.MTime >= t || e.Stat.CTime >= t)
+}
+
+func (idx *Index) hasRacyEntries(t int64) bool {
+	for _, entry := range idx.Entries {
+		if entry.isRacy(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConflictedPaths returns the sorted paths still marked as unmerged.
+func (idx *Index) ConflictedPaths() []string {
+	paths := make([]string, 0, len(idx.Unmerged))
+	for path := range idx.Unmerged {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Stages returns the entry for each stage of an unmerged path, indexed by
+// stage number minus one.
+func (u UnmergedEntry) Stages() [3]*IndexEntry {
+	return [3]*IndexEntry{u.Base, u.Ours, u.Theirs}
 }
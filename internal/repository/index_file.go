@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+)
+
+// The index file uses Git's version 2 layout, all integers big-endian:
+//
+//	header     "DIRC", version (uint32), number of entries (uint32)
+//	entries    sorted by path, then stage
+//	extensions signature (4 bytes), size (uint32), data; optional ones,
+//	           whose signature starts with 'A'-'Z', may be skipped by readers
+//	checksum   SHA-1 of everything before it
+//
+// Each entry holds ctime and mtime (seconds and nanoseconds), dev, inode,
+// mode, uid, gid and size as uint32, the 20-byte object name, 16 bits of
+// flags (stage in bits 12-13, path length in bits 0-11) and the path,
+// NUL-padded to a multiple of 8 bytes.
+const (
+	indexSignature   = "DIRC"
+	indexVersion     = 2
+	indexHeaderSize  = 12
+	indexEntryFixed  = 62
+	indexChecksumLen = sha1.Size
+	indexNameMask    = 0x0fff
+)
+
+type stagedEntry struct {
+	entry IndexEntry
+	stage int
+}
+
+// encodeIndex serializes idx. Merged entries whose cached metadata shows a
+// change at or after racyFrom are written without it, so the file is hashed
+// again; pass math.MaxInt64 to keep all of it.
+func encodeIndex(idx *Index, racyFrom int64) ([]byte, error) {
+	var entries []stagedEntry
+	for _, entry := range idx.Entries {
+		if entry.isRacy(racyFrom) {
+			entry.Stat = nil
+		}
+		entries = append(entries, stagedEntry{entry: entry})
+	}
+	for path, unmerged := range idx.Unmerged {
+		for i, entry := range unmerged.Stages() {
+			if entry != nil {
+				staged := *entry
+				staged.Path = path
+				entries = append(entries, stagedEntry{entry: staged, stage: i + 1})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].entry.Path != entries[j].entry.Path {
+			return entries[i].entry.Path < entries[j].entry.Path
+		}
+		return entries[i].stage < entries[j].stage
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(indexSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(indexVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(len(entries)))
+
+	for _, staged := range entries {
+		if err := writeIndexEntry(&buf, staged.entry, staged.stage); err != nil {
+			return nil, err
+		}
+	}
+
+	checksum := sha1.Sum(buf.Bytes())
+	buf.Write(checksum[:])
+	return buf.Bytes(), nil
+}
+
+func writeIndexEntry(buf *bytes.Buffer, entry IndexEntry, stage int) error {
+	hash, err := hex.DecodeString(entry.Hash)
+	if err != nil || len(hash) != sha1.Size {
+		return fmt.Errorf("invalid object name %q for %s", entry.Hash, entry.Path)
+	}
+
+	var stat FileStat
+	if entry.Stat != nil {
+		stat = *entry.Stat
+	}
+
+	fields := []uint32{
+		uint32(stat.CTime / 1e9), uint32(stat.CTime % 1e9),
+		uint32(stat.MTime / 1e9), uint32(stat.MTime % 1e9),
+		0, // dev
+		stat.Inode,
+		entryModeBits(entry.Type),
+		0, 0, // uid, gid
+		stat.Size,
+	}
+	for _, field := range fields {
+		binary.Write(buf, binary.BigEndian, field)
+	}
+	buf.Write(hash)
+
+	flags := uint16(stage)<<12 | uint16(min(len(entry.Path), indexNameMask))
+	binary.Write(buf, binary.BigEndian, flags)
+	buf.WriteString(entry.Path)
+
+	// At least one NUL, padding the entry to a multiple of 8 bytes
+	entryLen := indexEntryFixed + len(entry.Path)
+	padding := 8 - entryLen%8
+	buf.Write(make([]byte, padding))
+	return nil
+}
+
+func decodeIndex(data []byte) (*Index, error) {
+	if len(data) < indexHeaderSize+indexChecksumLen {
+		return nil, fmt.Errorf("index file is too short")
+	}
+
+	body, checksum := data[:len(data)-indexChecksumLen], data[len(data)-indexChecksumLen:]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], checksum) {
+		return nil, fmt.Errorf("index file is corrupt: checksum mismatch")
+	}
+
+	if string(body[:4]) != indexSignature {
+		return nil, fmt.Errorf("bad index signature %q", body[:4])
+	}
+	version := binary.BigEndian.Uint32(body[4:8])
+	if version != indexVersion {
+		return nil, fmt.Errorf("unsupported index version %d", version)
+	}
+	count := binary.BigEndian.Uint32(body[8:12])
+
+	idx := NewIndex()
+	offset := indexHeaderSize
+	for i := uint32(0); i < count; i++ {
+		entry, stage, n, err := readIndexEntry(body[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		offset += n
+
+		if stage == 0 {
+			idx.Entries[entry.Path] = entry
+			continue
+		}
+		unmerged := idx.Unmerged[entry.Path]
+		switch stage {
+		case 1:
+			unmerged.Base = &entry
+		case 2:
+			unmerged.Ours = &entry
+		case 3:
+			unmerged.Theirs = &entry
+		}
+		idx.Unmerged[entry.Path] = unmerged
+	}
+
+	for offset < len(body) {
+		if len(body)-offset < 8 {
+			return nil, fmt.Errorf("truncated index extension")
+		}
+		signature := body[offset : offset+4]
+		size := int(binary.BigEndian.Uint32(body[offset+4 : offset+8]))
+		if len(body)-offset-8 < size {
+			return nil, fmt.Errorf("truncated index extension %q", signature)
+		}
+		if signature[0] < 'A' || signature[0] > 'Z' {
+			return nil, fmt.Errorf("unsupported index extension %q", signature)
+		}
+		offset += 8 + size
+	}
+
+	return idx, nil
+}
+
+func readIndexEntry(data []byte) (IndexEntry, int, int, error) {
+	if len(data) < indexEntryFixed {
+		return IndexEntry{}, 0, 0, fmt.Errorf("truncated entry")
+	}
+
+	field := func(i int) uint32 {
+		return binary.BigEndian.Uint32(data[i*4 : i*4+4])
+	}
+	stat := FileStat{
+		CTime: int64(field(0))*1e9 + int64(field(1)),
+		MTime: int64(field(2))*1e9 + int64(field(3)),
+		Inode: field(5),
+		Mode:  field(6),
+		Size:  field(9),
+	}
+
+	entryType, err := entryTypeFromModeBits(stat.Mode)
+	if err != nil {
+		return IndexEntry{}, 0, 0, err
+	}
+
+	flags := binary.BigEndian.Uint16(data[60:62])
+	stage := int(flags>>12) & 0x3
+
+	nameEnd := bytes.IndexByte(data[indexEntryFixed:], 0)
+	if nameEnd < 0 {
+		return IndexEntry{}, 0, 0, fmt.Errorf("unterminated path")
+	}
+	path := string(data[indexEntryFixed : indexEntryFixed+nameEnd])
+
+	entry := IndexEntry{
+		Path: path,
+		Hash: hex.EncodeToString(data[40:60]),
+		Type: entryType,
+	}
+	if stat.CTime != 0 || stat.MTime != 0 || stat.Inode != 0 || stat.Size != 0 {
+		entry.Stat = &stat
+	}
+
+	entryLen := indexEntryFixed + len(path)
+	entryLen += 8 - entryLen%8
+	if entryLen > len(data) {
+		return IndexEntry{}, 0, 0, fmt.Errorf("truncated entry for %s", path)
+	}
+	return entry, stage, entryLen, nil
+}
+
+// entryModeBits returns the mode stored in the index for an entry type,
+// which is also the mode recorded in the entry's FileStat.
+func entryModeBits(entryType tree.EntryType) uint32 {
+	switch entryType {
+	case tree.EntryTypeExecutable:
+		return 0o100755
+	case tree.EntryTypeSymlink:
+		return 0o120000
+	default:
+		return 0o100644
+	}
+}
+
+func entryTypeFromModeBits(mode uint32) (tree.EntryType, error) {
+	switch mode {
+	case 0o100644, 0o100664:
+		return tree.EntryTypeBlob, nil
+	case 0o100755:
+		return tree.EntryTypeExecutable, nil
+	case 0o120000:
+		return tree.EntryTypeSymlink, nil
+	default:
+		return 0, fmt.Errorf("invalid mode %o", mode)
+	}
+}
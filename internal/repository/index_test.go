@@ -1,10 +1,16 @@
 package repository_test
 
 import (
+	"crypto/sha1"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Gr1shma/notgit/internal/lockfile"
+	"github.com/Gr1shma/notgit/internal/objects/tree"
 	"github.com/Gr1shma/notgit/internal/repository"
 	"github.com/stretchr/testify/require"
 )
@@ -21,8 +27,8 @@ func TestNewIndex(t *testing.T) {
 	}
 
 	index := repository.NewIndex()
-	index.AddEntry("file.txt", "hash")
-	index.AddEntry("subdir/file.txt", "anotherhash")
+	index.AddEntry("file.txt", "1111111111111111111111111111111111111111")
+	index.AddEntry("subdir/file.txt", "2222222222222222222222222222222222222222")
 
 	err = repo.SaveIndex(index)
 	require.NoError(t, err)
@@ -31,6 +37,245 @@ func TestNewIndex(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Len(t, loadedIndex.Entries, 2)
-	require.Equal(t, "hash", loadedIndex.Entries["file.txt"].Hash)
-	require.Equal(t, "anotherhash", loadedIndex.Entries["subdir/file.txt"].Hash)
+	require.Equal(t, "1111111111111111111111111111111111111111", loadedIndex.Entries["file.txt"].Hash)
+	require.Equal(t, "2222222222222222222222222222222222222222", loadedIndex.Entries["subdir/file.txt"].Hash)
+}
+
+func TestIndexStatCache(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tempDir))
+	repo, err := repository.OpenRepository(tempDir)
+	require.NoError(t, err)
+
+	filePath := filepath.Join(tempDir, "file.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("content"), 0o644))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filePath, old, old))
+	info, err := os.Lstat(filePath)
+	require.NoError(t, err)
+	stat := repository.StatFromFileInfo(info)
+	require.Equal(t, uint32(7), stat.Size)
+
+	index := repository.NewIndex()
+	index.AddEntry("file.txt", "1111111111111111111111111111111111111111")
+	require.False(t, index.IsStatClean("file.txt", stat), "no cached stat yet")
+
+	index.SetStat("file.txt", stat)
+	require.NoError(t, repo.SaveIndex(index))
+	// Make sure the index is written strictly after the file was changed
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(repo.IndexPath(), later, later))
+
+	loaded, err := repo.LoadIndex()
+	require.NoError(t, err)
+	require.NotNil(t, loaded.Entries["file.txt"].Stat)
+	require.True(t, loaded.IsStatClean("file.txt", stat))
+
+	changed := stat
+	changed.Size++
+	require.False(t, loaded.IsStatClean("file.txt", changed))
+	require.False(t, loaded.IsStatClean("missing.txt", stat))
+
+	// A file modified after the index was written is racily clean and must
+	// be hashed even though its metadata matches
+	racy := stat
+	racy.MTime = later.Add(time.Second).UnixNano()
+	loaded.SetStat("file.txt", racy)
+	require.False(t, loaded.IsStatClean("file.txt", racy))
+}
+
+func TestSaveIndexSmudgesRacyEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tempDir))
+	repo, err := repository.OpenRepository(tempDir)
+	require.NoError(t, err)
+
+	statOf := func(name string, mtime time.Time) repository.FileStat {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(name), 0o644))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+		info, err := os.Lstat(path)
+		require.NoError(t, err)
+		return repository.StatFromFileInfo(info)
+	}
+	// On a file system with coarse timestamps, a file modified in the same
+	// tick as the index write shows the same time as the index
+	oldStat := statOf("old.txt", time.Now().Add(-time.Hour))
+	racyStat := statOf("racy.txt", time.Now().Add(time.Minute))
+
+	index := repository.NewIndex()
+	index.AddEntry("old.txt", "1111111111111111111111111111111111111111")
+	index.AddEntry("racy.txt", "2222222222222222222222222222222222222222")
+	index.SetStat("old.txt", oldStat)
+	index.SetStat("racy.txt", racyStat)
+	require.NoError(t, repo.SaveIndex(index))
+
+	// Even once the index is rewritten later, the racy entry is not trusted
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(repo.IndexPath(), later, later))
+	loaded, err := repo.LoadIndex()
+	require.NoError(t, err)
+	require.True(t, loaded.IsStatClean("old.txt", oldStat))
+	require.False(t, loaded.IsStatClean("racy.txt", racyStat))
+}
+
+func TestIndexFileRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tempDir))
+	repo, err := repository.OpenRepository(tempDir)
+	require.NoError(t, err)
+
+	base := &repository.IndexEntry{Path: "conflict.txt", Hash: "3333333333333333333333333333333333333333"}
+	ours := &repository.IndexEntry{Path: "conflict.txt", Hash: "4444444444444444444444444444444444444444", Type: tree.EntryTypeExecutable}
+
+	index := repository.NewIndex()
+	index.AddEntry("a.txt", "1111111111111111111111111111111111111111")
+	index.AddEntryWithType("a-path-long-enough-to-need-more-padding/link", "2222222222222222222222222222222222222222", tree.EntryTypeSymlink)
+	index.SetStat("a.txt", repository.FileStat{Size: 12, MTime: 1700000000123456789, CTime: 1700000001000000002, Inode: 42, Mode: 0o100644})
+	index.AddUnmerged("conflict.txt", base, ours, nil)
+	require.NoError(t, repo.SaveIndex(index))
+
+	data, err := os.ReadFile(repo.IndexPath())
+	require.NoError(t, err)
+	require.Equal(t, "DIRC", string(data[:4]))
+
+	loaded, err := repo.LoadIndex()
+	require.NoError(t, err)
+	require.Equal(t, index.Entries, loaded.Entries)
+	require.Equal(t, []string{"conflict.txt"}, loaded.ConflictedPaths())
+	require.Equal(t, base, loaded.Unmerged["conflict.txt"].Base)
+	require.Equal(t, ours, loaded.Unmerged["conflict.txt"].Ours)
+	require.Nil(t, loaded.Unmerged["conflict.txt"].Theirs)
+
+	// Adding the path again resolves the conflict
+	loaded.AddEntry("conflict.txt", "5555555555555555555555555555555555555555")
+	require.Empty(t, loaded.ConflictedPaths())
+
+	// A flipped bit is caught by the checksum
+	data[20] ^= 0xff
+	require.NoError(t, os.WriteFile(repo.IndexPath(), data, 0o644))
+	_, err = repo.LoadIndex()
+	require.ErrorContains(t, err, "checksum")
+}
+
+func TestIndexRemoveAndRename(t *testing.T) {
+	index := repository.NewIndex()
+	index.AddEntry("docs/a.txt", "1111111111111111111111111111111111111111")
+	index.AddEntryWithType("docs/sub/run.sh", "2222222222222222222222222222222222222222", tree.EntryTypeExecutable)
+	index.AddEntry("docs.txt", "3333333333333333333333333333333333333333")
+	index.AddUnmerged("docs/conflict.txt", nil, &repository.IndexEntry{Path: "docs/conflict.txt", Hash: "4444444444444444444444444444444444444444"}, nil)
+
+	require.Equal(t, []string{"docs/a.txt", "docs/conflict.txt", "docs/sub/run.sh"}, index.PathsUnder("docs"))
+	require.Equal(t, []string{"docs.txt"}, index.PathsUnder("docs.txt"))
+	require.Len(t, index.PathsUnder(""), 4)
+
+	require.NoError(t, index.RenameEntry("docs/sub/run.sh", "bin/run.sh"))
+	require.False(t, index.IsTracked("docs/sub/run.sh"))
+	require.Equal(t, repository.IndexEntry{Path: "bin/run.sh", Hash: "2222222222222222222222222222222222222222", Type: tree.EntryTypeExecutable}, index.Entries["bin/run.sh"])
+
+	require.ErrorContains(t, index.RenameEntry("docs/conflict.txt", "other.txt"), "unmerged")
+	require.ErrorContains(t, index.RenameEntry("missing.txt", "other.txt"), "not in the index")
+
+	index.RemoveEntry("docs/conflict.txt")
+	require.Empty(t, index.ConflictedPaths())
+	require.Equal(t, []string{"docs/a.txt"}, index.PathsUnder("docs"))
+}
+
+func TestIndexFileSkipsOptionalExtensions(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tempDir))
+	repo, err := repository.OpenRepository(tempDir)
+	require.NoError(t, err)
+
+	index := repository.NewIndex()
+	index.AddEntry("a.txt", "1111111111111111111111111111111111111111")
+	require.NoError(t, repo.SaveIndex(index))
+
+	data, err := os.ReadFile(repo.IndexPath())
+	require.NoError(t, err)
+	body := data[:len(data)-sha1.Size]
+
+	withExtension := func(signature string) []byte {
+		out := append([]byte(nil), body...)
+		out = append(out, signature...)
+		out = append(out, 0, 0, 0, 3, 'x', 'y', 'z')
+		sum := sha1.Sum(out)
+		return append(out, sum[:]...)
+	}
+
+	require.NoError(t, os.WriteFile(repo.IndexPath(), withExtension("TREE"), 0o644))
+	loaded, err := repo.LoadIndex()
+	require.NoError(t, err)
+	require.Equal(t, index.Entries, loaded.Entries)
+
+	require.NoError(t, os.WriteFile(repo.IndexPath(), withExtension("link"), 0o644))
+	_, err = repo.LoadIndex()
+	require.ErrorContains(t, err, "unsupported index extension")
+}
+
+func TestLoadIndexUpgradesJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tempDir))
+	repo, err := repository.OpenRepository(tempDir)
+	require.NoError(t, err)
+
+	legacy := `{
+  "entries": {
+    "a.txt": {"path": "a.txt", "hash": "1111111111111111111111111111111111111111"},
+    "run.sh": {"path": "run.sh", "hash": "2222222222222222222222222222222222222222", "type": 2},
+    "both.txt": {"path": "both.txt", "hash": "3333333333333333333333333333333333333333", "conflicted": true}
+  }
+}`
+	legacyPath := filepath.Join(repo.NotgitDir, "index.json")
+	require.NoError(t, os.WriteFile(legacyPath, []byte(legacy), 0o644))
+
+	index, err := repo.LoadIndex()
+	require.NoError(t, err)
+	require.Len(t, index.Entries, 2)
+	require.Equal(t, tree.EntryTypeExecutable, index.Entries["run.sh"].Type)
+	require.Equal(t, "3333333333333333333333333333333333333333", index.Unmerged["both.txt"].Ours.Hash)
+
+	require.NoFileExists(t, legacyPath)
+	require.FileExists(t, repo.IndexPath())
+}
+
+func TestLockIndexSerializesUpdates(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tempDir))
+	repo, err := repository.OpenRepository(tempDir)
+	require.NoError(t, err)
+
+	// Each writer adds its own entry; none may be lost to another's write
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			index, err := repo.LockIndex()
+			if err != nil {
+				errs <- err
+				return
+			}
+			index.AddEntry(fmt.Sprintf("file%d.txt", i), fmt.Sprintf("%040d", i))
+			time.Sleep(10 * time.Millisecond)
+			errs <- index.Commit()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	loaded, err := repo.LoadIndex()
+	require.NoError(t, err)
+	require.Len(t, loaded.Entries, 8)
+
+	// A held lock keeps other writers out until it is released
+	index, err := repo.LockIndex()
+	require.NoError(t, err)
+	require.ErrorIs(t, repo.SaveIndex(repository.NewIndex()), lockfile.ErrLocked)
+	require.NoError(t, index.Rollback())
+	require.NoError(t, repo.SaveIndex(repository.NewIndex()))
 }
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+)
+
+// IsAncestor reports whether ancestor is reachable from descendant through
+// any chain of parents (a commit counts as its own ancestor).
+func (r *Repository) IsAncestor(ancestor, descendant string) (bool, error) {
+	ancestors, err := r.ancestors(descendant)
+	if err != nil {
+		return false, err
+	}
+	return ancestors[ancestor], nil
+}
+
+// MergeBase returns the best common ancestor of two commits: a common
+// ancestor that is not itself an ancestor of another common ancestor. When
+// several exist (criss-cross history) the lowest hash is picked so the
+// result is stable. An empty string means the histories are unrelated.
+func (r *Repository) MergeBase(a, b string) (string, error) {
+	ancestorsA, err := r.ancestors(a)
+	if err != nil {
+		return "", err
+	}
+	ancestorsB, err := r.ancestors(b)
+	if err != nil {
+		return "", err
+	}
+
+	common := make(map[string]bool)
+	for hash := range ancestorsA {
+		if ancestorsB[hash] {
+			common[hash] = true
+		}
+	}
+
+	// Drop every common ancestor that is reachable from another one
+	redundant := make(map[string]bool)
+	for hash := range common {
+		if redundant[hash] {
+			continue
+		}
+		c, err := r.RetrieveCommit(hash)
+		if err != nil {
+			return "", fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+		pending := append([]string(nil), c.ParentHashes...)
+		for len(pending) > 0 {
+			current := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if redundant[current] {
+				continue
+			}
+			redundant[current] = true
+			parent, err := r.RetrieveCommit(current)
+			if err != nil {
+				return "", fmt.Errorf("failed to read commit %s: %w", current, err)
+			}
+			pending = append(pending, parent.ParentHashes...)
+		}
+	}
+
+	var best []string
+	for hash := range common {
+		if !redundant[hash] {
+			best = append(best, hash)
+		}
+	}
+	if len(best) == 0 {
+		return "", nil
+	}
+	sort.Strings(best)
+	return best[0], nil
+}
+
+// ancestors returns every commit reachable from the given commits, walking
+// the shared history only once.
+func (r *Repository) ancestors(hashes ...string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	pending := append([]string(nil), hashes...)
+
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if current == "" || seen[current] {
+			continue
+		}
+		seen[current] = true
+
+		c, err := r.RetrieveCommit(current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", current, err)
+		}
+		pending = append(pending, c.ParentHashes...)
+	}
+
+	return seen, nil
+}
+
+// UnreferencedCommits returns the commits reachable from hash that no ref
+// and none of the commits in keep can reach, i.e. those lost when HEAD
+// leaves hash. They are listed in the order they are found walking back
+// from hash.
+func (r *Repository) UnreferencedCommits(hash string, keep ...string) ([]string, error) {
+	refs, err := r.ListRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	roots := append([]string(nil), keep...)
+	for _, value := range refs {
+		if target, err := r.PeelTag(value); err == nil {
+			roots = append(roots, target)
+		}
+	}
+	var commits []string
+	for _, root := range roots {
+		if objectType, err := r.ObjectType(root); err == nil && objectType == "commit" {
+			commits = append(commits, root)
+		}
+	}
+	referenced, err := r.ancestors(commits...)
+	if err != nil {
+		return nil, err
+	}
+
+	var lost []string
+	seen := make(map[string]bool)
+	pending := []string{hash}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if current == "" || seen[current] || referenced[current] {
+			continue
+		}
+		seen[current] = true
+		lost = append(lost, current)
+
+		c, err := r.RetrieveCommit(current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", current, err)
+		}
+		pending = append(pending, c.ParentHashes...)
+	}
+	return lost, nil
+}
@@ -0,0 +1,75 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeBase(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	root := storeTestCommit(t, repo, map[string]string{"a.txt": "root"}, "root")
+	fork := storeTestCommit(t, repo, map[string]string{"a.txt": "fork"}, "fork", root)
+	left := storeTestCommit(t, repo, map[string]string{"a.txt": "left"}, "left", fork)
+	right := storeTestCommit(t, repo, map[string]string{"a.txt": "right"}, "right", fork)
+	merged := storeTestCommit(t, repo, map[string]string{"a.txt": "merged"}, "merged", left, right)
+	after := storeTestCommit(t, repo, map[string]string{"a.txt": "after"}, "after", right)
+	unrelated := storeTestCommit(t, repo, map[string]string{"b.txt": "other"}, "unrelated")
+
+	base, err := repo.MergeBase(left, right)
+	require.NoError(t, err)
+	require.Equal(t, fork, base)
+
+	base, err = repo.MergeBase(merged, after)
+	require.NoError(t, err)
+	require.Equal(t, right, base)
+
+	base, err = repo.MergeBase(left, merged)
+	require.NoError(t, err)
+	require.Equal(t, left, base)
+
+	base, err = repo.MergeBase(left, unrelated)
+	require.NoError(t, err)
+	require.Empty(t, base)
+
+	ok, err := repo.IsAncestor(root, merged)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = repo.IsAncestor(after, merged)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestUnreferencedCommits(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	root := storeTestCommit(t, repo, map[string]string{"a.txt": "root"}, "root")
+	main := storeTestCommit(t, repo, map[string]string{"a.txt": "main"}, "main", root)
+	first := storeTestCommit(t, repo, map[string]string{"a.txt": "first"}, "first", root)
+	second := storeTestCommit(t, repo, map[string]string{"a.txt": "second"}, "second", first)
+	require.NoError(t, repo.UpdateRef("refs/heads/main", main, commit.Signature{Name: "Tester", Email: "tester@example.com"}, "branch: Created"))
+
+	lost, err := repo.UnreferencedCommits(second)
+	require.NoError(t, err)
+	require.Equal(t, []string{second, first}, lost)
+
+	lost, err = repo.UnreferencedCommits(second, first)
+	require.NoError(t, err)
+	require.Equal(t, []string{second}, lost)
+
+	lost, err = repo.UnreferencedCommits(main)
+	require.NoError(t, err)
+	require.Empty(t, lost)
+}
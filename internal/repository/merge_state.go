@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/lockfile"
+)
+
+func (r *Repository) mergeHeadPath() string {
+	return filepath.Join(r.NotgitDir, "MERGE_HEAD")
+}
+
+func (r *Repository) mergeMsgPath() string {
+	return filepath.Join(r.NotgitDir, "MERGE_MSG")
+}
+
+// ReadMergeHead returns the commit being merged while a conflicted merge is
+// in progress, or an empty string otherwise.
+func (r *Repository) ReadMergeHead() (string, error) {
+	data, err := os.ReadFile(r.mergeHeadPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read MERGE_HEAD: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ReadMergeMessage returns the prepared message for the pending merge commit.
+func (r *Repository) ReadMergeMessage() (string, error) {
+	data, err := os.ReadFile(r.mergeMsgPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read MERGE_MSG: %w", err)
+	}
+	return string(data), nil
+}
+
+// WriteMergeState records an unfinished merge so that commit can conclude it.
+func (r *Repository) WriteMergeState(mergeHead, message string) error {
+	if err := lockfile.WriteFile(r.mergeHeadPath(), []byte(mergeHead+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write MERGE_HEAD: %w", err)
+	}
+	if err := lockfile.WriteFile(r.mergeMsgPath(), []byte(message), 0o644); err != nil {
+		return fmt.Errorf("failed to write MERGE_MSG: %w", err)
+	}
+	return nil
+}
+
+// ClearMergeState removes MERGE_HEAD and MERGE_MSG once a merge is concluded.
+func (r *Repository) ClearMergeState() error {
+	for _, path := range []string{r.mergeHeadPath(), r.mergeMsgPath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
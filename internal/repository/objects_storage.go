@@ -1,15 +1,20 @@
 package repository
 
 import (
+	"bytes"
+	"compress/zlib"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/Gr1shma/notgit/internal/objects"
 	"github.com/Gr1shma/notgit/internal/objects/blob"
 	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/objects/tag"
 	"github.com/Gr1shma/notgit/internal/objects/tree"
 )
 
@@ -25,7 +30,7 @@ func (r *Repository) StoreObject(obj objects.Object) (string, error) {
 	dir := filepath.Join(r.NotgitDir, "objects", hashStr[:2])
 	file := filepath.Join(dir, hashStr[2:])
 
-	if _, err := os.Stat(file); err == nil {
+	if r.HasObject(hashStr) {
 		return hashStr, nil
 	}
 
@@ -33,7 +38,14 @@ func (r *Repository) StoreObject(obj objects.Object) (string, error) {
 		return "", fmt.Errorf("failed to create object dir: %w", err)
 	}
 
-	if err := os.WriteFile(file, data, 0o644); err != nil {
+	compressed, err := compressObject(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to compress object: %w", err)
+	}
+
+	// Written under a temporary name so a crash never leaves a truncated
+	// object behind
+	if err := writeFileViaTemp(file, compressed); err != nil {
 		return "", fmt.Errorf("failed to write object file: %w", err)
 	}
 
@@ -41,7 +53,7 @@ func (r *Repository) StoreObject(obj objects.Object) (string, error) {
 }
 
 func (r *Repository) RetrieveBlob(hash string) (*blob.Blob, error) {
-	data, err := retrieveObject(r.NotgitDir, hash)
+	data, err := r.ReadObject(hash)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +62,7 @@ func (r *Repository) RetrieveBlob(hash string) (*blob.Blob, error) {
 }
 
 func (r *Repository) RetrieveTree(hash string) (*tree.Tree, error) {
-	data, err := retrieveObject(r.NotgitDir, hash)
+	data, err := r.ReadObject(hash)
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +71,7 @@ func (r *Repository) RetrieveTree(hash string) (*tree.Tree, error) {
 }
 
 func (r *Repository) RetrieveCommit(hash string) (*commit.Commit, error) {
-	data, err := retrieveObject(r.NotgitDir, hash)
+	data, err := r.ReadObject(hash)
 	if err != nil {
 		return nil, err
 	}
@@ -67,13 +79,163 @@ func (r *Repository) RetrieveCommit(hash string) (*commit.Commit, error) {
 	return commit.DeserializeCommit(data)
 }
 
+func (r *Repository) RetrieveTag(hash string) (*tag.Tag, error) {
+	data, err := r.ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return tag.DeserializeTag(data)
+}
+
+// ObjectType returns the type recorded in an object's header.
+func (r *Repository) ObjectType(hash string) (string, error) {
+	data, err := r.ReadObject(hash)
+	if err != nil {
+		return "", err
+	}
+	objectType, _, err := splitObject(data)
+	if err != nil {
+		return "", err
+	}
+	return objectType, nil
+}
+
+// ReadObject returns the uncompressed serialized form of an object
+// (header included).
+func (r *Repository) ReadObject(hash string) ([]byte, error) {
+	if len(hash) < 4 {
+		return nil, fmt.Errorf("invalid object hash: %s", hash)
+	}
+
+	objType, content, found, err := r.readPackedObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		header := fmt.Sprintf("%s %d\x00", objType, len(content))
+		return append([]byte(header), content...), nil
+	}
+
+	return retrieveObject(r.NotgitDir, hash)
+}
+
+// ReadLooseObject is like ReadObject but only looks at the loose copy,
+// ignoring packs.
+func (r *Repository) ReadLooseObject(hash string) ([]byte, error) {
+	if len(hash) < 4 {
+		return nil, fmt.Errorf("invalid object hash: %s", hash)
+	}
+	return retrieveObject(r.NotgitDir, hash)
+}
+
+// HasObject reports whether the object exists either loose or in a pack.
+func (r *Repository) HasObject(hash string) bool {
+	if len(hash) < 4 {
+		return false
+	}
+
+	if _, err := os.Stat(r.looseObjectPath(hash)); err == nil {
+		return true
+	}
+
+	packs, err := r.loadPacks()
+	if err != nil {
+		return false
+	}
+	for _, p := range packs {
+		if _, ok := p.find(hash); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LooseObjects returns the hashes of all objects stored as individual files.
+func (r *Repository) LooseObjects() ([]string, error) {
+	objectsDir := filepath.Join(r.NotgitDir, "objects")
+	dirs, err := os.ReadDir(objectsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read objects dir: %w", err)
+	}
+
+	var hashes []string
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(objectsDir, dir.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read objects dir: %w", err)
+		}
+		for _, file := range files {
+			if file.IsDir() || len(file.Name()) != 38 {
+				continue
+			}
+			hashes = append(hashes, dir.Name()+file.Name())
+		}
+	}
+	return hashes, nil
+}
+
+// RemoveLooseObject deletes the loose copy of an object, removing its
+// fan-out directory once it is empty.
+func (r *Repository) RemoveLooseObject(hash string) error {
+	objectPath := r.looseObjectPath(hash)
+	if err := os.Remove(objectPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove object %s: %w", hash, err)
+	}
+
+	dir := filepath.Dir(objectPath)
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+		os.Remove(dir)
+	}
+	return nil
+}
+
+func (r *Repository) looseObjectPath(hash string) string {
+	return filepath.Join(r.NotgitDir, "objects", hash[:2], hash[2:])
+}
+
 func retrieveObject(repoPath, hash string) ([]byte, error) {
 	objectPath := filepath.Join(repoPath, "objects", hash[:2], hash[2:])
 
 	data, err := os.ReadFile(objectPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read object file: %v", err)
+		return nil, fmt.Errorf("failed to read object file: %w", err)
 	}
 
-	return data, nil
+	return decompressObject(data)
+}
+
+func compressObject(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	w := zlib.NewWriter(&buffer)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Objects written before compression was introduced are stored raw. Their
+// first byte is the start of the type name, which never forms a valid zlib
+// header, so those files are returned unchanged.
+func decompressObject(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, zlib.ErrHeader) {
+			return data, nil
+		}
+		return nil, fmt.Errorf("failed to decompress object: %w", err)
+	}
+	defer zr.Close()
+
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress object: %w", err)
+	}
+	return content, nil
 }
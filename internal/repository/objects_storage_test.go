@@ -1,8 +1,11 @@
 package repository_test
 
 import (
+	"bytes"
+	"compress/zlib"
 	"crypto/sha1"
 	"encoding/hex"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -44,7 +47,13 @@ func TestStoreBlobObject(t *testing.T) {
 
 	storedData, err := os.ReadFile(objPath)
 	require.NoError(t, err)
-	require.Equal(t, serialized, storedData, "stored object data must match serialized")
+	require.NotEqual(t, serialized, storedData, "stored object data must be compressed")
+
+	zr, err := zlib.NewReader(bytes.NewReader(storedData))
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, serialized, decompressed, "decompressed object data must match serialized")
 
 	retrievedBlob, err := repo.RetrieveBlob(hashStr)
 	require.NoError(t, err)
@@ -147,3 +156,32 @@ func TestStoreCommitObject(t *testing.T) {
 	require.Equal(t, c.Committer.Email, retrievedCommit.Committer.Email, "committer email should match")
 	require.Equal(t, len(c.ParentHashes), len(retrievedCommit.ParentHashes), "parent hashes length should match")
 }
+
+func TestRetrieveUncompressedObject(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	err := repository.CreateRepo(tmpDir)
+	require.NoError(t, err)
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	bl, err := blob.NewBlob([]byte("written before compression"))
+	require.NoError(t, err)
+
+	serialized, err := bl.Serialize()
+	require.NoError(t, err)
+
+	// Simulate an object written by an older notgit that stored raw bytes
+	objPath := filepath.Join(repo.NotgitDir, "objects", bl.Hash[:2], bl.Hash[2:])
+	require.NoError(t, os.MkdirAll(filepath.Dir(objPath), 0o755))
+	require.NoError(t, os.WriteFile(objPath, serialized, 0o644))
+
+	data, err := repo.ReadObject(bl.Hash)
+	require.NoError(t, err)
+	require.Equal(t, serialized, data)
+
+	retrievedBlob, err := repo.RetrieveBlob(bl.Hash)
+	require.NoError(t, err)
+	require.Equal(t, bl.Content, retrievedBlob.Content)
+}
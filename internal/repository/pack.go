@@ -0,0 +1,720 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/lockfile"
+)
+
+// Packfile layout:
+//
+//	"PACK" | version (uint32) | object count (uint32)
+//	entries...
+//	SHA-1 of everything above
+//
+// Each entry starts with Git's type/size varint. Full objects are followed by
+// their zlib-compressed content (without the "type size\x00" header). An
+// OFS delta is followed by the encoded distance back to its base entry, a REF
+// delta by the 20-byte hash of its base, and both then by the zlib-compressed
+// delta instructions.
+//
+// The matching .idx file holds:
+//
+//	"\xfftOc" | version (uint32) | fanout table (256 x uint32)
+//	sorted object hashes (20 bytes each)
+//	CRC32 of each packed entry (uint32 each)
+//	offset of each entry in the pack (uint64 each)
+//	pack checksum | SHA-1 of everything above
+const (
+	packSignature  = "PACK"
+	packIdxMagic   = "\xfftOc"
+	packVersion    = 2
+	packDeltaWin   = 10
+	packDeltaDepth = 50
+	packMinDelta   = 32
+)
+
+const (
+	packObjCommit   = 1
+	packObjTree     = 2
+	packObjBlob     = 3
+	packObjTag      = 4
+	packObjOfsDelta = 6
+	packObjRefDelta = 7
+)
+
+type PackEntry struct {
+	Hash string
+	Path string // used only to group similar objects when choosing delta bases
+}
+
+type PackStats struct {
+	Name    string
+	Objects int
+	Deltas  int
+}
+
+type packIndex struct {
+	packPath string
+	packSum  []byte
+	hashes   []string
+	crcs     []uint32
+	offsets  []uint64
+}
+
+func (r *Repository) packDir() string {
+	return filepath.Join(r.NotgitDir, "objects", "pack")
+}
+
+func (r *Repository) loadPacks() ([]*packIndex, error) {
+	if r.packsLoaded {
+		return r.packs, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(r.packDir(), "pack-*.idx"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packs: %w", err)
+	}
+	sort.Strings(matches)
+
+	packs := make([]*packIndex, 0, len(matches))
+	for _, idxPath := range matches {
+		idx, err := readPackIndex(idxPath)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, idx)
+	}
+
+	r.packs = packs
+	r.packsLoaded = true
+	return packs, nil
+}
+
+func (r *Repository) invalidatePacks() {
+	r.packs = nil
+	r.packsLoaded = false
+}
+
+// PackedObjects returns the hashes of every object stored in a packfile.
+func (r *Repository) PackedObjects() ([]string, error) {
+	packs, err := r.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	for _, p := range packs {
+		hashes = append(hashes, p.hashes...)
+	}
+	return hashes, nil
+}
+
+// PackNames returns the base names of all packfiles, e.g. "pack-<sha>.pack".
+func (r *Repository) PackNames() ([]string, error) {
+	packs, err := r.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(packs))
+	for _, p := range packs {
+		names = append(names, filepath.Base(p.packPath))
+	}
+	return names, nil
+}
+
+// LockGC takes the lock held while gc repacks, so that two runs cannot
+// delete the packs the other is still reading from. It does not wait for a
+// running gc to finish.
+func (r *Repository) LockGC() (*lockfile.LockFile, error) {
+	lock, err := lockfile.AcquireWithTimeout(filepath.Join(r.NotgitDir, "gc"), 0)
+	if errors.Is(err, lockfile.ErrLocked) {
+		return nil, fmt.Errorf("gc is already running in this repository: %w", err)
+	}
+	return lock, err
+}
+
+// RemovePack deletes a packfile and its index.
+func (r *Repository) RemovePack(name string) error {
+	packPath := filepath.Join(r.packDir(), name)
+	idxPath := strings.TrimSuffix(packPath, ".pack") + ".idx"
+
+	// Drop the index first so a half-removed pack is never looked up
+	if err := os.Remove(idxPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove pack index %s: %w", idxPath, err)
+	}
+	if err := os.Remove(packPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove pack %s: %w", packPath, err)
+	}
+
+	r.invalidatePacks()
+	return nil
+}
+
+func (r *Repository) readPackedObject(hash string) (string, []byte, bool, error) {
+	packs, err := r.loadPacks()
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	for _, p := range packs {
+		offset, ok := p.find(hash)
+		if !ok {
+			continue
+		}
+
+		f, err := os.Open(p.packPath)
+		if err != nil {
+			return "", nil, false, fmt.Errorf("failed to open pack: %w", err)
+		}
+		defer f.Close()
+
+		objType, content, err := r.readPackEntry(f, offset, 0)
+		if err != nil {
+			return "", nil, false, fmt.Errorf("failed to read %s from %s: %w", hash, filepath.Base(p.packPath), err)
+		}
+		return objType, content, true, nil
+	}
+
+	return "", nil, false, nil
+}
+
+func (r *Repository) readPackEntry(f *os.File, offset uint64, depth int) (string, []byte, error) {
+	if depth > packDeltaDepth {
+		return "", nil, fmt.Errorf("delta chain too deep")
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(f, int64(offset), 1<<62))
+	typeCode, size, err := readPackEntryHeader(reader)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch typeCode {
+	case packObjCommit, packObjTree, packObjBlob, packObjTag:
+		content, err := inflate(reader, size)
+		if err != nil {
+			return "", nil, err
+		}
+		return packTypeName(typeCode), content, nil
+
+	case packObjOfsDelta:
+		distance, err := readOfsDistance(reader)
+		if err != nil {
+			return "", nil, err
+		}
+		if distance == 0 || distance > offset {
+			return "", nil, fmt.Errorf("invalid delta base offset")
+		}
+		delta, err := inflate(reader, size)
+		if err != nil {
+			return "", nil, err
+		}
+		baseType, base, err := r.readPackEntry(f, offset-distance, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		content, err := applyDelta(base, delta)
+		if err != nil {
+			return "", nil, err
+		}
+		return baseType, content, nil
+
+	case packObjRefDelta:
+		var baseHash [20]byte
+		if _, err := io.ReadFull(reader, baseHash[:]); err != nil {
+			return "", nil, fmt.Errorf("truncated delta base hash: %w", err)
+		}
+		delta, err := inflate(reader, size)
+		if err != nil {
+			return "", nil, err
+		}
+		baseData, err := r.ReadObject(hex.EncodeToString(baseHash[:]))
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read delta base: %w", err)
+		}
+		baseType, base, err := splitObject(baseData)
+		if err != nil {
+			return "", nil, err
+		}
+		content, err := applyDelta(base, delta)
+		if err != nil {
+			return "", nil, err
+		}
+		return baseType, content, nil
+
+	default:
+		return "", nil, fmt.Errorf("unknown pack entry type %d", typeCode)
+	}
+}
+
+type packCandidate struct {
+	hash     string
+	path     string
+	typeCode int
+	content  []byte
+	depth    int
+}
+
+// WritePack stores the given objects in a new packfile, delta-compressing
+// similar objects against each other. Loose copies are left untouched.
+func (r *Repository) WritePack(entries []PackEntry) (*PackStats, error) {
+	seen := make(map[string]bool)
+	candidates := make([]*packCandidate, 0, len(entries))
+	for _, entry := range entries {
+		if seen[entry.Hash] {
+			continue
+		}
+		seen[entry.Hash] = true
+
+		data, err := r.ReadObject(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object %s: %w", entry.Hash, err)
+		}
+		objType, content, err := splitObject(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object %s: %w", entry.Hash, err)
+		}
+		typeCode, err := packTypeCode(objType)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, &packCandidate{
+			hash:     entry.Hash,
+			path:     entry.Path,
+			typeCode: typeCode,
+			content:  content,
+		})
+	}
+
+	// Like Git, order by type, then file name, then size (largest first) so
+	// that objects likely to share content sit next to each other and newer,
+	// usually larger versions become the bases.
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.typeCode != b.typeCode {
+			return a.typeCode < b.typeCode
+		}
+		if path.Base(a.path) != path.Base(b.path) {
+			return path.Base(a.path) < path.Base(b.path)
+		}
+		if len(a.content) != len(b.content) {
+			return len(a.content) > len(b.content)
+		}
+		return a.hash < b.hash
+	})
+
+	// The pack is streamed to a temporary file and only named once its
+	// checksum is known
+	if err := os.MkdirAll(r.packDir(), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create pack dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(r.packDir(), ".tmp-pack-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pack: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	packHash := sha1.New()
+	pack := &countingWriter{w: bufio.NewWriter(io.MultiWriter(tmp, packHash))}
+	var header bytes.Buffer
+	header.WriteString(packSignature)
+	binary.Write(&header, binary.BigEndian, uint32(packVersion))
+	binary.Write(&header, binary.BigEndian, uint32(len(candidates)))
+	if _, err := pack.Write(header.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	stats := &PackStats{Objects: len(candidates)}
+	offsets := make(map[string]uint64, len(candidates))
+	crcs := make(map[string]uint32, len(candidates))
+
+	for i, obj := range candidates {
+		var base *packCandidate
+		var bestDelta []byte
+		if len(obj.content) >= packMinDelta {
+			for j := i - 1; j >= 0 && j >= i-packDeltaWin; j-- {
+				other := candidates[j]
+				if other.typeCode != obj.typeCode || other.depth >= packDeltaDepth {
+					continue
+				}
+				delta := createDelta(other.content, obj.content)
+				if len(delta) >= len(obj.content)/2 {
+					continue
+				}
+				if bestDelta == nil || len(delta) < len(bestDelta) {
+					base, bestDelta = other, delta
+				}
+			}
+		}
+
+		offset := pack.n
+		var entry bytes.Buffer
+		var payload []byte
+		if base != nil {
+			obj.depth = base.depth + 1
+			entry.Write(encodePackEntryHeader(packObjOfsDelta, len(bestDelta)))
+			entry.Write(encodeOfsDistance(offset - offsets[base.hash]))
+			payload = bestDelta
+			stats.Deltas++
+		} else {
+			entry.Write(encodePackEntryHeader(obj.typeCode, len(obj.content)))
+			payload = obj.content
+		}
+		compressed, err := compressObject(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress object %s: %w", obj.hash, err)
+		}
+		entry.Write(compressed)
+
+		offsets[obj.hash] = offset
+		crcs[obj.hash] = crc32.ChecksumIEEE(entry.Bytes())
+		if _, err := pack.Write(entry.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to write pack: %w", err)
+		}
+	}
+
+	if err := pack.w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write pack: %w", err)
+	}
+	packSum := packHash.Sum(nil)
+	if _, err := tmp.Write(packSum); err != nil {
+		return nil, fmt.Errorf("failed to write pack: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	packName := "pack-" + hex.EncodeToString(packSum)
+	packPath := filepath.Join(r.packDir(), packName+".pack")
+	if err := os.Rename(tmp.Name(), packPath); err != nil {
+		return nil, fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	idxData := encodePackIndex(offsets, crcs, packSum)
+	idxPath := filepath.Join(r.packDir(), packName+".idx")
+	if err := writeFileViaTemp(idxPath, idxData); err != nil {
+		return nil, fmt.Errorf("failed to write pack index: %w", err)
+	}
+
+	r.invalidatePacks()
+	stats.Name = packName + ".pack"
+	return stats, nil
+}
+
+// countingWriter counts the bytes written, which gives the offset of the
+// next pack entry.
+type countingWriter struct {
+	w *bufio.Writer
+	n uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+func encodePackIndex(offsets map[string]uint64, crcs map[string]uint32, packSum []byte) []byte {
+	hashes := make([]string, 0, len(offsets))
+	for hash := range offsets {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	var fanout [256]uint32
+	raw := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		raw[i], _ = hex.DecodeString(hash)
+		for b := int(raw[i][0]); b < 256; b++ {
+			fanout[b]++
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(packIdxMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(packVersion))
+	binary.Write(&buf, binary.BigEndian, fanout)
+	for _, h := range raw {
+		buf.Write(h)
+	}
+	for _, hash := range hashes {
+		binary.Write(&buf, binary.BigEndian, crcs[hash])
+	}
+	for _, hash := range hashes {
+		binary.Write(&buf, binary.BigEndian, offsets[hash])
+	}
+	buf.Write(packSum)
+
+	idxSum := sha1.Sum(buf.Bytes())
+	buf.Write(idxSum[:])
+	return buf.Bytes()
+}
+
+func readPackIndex(idxPath string) (*packIndex, error) {
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pack index: %w", err)
+	}
+
+	const headerLen = 4 + 4 + 256*4
+	if len(data) < headerLen+2*sha1.Size || string(data[:4]) != packIdxMagic {
+		return nil, fmt.Errorf("invalid pack index %s", filepath.Base(idxPath))
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != packVersion {
+		return nil, fmt.Errorf("unsupported pack index version %d", version)
+	}
+
+	body := data[:len(data)-sha1.Size]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], data[len(body):]) {
+		return nil, fmt.Errorf("pack index %s checksum mismatch", filepath.Base(idxPath))
+	}
+
+	count := int(binary.BigEndian.Uint32(data[8+255*4 : headerLen]))
+	if len(data) != headerLen+count*(sha1.Size+4+8)+2*sha1.Size {
+		return nil, fmt.Errorf("pack index %s is truncated", filepath.Base(idxPath))
+	}
+
+	idx := &packIndex{
+		packPath: strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		hashes:   make([]string, count),
+		crcs:     make([]uint32, count),
+		offsets:  make([]uint64, count),
+	}
+
+	pos := headerLen
+	for i := 0; i < count; i++ {
+		idx.hashes[i] = hex.EncodeToString(data[pos : pos+sha1.Size])
+		pos += sha1.Size
+	}
+	for i := 0; i < count; i++ {
+		idx.crcs[i] = binary.BigEndian.Uint32(data[pos:])
+		pos += 4
+	}
+	for i := 0; i < count; i++ {
+		idx.offsets[i] = binary.BigEndian.Uint64(data[pos:])
+		pos += 8
+	}
+	idx.packSum = data[pos : pos+sha1.Size]
+
+	return idx, nil
+}
+
+// VerifyPack checks a packfile against its trailing checksum and the CRC32
+// of every entry recorded in its index.
+func (r *Repository) VerifyPack(name string) error {
+	packs, err := r.loadPacks()
+	if err != nil {
+		return err
+	}
+
+	var idx *packIndex
+	for _, p := range packs {
+		if filepath.Base(p.packPath) == name {
+			idx = p
+			break
+		}
+	}
+	if idx == nil {
+		return fmt.Errorf("pack %s not found", name)
+	}
+
+	data, err := os.ReadFile(idx.packPath)
+	if err != nil {
+		return fmt.Errorf("failed to read pack: %w", err)
+	}
+	if len(data) < 12+sha1.Size || string(data[:4]) != packSignature {
+		return fmt.Errorf("%s is not a valid packfile", name)
+	}
+
+	body := data[:len(data)-sha1.Size]
+	sum := sha1.Sum(body)
+	if !bytes.Equal(sum[:], data[len(body):]) {
+		return fmt.Errorf("%s checksum mismatch", name)
+	}
+	if !bytes.Equal(sum[:], idx.packSum) {
+		return fmt.Errorf("%s does not match its index", name)
+	}
+	if count := binary.BigEndian.Uint32(data[8:12]); int(count) != len(idx.hashes) {
+		return fmt.Errorf("%s holds %d objects but its index lists %d", name, count, len(idx.hashes))
+	}
+
+	order := make([]int, len(idx.offsets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return idx.offsets[order[a]] < idx.offsets[order[b]]
+	})
+
+	for n, i := range order {
+		end := uint64(len(body))
+		if n+1 < len(order) {
+			end = idx.offsets[order[n+1]]
+		}
+		start := idx.offsets[i]
+		if start >= end || end > uint64(len(body)) {
+			return fmt.Errorf("%s has an invalid offset for %s", name, idx.hashes[i])
+		}
+		if crc32.ChecksumIEEE(body[start:end]) != idx.crcs[i] {
+			return fmt.Errorf("%s has a corrupt entry for %s", name, idx.hashes[i])
+		}
+	}
+
+	return nil
+}
+
+func (p *packIndex) find(hash string) (uint64, bool) {
+	i := sort.SearchStrings(p.hashes, hash)
+	if i < len(p.hashes) && p.hashes[i] == hash {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+func encodePackEntryHeader(typeCode, size int) []byte {
+	b := byte(typeCode<<4) | byte(size&0x0f)
+	size >>= 4
+
+	var buf []byte
+	for size > 0 {
+		buf = append(buf, b|0x80)
+		b = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(buf, b)
+}
+
+func readPackEntryHeader(reader io.ByteReader) (int, int, error) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, 0, fmt.Errorf("truncated pack entry: %w", err)
+	}
+
+	typeCode := int(b>>4) & 0x07
+	size := int(b & 0x0f)
+	shift := 4
+	for b&0x80 != 0 {
+		if b, err = reader.ReadByte(); err != nil {
+			return 0, 0, fmt.Errorf("truncated pack entry: %w", err)
+		}
+		size |= int(b&0x7f) << shift
+		shift += 7
+	}
+	return typeCode, size, nil
+}
+
+// The distance to an OFS delta's base uses Git's encoding, where each
+// continuation byte also adds one so that every value has a single encoding.
+func encodeOfsDistance(distance uint64) []byte {
+	buf := []byte{byte(distance & 0x7f)}
+	for distance >>= 7; distance > 0; distance >>= 7 {
+		distance--
+		buf = append([]byte{byte(0x80 | distance&0x7f)}, buf...)
+	}
+	return buf
+}
+
+func readOfsDistance(reader io.ByteReader) (uint64, error) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("truncated delta offset: %w", err)
+	}
+
+	distance := uint64(b & 0x7f)
+	for b&0x80 != 0 {
+		if b, err = reader.ReadByte(); err != nil {
+			return 0, fmt.Errorf("truncated delta offset: %w", err)
+		}
+		distance = ((distance + 1) << 7) | uint64(b&0x7f)
+	}
+	return distance, nil
+}
+
+func inflate(reader io.Reader, size int) ([]byte, error) {
+	zr, err := zlib.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inflate pack entry: %w", err)
+	}
+	defer zr.Close()
+
+	content := make([]byte, size)
+	if _, err := io.ReadFull(zr, content); err != nil {
+		return nil, fmt.Errorf("failed to inflate pack entry: %w", err)
+	}
+	return content, nil
+}
+
+func packTypeCode(objType string) (int, error) {
+	switch objType {
+	case "commit":
+		return packObjCommit, nil
+	case "tree":
+		return packObjTree, nil
+	case "blob":
+		return packObjBlob, nil
+	case "tag":
+		return packObjTag, nil
+	default:
+		return 0, fmt.Errorf("cannot pack object of type %s", objType)
+	}
+}
+
+func packTypeName(typeCode int) string {
+	switch typeCode {
+	case packObjCommit:
+		return "commit"
+	case packObjTree:
+		return "tree"
+	case packObjTag:
+		return "tag"
+	default:
+		return "blob"
+	}
+}
+
+func splitObject(data []byte) (string, []byte, error) {
+	nullIndex := bytes.IndexByte(data, 0)
+	if nullIndex == -1 {
+		return "", nil, fmt.Errorf("invalid object format: missing null byte separator")
+	}
+
+	objType, _, found := strings.Cut(string(data[:nullIndex]), " ")
+	if !found {
+		return "", nil, fmt.Errorf("invalid object header: %s", data[:nullIndex])
+	}
+	return objType, data[nullIndex+1:], nil
+}
+
+func writeFileViaTemp(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
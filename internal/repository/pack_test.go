@@ -0,0 +1,151 @@
+package repository_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gr1shma/notgit/internal/objects/blob"
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePackAndReadBack(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	// Successive versions of one file share most of their content
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("line %d of a fairly ordinary text file", i))
+	}
+
+	var entries []repository.PackEntry
+	blobs := make(map[string]*blob.Blob)
+	for version := 0; version < 5; version++ {
+		lines[version*10] = fmt.Sprintf("edited in version %d", version)
+		b, err := blob.NewBlob([]byte(strings.Join(lines, "\n")))
+		require.NoError(t, err)
+		hash, err := repo.StoreObject(b)
+		require.NoError(t, err)
+
+		blobs[hash] = b
+		entries = append(entries, repository.PackEntry{Hash: hash, Path: "notes.txt"})
+	}
+
+	author := commit.Signature{Name: "Tester", Email: "tester@example.com", Time: time.Unix(1700000000, 0)}
+	c := commit.NewCommit("4b825dc642cb6eb9a060e54bf8d69288fbee4904", "packed commit", nil, author, author)
+	require.NoError(t, c.ComputeHash())
+	_, err = repo.StoreObject(c)
+	require.NoError(t, err)
+	entries = append(entries, repository.PackEntry{Hash: c.Hash})
+
+	stats, err := repo.WritePack(entries)
+	require.NoError(t, err)
+	require.Equal(t, 6, stats.Objects)
+	require.Greater(t, stats.Deltas, 0, "similar blobs should be stored as deltas")
+	require.NoError(t, repo.VerifyPack(stats.Name))
+	packFiles, err := os.ReadDir(filepath.Join(repo.NotgitDir, "objects", "pack"))
+	require.NoError(t, err)
+	require.Len(t, packFiles, 2, "only the pack and its index should be left")
+
+	for _, entry := range entries {
+		require.NoError(t, repo.RemoveLooseObject(entry.Hash))
+	}
+
+	loose, err := repo.LooseObjects()
+	require.NoError(t, err)
+	require.Empty(t, loose)
+
+	packed, err := repo.PackedObjects()
+	require.NoError(t, err)
+	require.Len(t, packed, 6)
+
+	for hash, b := range blobs {
+		require.True(t, repo.HasObject(hash))
+		retrieved, err := repo.RetrieveBlob(hash)
+		require.NoError(t, err)
+		require.Equal(t, b.Content, retrieved.Content)
+	}
+
+	retrievedCommit, err := repo.RetrieveCommit(c.Hash)
+	require.NoError(t, err)
+	require.Equal(t, c.Hash, retrievedCommit.Hash)
+	require.Equal(t, "packed commit", retrievedCommit.Message)
+}
+
+func TestStoreObjectSkipsPackedObjects(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	b, err := blob.NewBlob([]byte("already packed"))
+	require.NoError(t, err)
+	hash, err := repo.StoreObject(b)
+	require.NoError(t, err)
+
+	_, err = repo.WritePack([]repository.PackEntry{{Hash: hash}})
+	require.NoError(t, err)
+	require.NoError(t, repo.RemoveLooseObject(hash))
+
+	storedAgain, err := repo.StoreObject(b)
+	require.NoError(t, err)
+	require.Equal(t, hash, storedAgain)
+
+	loose, err := repo.LooseObjects()
+	require.NoError(t, err)
+	require.Empty(t, loose, "object already in a pack should not be written loose again")
+}
+
+func TestVerifyPackDetectsCorruption(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	b, err := blob.NewBlob([]byte("content that will be damaged on disk"))
+	require.NoError(t, err)
+	hash, err := repo.StoreObject(b)
+	require.NoError(t, err)
+
+	stats, err := repo.WritePack([]repository.PackEntry{{Hash: hash}})
+	require.NoError(t, err)
+	require.NoError(t, repo.VerifyPack(stats.Name))
+
+	// Flip a byte inside the first entry
+	packPath := filepath.Join(repo.NotgitDir, "objects", "pack", stats.Name)
+	data, err := os.ReadFile(packPath)
+	require.NoError(t, err)
+	data[14] ^= 0xff
+	require.NoError(t, os.WriteFile(packPath, data, 0o644))
+
+	require.Error(t, repo.VerifyPack(stats.Name))
+}
+
+func TestLockGC(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	lock, err := repo.LockGC()
+	require.NoError(t, err)
+	_, err = repo.LockGC()
+	require.ErrorContains(t, err, "gc is already running")
+
+	require.NoError(t, lock.Rollback())
+	lock, err = repo.LockGC()
+	require.NoError(t, err)
+	require.NoError(t, lock.Rollback())
+}
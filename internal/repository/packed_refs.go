@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/lockfile"
+)
+
+// packedRefsHeader is the first line of the packed-refs file, in Git's
+// format: refs are sorted and annotated tags are followed by a "^<hash>"
+// line naming the object they peel to.
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+func (s *RefStore) packedRefsPath() string {
+	return filepath.Join(s.repo.NotgitDir, "packed-refs")
+}
+
+// readPackedRefs returns the refs stored in the packed-refs file keyed by
+// full name. A missing file holds no refs.
+func (s *RefStore) readPackedRefs() (map[string]string, error) {
+	refs := make(map[string]string)
+	data, err := os.ReadFile(s.packedRefsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return refs, nil
+		}
+		return nil, fmt.Errorf("failed to read packed-refs: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok || len(hash) != 40 || !isHex(hash) || ValidateRefName(name) != nil {
+			return nil, fmt.Errorf("invalid line %d in packed-refs: %q", lineNo, line)
+		}
+		refs[name] = hash
+	}
+	return refs, scanner.Err()
+}
+
+// writePackedRefs replaces the content of the packed-refs file, whose lock
+// the caller holds.
+func (s *RefStore) writePackedRefs(lock *lockfile.LockFile, refs map[string]string) error {
+	var sb strings.Builder
+	sb.WriteString(packedRefsHeader)
+	for _, name := range slices.Sorted(maps.Keys(refs)) {
+		hash := refs[name]
+		fmt.Fprintf(&sb, "%s %s\n", hash, name)
+		if objectType, err := s.repo.ObjectType(hash); err == nil && objectType == "tag" {
+			if peeled, err := s.repo.PeelTag(hash); err == nil {
+				fmt.Fprintf(&sb, "^%s\n", peeled)
+			}
+		}
+	}
+
+	if _, err := lock.Write([]byte(sb.String())); err != nil {
+		return fmt.Errorf("failed to write packed-refs: %w", err)
+	}
+	return lock.Commit(0o644)
+}
+
+// removePacked drops refs from the packed-refs file, so that deleting their
+// loose file really deletes them.
+func (s *RefStore) removePacked(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(s.packedRefsPath()); os.IsNotExist(err) {
+		return nil
+	}
+
+	lock, err := lockfile.Acquire(s.packedRefsPath())
+	if err != nil {
+		return fmt.Errorf("cannot lock packed-refs: %w", err)
+	}
+	defer lock.Rollback()
+
+	refs, err := s.readPackedRefs()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, name := range names {
+		if _, ok := refs[name]; ok {
+			delete(refs, name)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.writePackedRefs(lock, refs)
+}
+
+// Pack moves loose refs into the packed-refs file and deletes the loose
+// files, returning the number of refs packed. Only tags and refs that are
+// already packed are moved unless all is set; symbolic refs stay loose.
+func (s *RefStore) Pack(all bool) (int, error) {
+	lock, err := lockfile.Acquire(s.packedRefsPath())
+	if err != nil {
+		return 0, fmt.Errorf("cannot lock packed-refs: %w", err)
+	}
+	defer lock.Rollback()
+
+	packed, err := s.readPackedRefs()
+	if err != nil {
+		return 0, err
+	}
+	loose, err := s.repo.looseRefs()
+	if err != nil {
+		return 0, err
+	}
+
+	moved := make(map[string]string)
+	for name, content := range loose {
+		_, wasPacked := packed[name]
+		if len(content) != 40 || !isHex(content) || !(all || wasPacked || strings.HasPrefix(name, "refs/tags/")) {
+			continue
+		}
+		packed[name] = content
+		moved[name] = content
+	}
+	if err := s.writePackedRefs(lock, packed); err != nil {
+		return 0, err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(moved)) {
+		if err := s.pruneLooseRef(name, moved[name]); err != nil {
+			return 0, err
+		}
+	}
+	return len(moved), nil
+}
+
+// pruneLooseRef deletes the loose file of a packed ref, unless it was
+// updated since it was packed.
+func (s *RefStore) pruneLooseRef(name, hash string) error {
+	path := s.refPath(name)
+	lock, err := lockfile.Acquire(path)
+	if err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %w", name, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil && strings.TrimSpace(string(data)) == hash {
+		if err := os.Remove(path); err != nil {
+			lock.Rollback()
+			return fmt.Errorf("failed to delete loose ref %s: %w", name, err)
+		}
+	}
+	lock.Rollback()
+	pruneEmptyDirs(filepath.Dir(path), filepath.Join(s.repo.NotgitDir, "refs"))
+	return nil
+}
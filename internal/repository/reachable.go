@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+)
+
+// ReachableObjects walks commits, trees and blobs starting from the given
+// commit or tag hashes and returns every object found, mapped to the path it
+// was first seen at (empty for tags, commits and root trees).
+func (r *Repository) ReachableObjects(commitHashes []string) (map[string]string, error) {
+	reachable := make(map[string]string)
+	pending := append([]string(nil), commitHashes...)
+
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if hash == "" {
+			continue
+		}
+		if _, seen := reachable[hash]; seen {
+			continue
+		}
+		objectType, err := r.ObjectType(hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object %s: %w", hash, err)
+		}
+		if objectType == "tree" || objectType == "blob" {
+			if err := r.markObjectReachable(hash, objectType, reachable); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		reachable[hash] = ""
+
+		if objectType == "tag" {
+			t, err := r.RetrieveTag(hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tag %s: %w", hash, err)
+			}
+			if t.ObjectType == "commit" || t.ObjectType == "tag" {
+				pending = append(pending, t.Object)
+			} else if err := r.markObjectReachable(t.Object, t.ObjectType, reachable); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		c, err := r.RetrieveCommit(hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+		if err := r.markTreeReachable(c.TreeHash, "", reachable); err != nil {
+			return nil, err
+		}
+		pending = append(pending, c.ParentHashes...)
+	}
+
+	return reachable, nil
+}
+
+func (r *Repository) markObjectReachable(hash, objectType string, reachable map[string]string) error {
+	if objectType == "tree" {
+		return r.markTreeReachable(hash, "", reachable)
+	}
+	if _, seen := reachable[hash]; !seen {
+		reachable[hash] = ""
+	}
+	return nil
+}
+
+func (r *Repository) markTreeReachable(treeHash, prefix string, reachable map[string]string) error {
+	if _, seen := reachable[treeHash]; seen {
+		return nil
+	}
+	reachable[treeHash] = prefix
+
+	t, err := r.RetrieveTree(treeHash)
+	if err != nil {
+		return fmt.Errorf("failed to read tree %s: %w", treeHash, err)
+	}
+
+	for _, entry := range t.Entries {
+		entryPath := path.Join(prefix, entry.Name)
+		if entry.Type == tree.EntryTypeTree {
+			if err := r.markTreeReachable(entry.Hash, entryPath, reachable); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, seen := reachable[entry.Hash]; !seen {
+			reachable[entry.Hash] = entryPath
+		}
+	}
+
+	return nil
+}
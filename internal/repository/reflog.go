@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/lockfile"
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+)
+
+type ReflogEntry struct {
+	OldHash   string
+	NewHash   string
+	Committer commit.Signature
+	Message   string
+}
+
+// ZeroHash stands for a missing ref in reflogs and ref updates.
+const ZeroHash = "0000000000000000000000000000000000000000"
+
+func (r *Repository) reflogPath(ref string) string {
+	return filepath.Join(r.NotgitDir, "logs", filepath.FromSlash(ref))
+}
+
+// AppendReflog records an update of ref (e.g. "HEAD" or "refs/heads/master")
+// in .notgit/logs, one line per update in Git's reflog format.
+func (r *Repository) AppendReflog(ref string, entry ReflogEntry) error {
+	logPath := r.reflogPath(ref)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create reflog dir: %w", err)
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open reflog: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(formatReflogEntry(entry)); err != nil {
+		return fmt.Errorf("failed to write reflog: %w", err)
+	}
+	return nil
+}
+
+// WriteReflog replaces the whole reflog of ref, e.g. after expiring entries.
+func (r *Repository) WriteReflog(ref string, entries []ReflogEntry) error {
+	var sb strings.Builder
+	for _, entry := range entries {
+		sb.WriteString(formatReflogEntry(entry))
+	}
+
+	if err := lockfile.WriteFile(r.reflogPath(ref), []byte(sb.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write reflog: %w", err)
+	}
+	return nil
+}
+
+// RenameReflog moves the reflog of oldRef to newRef, as done when a branch
+// is renamed. A missing reflog is not an error.
+func (r *Repository) RenameReflog(oldRef, newRef string) error {
+	// Moved aside first, as the new name may be a directory of the old one
+	oldPath := r.reflogPath(oldRef)
+	tmpPath := filepath.Join(r.NotgitDir, "logs", ".tmp-renamed-log")
+	if err := os.Rename(oldPath, tmpPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to rename reflog: %w", err)
+	}
+	pruneEmptyDirs(filepath.Dir(oldPath), filepath.Join(r.NotgitDir, "logs", "refs"))
+
+	newPath := r.reflogPath(newRef)
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create reflog dir: %w", err)
+	}
+	if err := os.Rename(tmpPath, newPath); err != nil {
+		return fmt.Errorf("failed to rename reflog: %w", err)
+	}
+	return nil
+}
+
+// DeleteReflog removes the reflog of a deleted ref.
+func (r *Repository) DeleteReflog(ref string) error {
+	logPath := r.reflogPath(ref)
+	if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete reflog: %w", err)
+	}
+	pruneEmptyDirs(filepath.Dir(logPath), filepath.Join(r.NotgitDir, "logs", "refs"))
+	return nil
+}
+
+// ReflogRefs returns the names of all refs that have a reflog, sorted.
+func (r *Repository) ReflogRefs() ([]string, error) {
+	logsDir := filepath.Join(r.NotgitDir, "logs")
+
+	var refs []string
+	err := filepath.WalkDir(logsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		// Skip lock files and logs being renamed
+		if d.IsDir() || strings.HasSuffix(path, ".lock") || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		relPath, err := filepath.Rel(logsDir, path)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reflogs: %w", err)
+	}
+
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// ReflogHashes returns every hash recorded in any reflog, so that gc and
+// fsck can treat commits only reachable through a reflog as live.
+func (r *Repository) ReflogHashes() ([]string, error) {
+	refs, err := r.ReflogRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, ref := range refs {
+		entries, err := r.ReadReflog(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reflog of %s: %w", ref, err)
+		}
+		for _, entry := range entries {
+			for _, hash := range []string{entry.OldHash, entry.NewHash} {
+				if hash != "" && !seen[hash] {
+					seen[hash] = true
+					hashes = append(hashes, hash)
+				}
+			}
+		}
+	}
+	return hashes, nil
+}
+
+func formatReflogEntry(entry ReflogEntry) string {
+	oldHash, newHash := entry.OldHash, entry.NewHash
+	if oldHash == "" {
+		oldHash = ZeroHash
+	}
+	if newHash == "" {
+		newHash = ZeroHash
+	}
+	message := strings.ReplaceAll(entry.Message, "\n", " ")
+	return fmt.Sprintf("%s %s %s\t%s\n", oldHash, newHash, entry.Committer, message)
+}
+
+// ReadReflog returns the entries of a ref's reflog, oldest first. A ref
+// without a reflog has no entries.
+func (r *Repository) ReadReflog(ref string) ([]ReflogEntry, error) {
+	f, err := os.Open(r.reflogPath(ref))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open reflog: %w", err)
+	}
+	defer f.Close()
+
+	var entries []ReflogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		meta, message, _ := strings.Cut(line, "\t")
+		parts := strings.SplitN(meta, " ", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid reflog line: %q", line)
+		}
+		sig, err := commit.ParseSignature(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid reflog line: %w", err)
+		}
+
+		entry := ReflogEntry{
+			OldHash:   parts[0],
+			NewHash:   parts[1],
+			Committer: sig,
+			Message:   message,
+		}
+		if entry.OldHash == ZeroHash {
+			entry.OldHash = ""
+		}
+		if entry.NewHash == ZeroHash {
+			entry.NewHash = ""
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read reflog: %w", err)
+	}
+
+	return entries, nil
+}
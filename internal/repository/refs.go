@@ -0,0 +1,626 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/lockfile"
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+)
+
+// ErrRefNotFound is returned, wrapped, when a ref does not exist.
+var ErrRefNotFound = errors.New("ref not found")
+
+// maxSymrefDepth bounds the chain of symbolic refs followed when resolving.
+const maxSymrefDepth = 5
+
+// Ref is the stored value of a ref: either a hash, or for a symbolic ref
+// such as HEAD the full name of the ref it points to.
+type Ref struct {
+	Name   string
+	Hash   string
+	Target string
+}
+
+func (ref Ref) IsSymbolic() bool {
+	return ref.Target != ""
+}
+
+// RefStore reads refs and changes them through transactions. Every update
+// is made under the ref's lock file and can be checked against the value
+// the caller expects, so concurrent commands cannot lose each other's
+// updates.
+type RefStore struct {
+	repo *Repository
+}
+
+func (r *Repository) Refs() *RefStore {
+	return &RefStore{repo: r}
+}
+
+func (s *RefStore) refPath(name string) string {
+	return filepath.Join(s.repo.NotgitDir, filepath.FromSlash(name))
+}
+
+// ValidateRefName checks a full ref name such as "refs/heads/main" against
+// Git's rules for ref names.
+func ValidateRefName(name string) error {
+	if name == "HEAD" {
+		return nil
+	}
+	invalid := fmt.Errorf("'%s' is not a valid ref name", name)
+	if !strings.HasPrefix(name, "refs/") ||
+		strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") ||
+		strings.ContainsAny(name, " ~^:?*[\\\x7f") {
+		return invalid
+	}
+	for _, c := range name {
+		if c < 0x20 {
+			return invalid
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return invalid
+		}
+	}
+	return nil
+}
+
+// ValidateBranchName checks a short branch name such as "feature/login".
+func ValidateBranchName(name string) error {
+	if name == "HEAD" || name == "@" || strings.HasPrefix(name, "-") || ValidateRefName("refs/heads/"+name) != nil {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	return nil
+}
+
+// checkNameConflict fails if name cannot be created because an existing ref
+// is stored where a directory for it is needed or the other way around,
+// like refs/heads/feature and refs/heads/feature/login. The ref named skip,
+// which is about to be deleted, does not count.
+func (s *RefStore) checkNameConflict(name, skip string) error {
+	parts := strings.Split(name, "/")
+	for i := 2; i < len(parts); i++ {
+		prefix := strings.Join(parts[:i], "/")
+		if prefix != skip && s.Exists(prefix) {
+			return fmt.Errorf("cannot lock ref '%s': '%s' exists; cannot create '%s'", name, prefix, name)
+		}
+	}
+
+	refs, err := s.repo.ListRefs()
+	if err != nil {
+		return err
+	}
+	for _, ref := range slices.Sorted(maps.Keys(refs)) {
+		if ref != skip && strings.HasPrefix(ref, name+"/") {
+			return fmt.Errorf("cannot lock ref '%s': '%s' exists; cannot create '%s'", name, ref, name)
+		}
+	}
+	return nil
+}
+
+// Read returns the stored value of a ref without following symbolic refs.
+// A loose ref file takes precedence over the packed-refs file.
+func (s *RefStore) Read(name string) (Ref, error) {
+	data, err := os.ReadFile(s.refPath(name))
+	if err != nil && !os.IsNotExist(err) && !isDirError(err) {
+		return Ref{}, fmt.Errorf("failed to read ref %s: %w", name, err)
+	}
+
+	content := strings.TrimSpace(string(data))
+	if content == "" {
+		packed, err := s.readPackedRefs()
+		if err != nil {
+			return Ref{}, err
+		}
+		if hash, ok := packed[name]; ok {
+			return Ref{Name: name, Hash: hash}, nil
+		}
+		return Ref{}, fmt.Errorf("%w: %s", ErrRefNotFound, name)
+	}
+	if target, ok := strings.CutPrefix(content, "ref: "); ok {
+		return Ref{Name: name, Target: strings.TrimSpace(target)}, nil
+	}
+	return Ref{Name: name, Hash: content}, nil
+}
+
+func isDirError(err error) bool {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		if info, statErr := os.Stat(pathErr.Path); statErr == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// Exists reports whether a ref holds a value.
+func (s *RefStore) Exists(name string) bool {
+	_, err := s.Read(name)
+	return err == nil
+}
+
+// ResolveSymbolic follows symbolic refs starting at name and returns the
+// name of the ref they end at, which need not exist (e.g. the branch of a
+// new repository).
+func (s *RefStore) ResolveSymbolic(name string) (string, error) {
+	for range maxSymrefDepth {
+		ref, err := s.Read(name)
+		if errors.Is(err, ErrRefNotFound) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !ref.IsSymbolic() {
+			return name, nil
+		}
+		name = ref.Target
+	}
+	return "", fmt.Errorf("symbolic ref loop at %s", name)
+}
+
+// Resolve returns the hash a ref points to, following symbolic refs.
+func (s *RefStore) Resolve(name string) (string, error) {
+	final, err := s.ResolveSymbolic(name)
+	if err != nil {
+		return "", err
+	}
+	ref, err := s.Read(final)
+	if err != nil {
+		return "", err
+	}
+	return ref.Hash, nil
+}
+
+// ListRefs returns every ref, loose or packed, keyed by its full name (e.g.
+// "refs/heads/master").
+func (r *Repository) ListRefs() (map[string]string, error) {
+	refs, err := r.Refs().readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	loose, err := r.looseRefs()
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(refs, loose)
+	return refs, nil
+}
+
+// looseRefs returns the refs stored as files under .notgit/refs.
+func (r *Repository) looseRefs() (map[string]string, error) {
+	refs := make(map[string]string)
+	refsDir := filepath.Join(r.NotgitDir, "refs")
+
+	err := filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read ref %s: %w", path, err)
+		}
+		relPath, err := filepath.Rel(r.NotgitDir, path)
+		if err != nil {
+			return err
+		}
+		if content := strings.TrimSpace(string(data)); content != "" {
+			refs[filepath.ToSlash(relPath)] = content
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+
+	return refs, nil
+}
+
+// RefUpdate is one change queued in a RefTransaction.
+type RefUpdate struct {
+	Name string
+	// NewHash is the value to store; ZeroHash deletes the ref.
+	NewHash string
+	// NewTarget, if set, makes Name a symbolic ref to this ref instead.
+	NewTarget string
+	// OldHash is the value the ref must have for the update to happen:
+	// ZeroHash requires the ref not to exist, "" skips the check.
+	OldHash string
+	// VerifyOnly checks OldHash without changing the ref.
+	VerifyOnly bool
+	// NoDeref updates Name itself even if it is a symbolic ref, instead of
+	// the ref it points to.
+	NoDeref bool
+	// Message is recorded in the reflog.
+	Message string
+}
+
+// RefTransaction changes several refs at once: either every expected old
+// value matches and all refs are updated, or none is.
+type RefTransaction struct {
+	store   *RefStore
+	updates []RefUpdate
+}
+
+func (s *RefStore) Transaction() *RefTransaction {
+	return &RefTransaction{store: s}
+}
+
+// Queue adds an update to the transaction.
+func (t *RefTransaction) Queue(update RefUpdate) {
+	t.updates = append(t.updates, update)
+}
+
+// Update points name, or the ref it symbolically points to, at newHash.
+func (t *RefTransaction) Update(name, newHash, oldHash, message string) {
+	t.Queue(RefUpdate{Name: name, NewHash: newHash, OldHash: oldHash, Message: message})
+}
+
+// Create adds a ref that must not exist yet.
+func (t *RefTransaction) Create(name, newHash, message string) {
+	t.Update(name, newHash, ZeroHash, message)
+}
+
+// Delete removes a ref, or the ref it symbolically points to.
+func (t *RefTransaction) Delete(name, oldHash, message string) {
+	t.Update(name, ZeroHash, oldHash, message)
+}
+
+// Verify checks that a ref has oldHash without changing it.
+func (t *RefTransaction) Verify(name, oldHash string) {
+	t.Queue(RefUpdate{Name: name, OldHash: oldHash, VerifyOnly: true})
+}
+
+// SetSymbolic makes name a symbolic ref pointing to target.
+func (t *RefTransaction) SetSymbolic(name, target, message string) {
+	t.Queue(RefUpdate{Name: name, NewTarget: target, NoDeref: true, Message: message})
+}
+
+type lockedUpdate struct {
+	RefUpdate
+	// ref is the ref actually changed, after following symbolic refs
+	ref string
+	// via are the symbolic refs followed to reach ref
+	via     []string
+	lock    *lockfile.LockFile
+	current string
+	// newHash is the value ref resolves to after the update
+	newHash string
+}
+
+// Commit applies the queued updates, logging them as committer.
+func (t *RefTransaction) Commit(committer commit.Signature) error {
+	updates, err := t.prepare()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, u := range updates {
+			if u.lock != nil {
+				u.lock.Rollback()
+			}
+		}
+	}()
+
+	for _, u := range updates {
+		creates := !u.VerifyOnly && (u.NewTarget != "" || u.NewHash != ZeroHash)
+		if creates && !t.store.Exists(u.ref) {
+			if err := t.store.checkNameConflict(u.ref, ""); err != nil {
+				return err
+			}
+		}
+
+		lock, err := lockfile.Acquire(t.store.refPath(u.ref))
+		if err != nil {
+			return fmt.Errorf("cannot lock ref '%s': %w", u.ref, err)
+		}
+		u.lock = lock
+
+		current, err := t.store.Read(u.ref)
+		if err != nil && !errors.Is(err, ErrRefNotFound) {
+			return err
+		}
+		u.current = current.Hash
+		if current.IsSymbolic() {
+			// Resolved to be able to log the move of a symbolic ref
+			u.current, _ = t.store.Resolve(u.ref)
+		}
+		if err := u.checkOld(current); err != nil {
+			return err
+		}
+	}
+
+	headTarget := ""
+	if head, err := t.store.Read("HEAD"); err == nil {
+		headTarget = head.Target
+	}
+
+	for _, u := range updates {
+		if u.VerifyOnly {
+			continue
+		}
+		if err := t.write(u); err != nil {
+			return err
+		}
+	}
+
+	// Deleted refs may also be packed; they are removed from packed-refs
+	// while their loose refs are still locked
+	var deleted []string
+	for _, u := range updates {
+		if !u.VerifyOnly && u.NewTarget == "" && u.NewHash == ZeroHash {
+			deleted = append(deleted, u.ref)
+		}
+	}
+	if err := t.store.removePacked(deleted); err != nil {
+		return err
+	}
+
+	for _, u := range updates {
+		if err := t.finish(u); err != nil {
+			return err
+		}
+	}
+
+	// Only now that every ref is in place are the updates logged. Reflogs of
+	// deleted refs go last, so a failure cannot lose their history before
+	// the refs are gone.
+	for _, u := range updates {
+		if !u.VerifyOnly && u.newHash != ZeroHash {
+			if err := t.log(u, headTarget, committer); err != nil {
+				return err
+			}
+		}
+	}
+	for _, u := range updates {
+		if !u.VerifyOnly && u.newHash == ZeroHash {
+			if err := t.store.repo.DeleteReflog(u.ref); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prepare validates the updates, follows symbolic refs and orders the
+// updates by ref name, so that concurrent transactions take locks in the
+// same order.
+func (t *RefTransaction) prepare() ([]*lockedUpdate, error) {
+	seen := make(map[string]bool)
+	var updates []*lockedUpdate
+	for _, update := range t.updates {
+		u := &lockedUpdate{RefUpdate: update, ref: update.Name}
+		if err := ValidateRefName(u.Name); err != nil {
+			return nil, err
+		}
+		if u.NewTarget != "" {
+			if err := ValidateRefName(u.NewTarget); err != nil {
+				return nil, err
+			}
+		}
+
+		if !u.NoDeref {
+			for range maxSymrefDepth {
+				ref, err := t.store.Read(u.ref)
+				if err != nil || !ref.IsSymbolic() {
+					break
+				}
+				u.via = append(u.via, u.ref)
+				u.ref = ref.Target
+			}
+			if err := ValidateRefName(u.ref); err != nil {
+				return nil, err
+			}
+		}
+
+		if seen[u.ref] {
+			return nil, fmt.Errorf("multiple updates for ref '%s' not allowed", u.ref)
+		}
+		seen[u.ref] = true
+		updates = append(updates, u)
+	}
+
+	sort.Slice(updates, func(i, j int) bool { return updates[i].ref < updates[j].ref })
+	return updates, nil
+}
+
+func (u *lockedUpdate) checkOld(current Ref) error {
+	switch {
+	case u.OldHash == "":
+		return nil
+	case u.OldHash == ZeroHash:
+		if current.Name != "" {
+			return fmt.Errorf("cannot lock ref '%s': reference already exists", u.ref)
+		}
+	case current.Name == "":
+		return fmt.Errorf("cannot lock ref '%s': unable to resolve reference", u.ref)
+	case u.current != u.OldHash:
+		return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", u.ref, u.current, u.OldHash)
+	}
+	return nil
+}
+
+// write stores the new value in the lock file.
+func (t *RefTransaction) write(u *lockedUpdate) error {
+	u.newHash = u.NewHash
+	if u.NewTarget != "" {
+		if _, err := fmt.Fprintf(u.lock, "ref: %s\n", u.NewTarget); err != nil {
+			return fmt.Errorf("failed to write ref %s: %w", u.ref, err)
+		}
+		u.newHash, _ = t.store.Resolve(u.NewTarget)
+	} else if u.newHash != ZeroHash {
+		if _, err := fmt.Fprintf(u.lock, "%s\n", u.newHash); err != nil {
+			return fmt.Errorf("failed to write ref %s: %w", u.ref, err)
+		}
+	}
+	return nil
+}
+
+// log appends the update to the reflogs of the ref, the symbolic refs
+// followed to reach it and HEAD if it points there.
+func (t *RefTransaction) log(u *lockedUpdate, headTarget string, committer commit.Signature) error {
+	logged := append([]string{u.ref}, u.via...)
+	if headTarget == u.ref && !slices.Contains(u.via, "HEAD") {
+		logged = append(logged, "HEAD")
+	}
+	entry := ReflogEntry{OldHash: u.current, NewHash: u.newHash, Committer: committer, Message: u.Message}
+	for _, ref := range logged {
+		if !t.store.shouldLog(ref) {
+			continue
+		}
+		if err := t.store.repo.AppendReflog(ref, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish replaces the ref with its lock file, or removes it for deletions.
+func (t *RefTransaction) finish(u *lockedUpdate) error {
+	if u.VerifyOnly {
+		return nil
+	}
+	if u.NewTarget == "" && u.NewHash == ZeroHash {
+		path := t.store.refPath(u.ref)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete ref %s: %w", u.ref, err)
+		}
+		u.lock.Rollback()
+		u.lock = nil
+		pruneEmptyDirs(filepath.Dir(path), filepath.Join(t.store.repo.NotgitDir, "refs"))
+		return nil
+	}
+
+	if err := u.lock.Commit(0o644); err != nil {
+		return fmt.Errorf("failed to write ref %s: %w", u.ref, err)
+	}
+	u.lock = nil
+	return nil
+}
+
+// shouldLog reports whether updates of a ref are recorded in a reflog: those
+// of HEAD and branches always are, other refs only once they have a reflog.
+func (s *RefStore) shouldLog(name string) bool {
+	if name == "HEAD" || strings.HasPrefix(name, "refs/heads/") {
+		return true
+	}
+	_, err := os.Stat(s.repo.reflogPath(name))
+	return err == nil
+}
+
+// pruneEmptyDirs removes directories left empty by deleting nested refs,
+// starting at dir and keeping the direct children of root such as
+// refs/heads.
+func pruneEmptyDirs(dir, root string) {
+	for filepath.Dir(dir) != root && strings.HasPrefix(dir, root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// Rename moves a ref and its reflog to a new name, which must not exist,
+// and repoints HEAD if it was attached to the old name.
+func (s *RefStore) Rename(oldName, newName string, committer commit.Signature, message string) error {
+	for _, name := range []string{oldName, newName} {
+		if err := ValidateRefName(name); err != nil {
+			return err
+		}
+	}
+	// The old ref is deleted before the new one is created, so it cannot be
+	// in the way, as in topic -> topic/x or topic/x -> topic
+	if !s.Exists(newName) {
+		if err := s.checkNameConflict(newName, oldName); err != nil {
+			return err
+		}
+	}
+
+	oldLock, err := lockfile.Acquire(s.refPath(oldName))
+	if err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %w", oldName, err)
+	}
+	defer oldLock.Rollback()
+
+	old, err := s.Read(oldName)
+	if err != nil {
+		return err
+	}
+	if s.Exists(newName) {
+		return fmt.Errorf("cannot rename ref '%s': '%s' already exists", oldName, newName)
+	}
+
+	if err := s.removePacked([]string{oldName}); err != nil {
+		return err
+	}
+	oldPath := s.refPath(oldName)
+	if err := os.Remove(oldPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete ref %s: %w", oldName, err)
+	}
+	oldLock.Rollback()
+	pruneEmptyDirs(filepath.Dir(oldPath), filepath.Join(s.repo.NotgitDir, "refs"))
+
+	if err := s.writeRenamedRef(newName, old.Hash); err != nil {
+		// Put the old ref back rather than lose the branch
+		if restoreErr := lockfile.WriteFile(oldPath, []byte(old.Hash+"\n"), 0o644); restoreErr != nil {
+			return fmt.Errorf("%w; restoring %s to %s also failed: %v", err, oldName, old.Hash, restoreErr)
+		}
+		return err
+	}
+
+	if err := s.repo.RenameReflog(oldName, newName); err != nil {
+		return err
+	}
+	entry := ReflogEntry{OldHash: old.Hash, NewHash: old.Hash, Committer: committer, Message: message}
+	if err := s.repo.AppendReflog(newName, entry); err != nil {
+		return err
+	}
+
+	if head, err := s.Read("HEAD"); err == nil && head.Target == oldName {
+		if err := lockfile.WriteFile(s.refPath("HEAD"), []byte("ref: "+newName+"\n"), 0o644); err != nil {
+			return fmt.Errorf("failed to update HEAD: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *RefStore) writeRenamedRef(name, hash string) error {
+	lock, err := lockfile.Acquire(s.refPath(name))
+	if err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %w", name, err)
+	}
+	defer lock.Rollback()
+	if _, err := fmt.Fprintf(lock, "%s\n", hash); err != nil {
+		return fmt.Errorf("failed to write ref %s (was %s): %w", name, hash, err)
+	}
+	if err := lock.Commit(0o644); err != nil {
+		return fmt.Errorf("failed to write ref %s (was %s): %w", name, hash, err)
+	}
+	return nil
+}
+
+// UpdateRef points ref (e.g. "refs/heads/master") at newHash and appends the
+// change to the ref's reflog. When HEAD is attached to the ref, the update is
+// logged for HEAD as well.
+func (r *Repository) UpdateRef(ref, newHash string, committer commit.Signature, reason string) error {
+	tx := r.Refs().Transaction()
+	tx.Queue(RefUpdate{Name: ref, NewHash: newHash, NoDeref: true, Message: reason})
+	return tx.Commit(committer)
+}
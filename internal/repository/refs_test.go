@@ -0,0 +1,213 @@
+package repository_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefTransaction(t *testing.T) {
+	tmp := t.TempDir()
+	repo := &repository.Repository{NotgitDir: tmp}
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "HEAD"), []byte("ref: refs/heads/main\n"), 0o644))
+
+	sig := commit.Signature{Name: "Tester", Email: "tester@example.com", Time: time.Unix(1700000000, 0)}
+	first := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	second := "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	refs := repo.Refs()
+
+	// Updating HEAD creates the branch it points to
+	tx := refs.Transaction()
+	tx.Update("HEAD", first, repository.ZeroHash, "commit (initial): one")
+	require.NoError(t, tx.Commit(sig))
+
+	hash, err := refs.Resolve("HEAD")
+	require.NoError(t, err)
+	require.Equal(t, first, hash)
+	head, err := refs.Read("HEAD")
+	require.NoError(t, err)
+	require.Equal(t, "refs/heads/main", head.Target)
+
+	// A stale expected value fails and changes nothing, including the other
+	// refs of the transaction
+	tx = refs.Transaction()
+	tx.Create("refs/tags/v1", first, "")
+	tx.Update("refs/heads/main", second, second, "")
+	err = tx.Commit(sig)
+	require.ErrorContains(t, err, "is at "+first+" but expected "+second)
+	require.False(t, refs.Exists("refs/tags/v1"))
+	require.NoFileExists(t, filepath.Join(tmp, "refs", "heads", "main.lock"))
+
+	tx = refs.Transaction()
+	tx.Create("refs/heads/main", second, "")
+	require.ErrorContains(t, tx.Commit(sig), "reference already exists")
+
+	tx = refs.Transaction()
+	tx.Update("refs/heads/main", second, first, "commit: two")
+	tx.Create("refs/heads/topic/x", first, "branch: Created from HEAD")
+	require.NoError(t, tx.Commit(sig))
+
+	hash, err = refs.Resolve("refs/heads/main")
+	require.NoError(t, err)
+	require.Equal(t, second, hash)
+
+	// The branch HEAD is attached to is logged for HEAD too
+	entries, err := repo.ReadReflog("HEAD")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "commit: two", entries[1].Message)
+
+	tx = refs.Transaction()
+	tx.Update("refs/heads/main", first, "", "")
+	tx.Update("HEAD", first, "", "")
+	require.ErrorContains(t, tx.Commit(sig), "multiple updates for ref 'refs/heads/main'")
+
+	tx = refs.Transaction()
+	tx.Delete("refs/heads/topic/x", first, "")
+	require.NoError(t, tx.Commit(sig))
+	require.False(t, refs.Exists("refs/heads/topic/x"))
+	require.NoDirExists(t, filepath.Join(tmp, "refs", "heads", "topic"))
+	require.NoDirExists(t, filepath.Join(tmp, "logs", "refs", "heads", "topic"))
+
+	require.NoError(t, refs.Rename("refs/heads/main", "refs/heads/trunk", sig, "Branch: renamed"))
+	head, err = refs.Read("HEAD")
+	require.NoError(t, err)
+	require.Equal(t, "refs/heads/trunk", head.Target)
+	entries, err = repo.ReadReflog("refs/heads/trunk")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	tx = refs.Transaction()
+	tx.Create("refs/heads/bad..name", first, "")
+	require.ErrorContains(t, tx.Commit(sig), "not a valid ref name")
+}
+
+func TestValidateBranchName(t *testing.T) {
+	for _, name := range []string{"main", "feature/login", "release/1.2", "user/me/topic", "fix-#12"} {
+		require.NoError(t, repository.ValidateBranchName(name), name)
+	}
+	for _, name := range []string{
+		"", "HEAD", "@", "-x", "a..b", "a/", "/a", "a//b", "a.lock", "a/b.lock/c",
+		".hidden", "a/.b", "a.", "a b", "a~1", "a^", "a:b", "a?", "a*", "a[", "a\\b", "a@{1}",
+	} {
+		require.Error(t, repository.ValidateBranchName(name), name)
+	}
+}
+
+func TestRefNameConflicts(t *testing.T) {
+	tmp := t.TempDir()
+	repo := &repository.Repository{NotgitDir: tmp}
+	sig := commit.Signature{Name: "Tester", Email: "tester@example.com", Time: time.Unix(1700000000, 0)}
+	hash := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	refs := repo.Refs()
+
+	tx := refs.Transaction()
+	tx.Create("refs/heads/feature/login", hash, "")
+	require.NoError(t, tx.Commit(sig))
+
+	tx = refs.Transaction()
+	tx.Create("refs/heads/feature", hash, "")
+	require.ErrorContains(t, tx.Commit(sig), "'refs/heads/feature/login' exists; cannot create 'refs/heads/feature'")
+
+	tx = refs.Transaction()
+	tx.Create("refs/heads/feature/login/x", hash, "")
+	require.ErrorContains(t, tx.Commit(sig), "'refs/heads/feature/login' exists; cannot create 'refs/heads/feature/login/x'")
+
+	// Renaming away the nested branch frees the name
+	require.NoError(t, refs.Rename("refs/heads/feature/login", "refs/heads/login", sig, ""))
+	require.NoDirExists(t, filepath.Join(tmp, "refs", "heads", "feature"))
+	tx = refs.Transaction()
+	tx.Create("refs/heads/feature", hash, "")
+	require.NoError(t, tx.Commit(sig))
+
+	// A branch can be renamed into a directory named after itself, taking
+	// HEAD and its reflog along
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "HEAD"), []byte("ref: refs/heads/feature\n"), 0o644))
+	require.NoError(t, refs.Rename("refs/heads/feature", "refs/heads/feature/x", sig, "Branch: renamed"))
+	require.False(t, refs.Exists("refs/heads/feature"))
+	resolved, err := refs.Resolve("HEAD")
+	require.NoError(t, err)
+	require.Equal(t, hash, resolved)
+	head, err := refs.Read("HEAD")
+	require.NoError(t, err)
+	require.Equal(t, "refs/heads/feature/x", head.Target)
+	entries, err := repo.ReadReflog("refs/heads/feature/x")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// Another ref still blocks the name
+	tx = refs.Transaction()
+	tx.Create("refs/heads/other", hash, "")
+	require.NoError(t, tx.Commit(sig))
+	require.ErrorContains(t, refs.Rename("refs/heads/other", "refs/heads/feature", sig, ""), "'refs/heads/feature/x' exists; cannot create 'refs/heads/feature'")
+	require.True(t, refs.Exists("refs/heads/other"))
+}
+
+func TestPackedRefs(t *testing.T) {
+	tmp := t.TempDir()
+	repo := &repository.Repository{NotgitDir: tmp}
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "HEAD"), []byte("ref: refs/heads/main\n"), 0o644))
+	sig := commit.Signature{Name: "Tester", Email: "tester@example.com", Time: time.Unix(1700000000, 0)}
+	first := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	second := "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	refs := repo.Refs()
+
+	tx := refs.Transaction()
+	tx.Create("refs/heads/main", first, "")
+	tx.Create("refs/heads/topic/x", first, "")
+	tx.Create("refs/tags/v1", first, "")
+	require.NoError(t, tx.Commit(sig))
+
+	// Without --all only tags are packed
+	count, err := refs.Pack(false)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.NoFileExists(t, filepath.Join(tmp, "refs", "tags", "v1"))
+	require.FileExists(t, filepath.Join(tmp, "refs", "heads", "main"))
+
+	count, err = refs.Pack(true)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.NoDirExists(t, filepath.Join(tmp, "refs", "heads", "topic"))
+
+	listed, err := repo.ListRefs()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"refs/heads/main":    first,
+		"refs/heads/topic/x": first,
+		"refs/tags/v1":       first,
+	}, listed)
+	head, err := repo.GetHEADCommitHash()
+	require.NoError(t, err)
+	require.Equal(t, first, head)
+
+	// A loose ref takes precedence over its packed value
+	tx = refs.Transaction()
+	tx.Update("HEAD", second, first, "commit: two")
+	require.NoError(t, tx.Commit(sig))
+	head, err = repo.GetHEADCommitHash()
+	require.NoError(t, err)
+	require.Equal(t, second, head)
+
+	// Refs only in packed form can be deleted and renamed
+	tx = refs.Transaction()
+	tx.Delete("refs/tags/v1", first, "")
+	require.NoError(t, tx.Commit(sig))
+	require.False(t, refs.Exists("refs/tags/v1"))
+
+	require.NoError(t, refs.Rename("refs/heads/topic/x", "refs/heads/topic", sig, ""))
+	require.False(t, refs.Exists("refs/heads/topic/x"))
+	hash, err := refs.Resolve("refs/heads/topic")
+	require.NoError(t, err)
+	require.Equal(t, first, hash)
+
+	data, err := os.ReadFile(filepath.Join(tmp, "packed-refs"))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "refs/tags/v1")
+	require.NotContains(t, string(data), "refs/heads/topic/x")
+}
@@ -1,24 +1,36 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Gr1shma/notgit/internal/objects/commit"
 	"github.com/Gr1shma/notgit/internal/utils"
 )
 
 type Repository struct {
 	BaseDir   string
 	NotgitDir string
+
+	packs       []*packIndex
+	packsLoaded bool
 }
 
+const infoExcludeTemplate = `# Patterns in this file are ignored like those in .notgitignore, but only
+# for this repository and without being committed.
+# Lines that start with '#' are comments.
+`
+
 func CreateRepo(basePath string) error {
 	repoPath := filepath.Join(basePath, ".notgit")
 	dirs := []string{
 		filepath.Join(repoPath, "refs", "heads"),
+		filepath.Join(repoPath, "refs", "tags"),
 		filepath.Join(repoPath, "objects"),
+		filepath.Join(repoPath, "info"),
 	}
 
 	for _, dir := range dirs {
@@ -43,6 +55,11 @@ func CreateRepo(basePath string) error {
 		return fmt.Errorf("error while writing content in HEAD: %w", err)
 	}
 
+	excludePath := filepath.Join(repoPath, "info", "exclude")
+	if err := os.WriteFile(excludePath, []byte(infoExcludeTemplate), 0o644); err != nil {
+		return fmt.Errorf("error while creating info/exclude: %w", err)
+	}
+
 	configPath := filepath.Join(repoPath, "config")
 	if err := os.WriteFile(configPath, []byte{}, 0o644); err != nil {
 		return fmt.Errorf("error while creating config file: %w", err)
@@ -64,60 +81,42 @@ func OpenRepository(startPath string) (*Repository, error) {
 }
 
 func (repo *Repository) GetCurrentBranch() (string, error) {
-	headPath := filepath.Join(repo.NotgitDir, "HEAD")
-	headData, err := os.ReadFile(headPath)
+	head, err := repo.Refs().Read("HEAD")
 	if err != nil {
 		return "", err
 	}
-	headContent := strings.TrimSpace(string(headData))
-
-	if branch, ok := strings.CutPrefix(headContent, "ref: refs/heads/"); ok {
-		return branch, nil
-	}
-
-	return "", nil
+	branch, _ := strings.CutPrefix(head.Target, "refs/heads/")
+	return branch, nil
 }
 
+// GetHEADCommitHash returns the commit HEAD points to, or "" if the current
+// branch has no commits yet.
 func (repo *Repository) GetHEADCommitHash() (string, error) {
-	headPath := filepath.Join(repo.NotgitDir, "HEAD")
-	headContent, err := os.ReadFile(headPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read HEAD file: %w", err)
+	hash, err := repo.Refs().Resolve("HEAD")
+	if errors.Is(err, ErrRefNotFound) {
+		return "", nil
 	}
-
-	ref := strings.TrimSpace(string(headContent))
-	if refPath, found := strings.CutPrefix(ref, "ref: "); found {
-		fullRefPath := filepath.Join(repo.NotgitDir, refPath)
-		commitHash, err := os.ReadFile(fullRefPath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return "", nil
-			}
-			return "", fmt.Errorf("failed to read ref file: %w", err)
-		}
-		return strings.TrimSpace(string(commitHash)), nil
-
-	}
-
-	return ref, nil
-}
-
-func (repo *Repository) UpdateHEAD(commitSHA string) error {
-	headPath := filepath.Join(repo.NotgitDir, "HEAD")
-	headContent, err := os.ReadFile(headPath)
 	if err != nil {
-		return fmt.Errorf("failed to read HEAD: %w", err)
+		return "", fmt.Errorf("failed to read HEAD: %w", err)
 	}
+	return hash, nil
+}
 
-	headStr := strings.TrimSpace(string(headContent))
+// UpdateHEAD moves the branch HEAD points to, or HEAD itself when detached,
+// to commitSHA and records the update in the reflog.
+func (repo *Repository) UpdateHEAD(commitSHA string, committer commit.Signature, reason string) error {
+	tx := repo.Refs().Transaction()
+	tx.Update("HEAD", commitSHA, "", reason)
+	return tx.Commit(committer)
+}
 
-	if refPath, ok := strings.CutPrefix(headStr, "ref: "); ok {
-		fullRefPath := filepath.Join(repo.NotgitDir, refPath)
-		if err := os.MkdirAll(filepath.Dir(fullRefPath), 0o755); err != nil {
-			return fmt.Errorf("failed to create ref dir: %w", err)
-		}
-		return os.WriteFile(fullRefPath, []byte(commitSHA+"\n"), 0o644)
+// UpdateHEADFrom is UpdateHEAD, failing if HEAD no longer points to oldHash
+// ("" for a branch without commits) because another command moved it.
+func (repo *Repository) UpdateHEADFrom(commitSHA, oldHash string, committer commit.Signature, reason string) error {
+	if oldHash == "" {
+		oldHash = ZeroHash
 	}
-
-	return os.WriteFile(headPath, []byte(commitSHA+"\n"), 0o644)
+	tx := repo.Refs().Transaction()
+	tx.Update("HEAD", commitSHA, oldHash, reason)
+	return tx.Commit(committer)
 }
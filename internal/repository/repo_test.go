@@ -4,7 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/Gr1shma/notgit/internal/objects/commit"
 	"github.com/Gr1shma/notgit/internal/repository"
 	"github.com/Gr1shma/notgit/internal/utils"
 	"github.com/stretchr/testify/require"
@@ -110,7 +112,8 @@ func TestUpdateHEAD(t *testing.T) {
 
 	// Write commit SHA to branch
 	commitSHA := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
-	err = repo.UpdateHEAD(commitSHA)
+	sig := commit.Signature{Name: "Tester", Email: "tester@example.com", Time: time.Unix(1700000000, 0)}
+	err = repo.UpdateHEAD(commitSHA, sig, "commit (initial): first")
 	require.NoError(t, err)
 
 	// Check that the branch ref file contains the commit SHA
@@ -119,12 +122,22 @@ func TestUpdateHEAD(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, commitSHA+"\n", string(data))
 
+	// The update is logged for both the branch and HEAD
+	for _, ref := range []string{"HEAD", "refs/heads/main"} {
+		entries, err := repo.ReadReflog(ref)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Empty(t, entries[0].OldHash)
+		require.Equal(t, commitSHA, entries[0].NewHash)
+		require.Equal(t, "commit (initial): first", entries[0].Message)
+	}
+
 	// Now test detached HEAD
 	detachedSHA := "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
 	err = os.WriteFile(headPath, []byte("detached-content\n"), 0o644)
 	require.NoError(t, err)
 
-	err = repo.UpdateHEAD(detachedSHA)
+	err = repo.UpdateHEAD(detachedSHA, sig, "commit: detached")
 	require.NoError(t, err)
 
 	// HEAD file itself should now contain the detached SHA
@@ -0,0 +1,540 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+)
+
+const minAbbrevLength = 4
+
+// maxTagDepth bounds how many tags pointing to tags are followed.
+const maxTagDepth = 16
+
+// ResolveRevision turns a revision expression into an object hash.
+//
+// Supported forms, which may be combined as in Git:
+//
+//	<sha1>, <short-sha1>   full or unique abbreviated object name
+//	HEAD, @                the current commit
+//	<branch>, refs/...     a ref, looked up under refs/, refs/tags/ and refs/heads/
+//	@{-<n>}                the n-th branch checked out before the current one
+//	[<ref>]@{<n>}          the value <ref> had n updates ago, from its reflog;
+//	                       without <ref>, the current branch
+//	<rev>~<n>              the n-th first-parent ancestor
+//	<rev>^<n>              the n-th parent (^0 is the commit itself)
+//	<rev>^{}, ^{commit}    the object a tag points to, peeling nested tags
+//	<rev>^{tree}           the tree of the commit
+//	<rev>:<path>           the blob or tree at path in the commit's tree
+//	:<path>                the blob staged at path in the index
+func (r *Repository) ResolveRevision(rev string) (string, error) {
+	if rev == "" {
+		return "", fmt.Errorf("empty revision")
+	}
+
+	if base, objectPath, found := strings.Cut(rev, ":"); found {
+		if base == "" {
+			return r.resolveIndexPath(objectPath)
+		}
+		hash, err := r.ResolveRevision(base)
+		if err != nil {
+			return "", err
+		}
+		return r.resolveTreePath(hash, objectPath, rev)
+	}
+
+	baseEnd := revisionBaseEnd(rev)
+	hash, err := r.resolveRevisionBase(rev[:baseEnd])
+	if err != nil {
+		return "", err
+	}
+
+	suffix := rev[baseEnd:]
+	for suffix != "" {
+		op := suffix[0]
+		suffix = suffix[1:]
+
+		if op == '^' && strings.HasPrefix(suffix, "{") {
+			end := strings.IndexByte(suffix, '}')
+			if end == -1 {
+				return "", fmt.Errorf("invalid revision '%s'", rev)
+			}
+			hash, err = r.peelRevision(hash, suffix[1:end], rev)
+			if err != nil {
+				return "", err
+			}
+			suffix = suffix[end+1:]
+			continue
+		}
+
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 0 {
+			n, err = strconv.Atoi(suffix[:digits])
+			if err != nil {
+				return "", fmt.Errorf("invalid revision '%s'", rev)
+			}
+		}
+		suffix = suffix[digits:]
+
+		switch op {
+		case '~':
+			for i := 0; i < n; i++ {
+				hash, err = r.nthParent(hash, 1, rev)
+				if err != nil {
+					return "", err
+				}
+			}
+		case '^':
+			if n == 0 {
+				hash, err = r.peelRevision(hash, "commit", rev)
+				if err != nil {
+					return "", err
+				}
+				continue
+			}
+			hash, err = r.nthParent(hash, n, rev)
+			if err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("invalid revision '%s'", rev)
+		}
+	}
+
+	return hash, nil
+}
+
+// ResolveCommit resolves a revision, peeling annotated tags, and makes sure
+// it names a commit.
+func (r *Repository) ResolveCommit(rev string) (string, error) {
+	hash, err := r.ResolveRevision(rev)
+	if err != nil {
+		return "", err
+	}
+	return r.peelRevision(hash, "commit", rev)
+}
+
+// PeelTag follows annotated tags until it reaches an object that is not a
+// tag and returns its hash. Other objects are returned unchanged.
+func (r *Repository) PeelTag(hash string) (string, error) {
+	start := hash
+	for depth := 0; depth < maxTagDepth; depth++ {
+		objectType, err := r.ObjectType(hash)
+		if err != nil {
+			return "", err
+		}
+		if objectType != "tag" {
+			return hash, nil
+		}
+		t, err := r.RetrieveTag(hash)
+		if err != nil {
+			return "", fmt.Errorf("failed to read tag %s: %w", hash, err)
+		}
+		hash = t.Object
+	}
+	return "", fmt.Errorf("tag chain starting at %s is too deep", start)
+}
+
+// ResolveBranchShorthand expands "-" and "@{-n}" to the name of the branch
+// they refer to. Anything else is returned unchanged.
+func (r *Repository) ResolveBranchShorthand(name string) (string, error) {
+	if name == "-" {
+		name = "@{-1}"
+	}
+	n, ok := parsePreviousCheckout(name)
+	if !ok {
+		return name, nil
+	}
+	return r.PreviousBranch(n)
+}
+
+// FindObjectsByPrefix returns every object, loose or packed, whose hash
+// starts with prefix.
+func (r *Repository) FindObjectsByPrefix(prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 2 || !isHex(prefix) {
+		return nil, nil
+	}
+
+	matches := make(map[string]bool)
+
+	dir := filepath.Join(r.NotgitDir, "objects", prefix[:2])
+	files, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read objects dir: %w", err)
+	}
+	for _, file := range files {
+		hash := prefix[:2] + file.Name()
+		if len(hash) == 40 && strings.HasPrefix(hash, prefix) {
+			matches[hash] = true
+		}
+	}
+
+	packs, err := r.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		for i := sort.SearchStrings(p.hashes, prefix); i < len(p.hashes) && strings.HasPrefix(p.hashes[i], prefix); i++ {
+			matches[p.hashes[i]] = true
+		}
+	}
+
+	result := make([]string, 0, len(matches))
+	for hash := range matches {
+		result = append(result, hash)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// ShortHash returns the shortest prefix of hash, at least 7 characters long,
+// that does not match any other object.
+func (r *Repository) ShortHash(hash string) string {
+	for length := 7; length < len(hash); length++ {
+		matches, err := r.FindObjectsByPrefix(hash[:length])
+		if err == nil && len(matches) <= 1 {
+			return hash[:length]
+		}
+	}
+	return hash
+}
+
+// revisionBaseEnd returns the index where the ~ and ^ suffixes of rev begin,
+// skipping over any @{...} blocks.
+func revisionBaseEnd(rev string) int {
+	for i := 0; i < len(rev); i++ {
+		if strings.HasPrefix(rev[i:], "@{") {
+			if end := strings.IndexByte(rev[i:], '}'); end != -1 {
+				i += end
+				continue
+			}
+		}
+		if rev[i] == '~' || rev[i] == '^' {
+			return i
+		}
+	}
+	return len(rev)
+}
+
+func (r *Repository) resolveRevisionBase(base string) (string, error) {
+	if base == "" {
+		return "", fmt.Errorf("missing revision before '~' or '^'")
+	}
+
+	if n, ok := parsePreviousCheckout(base); ok {
+		previous, err := r.PreviousBranch(n)
+		if err != nil {
+			return "", fmt.Errorf("cannot resolve '%s': %w", base, err)
+		}
+		return r.resolveRevisionBase(previous)
+	}
+
+	if refName, n, ok := ParseReflogSelector(base); ok {
+		return r.resolveReflogEntry(refName, n, base)
+	}
+
+	if strings.Contains(base, "@{") {
+		return "", fmt.Errorf("unsupported revision syntax '%s'", base)
+	}
+
+	if base == "HEAD" || base == "@" {
+		hash, err := r.GetHEADCommitHash()
+		if err != nil {
+			return "", err
+		}
+		if hash == "" {
+			return "", fmt.Errorf("HEAD does not point to a commit yet")
+		}
+		return hash, nil
+	}
+
+	if hash, found, err := r.lookupRef(base); err != nil {
+		return "", err
+	} else if found {
+		return hash, nil
+	}
+
+	if len(base) >= minAbbrevLength && len(base) <= 40 && isHex(base) {
+		matches, err := r.FindObjectsByPrefix(base)
+		if err != nil {
+			return "", err
+		}
+		switch len(matches) {
+		case 0:
+		case 1:
+			return matches[0], nil
+		default:
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "short object ID %s is ambiguous\nThe candidates are:", base)
+			for _, match := range matches {
+				fmt.Fprintf(&sb, "\n  %s", match)
+			}
+			return "", fmt.Errorf("%s", sb.String())
+		}
+	}
+
+	return "", fmt.Errorf("unknown revision '%s'", base)
+}
+
+// lookupRef finds a ref by name using Git's search order.
+func (r *Repository) lookupRef(name string) (string, bool, error) {
+	ref, found := r.expandRefName(name)
+	if !found {
+		return "", false, nil
+	}
+
+	hash, err := r.Refs().Resolve(ref)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read ref %s: %w", ref, err)
+	}
+	return hash, true, nil
+}
+
+// expandRefName returns the full name of the first existing, non-empty ref
+// matching name, trying name itself, refs/<name>, refs/tags/<name> and
+// refs/heads/<name> in that order.
+func (r *Repository) expandRefName(name string) (string, bool) {
+	if strings.Contains(name, "..") {
+		return "", false
+	}
+
+	candidates := []string{
+		name,
+		"refs/" + name,
+		"refs/tags/" + name,
+		"refs/heads/" + name,
+	}
+
+	for _, candidate := range candidates {
+		if ValidateRefName(candidate) != nil || candidate == "HEAD" {
+			continue
+		}
+		if r.Refs().Exists(candidate) {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
+
+// ReflogRef returns the full name of the ref whose reflog <name>@{n} reads:
+// the current branch (or HEAD when detached) for an empty name, HEAD for
+// "HEAD" or "@", and otherwise the ref found by the usual search order.
+func (r *Repository) ReflogRef(name string) (string, error) {
+	switch name {
+	case "":
+		branch, err := r.GetCurrentBranch()
+		if err != nil {
+			return "", err
+		}
+		if branch == "" {
+			return "HEAD", nil
+		}
+		return "refs/heads/" + branch, nil
+	case "HEAD", "@":
+		return "HEAD", nil
+	}
+
+	if ref, found := r.expandRefName(name); found {
+		return ref, nil
+	}
+	// A deleted ref can still have a reflog
+	if strings.HasPrefix(name, "refs/") {
+		if _, err := os.Stat(r.reflogPath(name)); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown ref '%s'", name)
+}
+
+// resolveReflogEntry implements <ref>@{n}.
+func (r *Repository) resolveReflogEntry(refName string, n int, rev string) (string, error) {
+	ref, err := r.ReflogRef(refName)
+	if err != nil {
+		return "", fmt.Errorf("unknown revision '%s'", rev)
+	}
+
+	entries, err := r.ReadReflog(ref)
+	if err != nil {
+		return "", err
+	}
+	if n >= len(entries) {
+		return "", fmt.Errorf("log for '%s' only has %d entries", ref, len(entries))
+	}
+
+	hash := entries[len(entries)-1-n].NewHash
+	if hash == "" {
+		return "", fmt.Errorf("revision '%s' refers to a deleted ref", rev)
+	}
+	return hash, nil
+}
+
+// peelRevision implements <rev>^{kind}: an empty kind peels tags, "commit"
+// and "tree" additionally require (or dereference to) that object type.
+func (r *Repository) peelRevision(hash, kind, rev string) (string, error) {
+	peeled, err := r.PeelTag(hash)
+	if err != nil {
+		return "", err
+	}
+
+	switch kind {
+	case "":
+		return peeled, nil
+	case "commit":
+		if _, err := r.RetrieveCommit(peeled); err != nil {
+			return "", fmt.Errorf("revision '%s' is not a commit", rev)
+		}
+		return peeled, nil
+	case "tree":
+		if c, err := r.RetrieveCommit(peeled); err == nil {
+			return c.TreeHash, nil
+		}
+		if _, err := r.RetrieveTree(peeled); err != nil {
+			return "", fmt.Errorf("revision '%s' does not name a tree", rev)
+		}
+		return peeled, nil
+	default:
+		return "", fmt.Errorf("unsupported revision syntax '%s'", rev)
+	}
+}
+
+func (r *Repository) nthParent(hash string, n int, rev string) (string, error) {
+	hash, err := r.PeelTag(hash)
+	if err != nil {
+		return "", err
+	}
+	c, err := r.RetrieveCommit(hash)
+	if err != nil {
+		return "", fmt.Errorf("revision '%s' is not a commit", rev)
+	}
+	if n > len(c.ParentHashes) {
+		return "", fmt.Errorf("revision '%s' does not exist: commit %s has %d parent(s)", rev, hash[:7], len(c.ParentHashes))
+	}
+	return c.ParentHashes[n-1], nil
+}
+
+func (r *Repository) resolveTreePath(hash, objectPath, rev string) (string, error) {
+	hash, err := r.PeelTag(hash)
+	if err != nil {
+		return "", err
+	}
+	treeHash := hash
+	if c, err := r.RetrieveCommit(hash); err == nil {
+		treeHash = c.TreeHash
+	}
+
+	current := treeHash
+	currentType := tree.EntryTypeTree
+	for _, part := range strings.Split(objectPath, "/") {
+		if part == "" {
+			continue
+		}
+		if currentType != tree.EntryTypeTree {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", objectPath, rev)
+		}
+		t, err := r.RetrieveTree(current)
+		if err != nil {
+			return "", fmt.Errorf("revision '%s' does not name a tree", rev)
+		}
+		entry := t.GetEntry(part)
+		if entry == nil {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", objectPath, rev)
+		}
+		current, currentType = entry.Hash, entry.Type
+	}
+
+	return current, nil
+}
+
+func (r *Repository) resolveIndexPath(objectPath string) (string, error) {
+	idx, err := r.LoadIndex()
+	if err != nil {
+		return "", err
+	}
+	// :<n>:<path> names stage n of an unmerged path
+	stage := 0
+	if len(objectPath) >= 2 && objectPath[0] >= '0' && objectPath[0] <= '3' && objectPath[1] == ':' {
+		stage = int(objectPath[0] - '0')
+		objectPath = objectPath[2:]
+	}
+	objectPath = strings.Trim(objectPath, "/")
+
+	if stage == 0 {
+		entry, ok := idx.Entries[objectPath]
+		if !ok {
+			if _, unmerged := idx.Unmerged[objectPath]; unmerged {
+				return "", fmt.Errorf("path '%s' is unmerged; use :1:, :2: or :3:", objectPath)
+			}
+			return "", fmt.Errorf("path '%s' is not in the index", objectPath)
+		}
+		return entry.Hash, nil
+	}
+
+	unmerged, ok := idx.Unmerged[objectPath]
+	if entry := unmerged.Stages()[stage-1]; ok && entry != nil {
+		return entry.Hash, nil
+	}
+	return "", fmt.Errorf("path '%s' is not in the index at stage %d", objectPath, stage)
+}
+
+func parsePreviousCheckout(rev string) (int, bool) {
+	inner, ok := strings.CutPrefix(rev, "@{-")
+	if !ok {
+		return 0, false
+	}
+	inner, ok = strings.CutSuffix(inner, "}")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// ParseReflogSelector splits "<ref>@{<n>}" into the ref name (possibly
+// empty) and n.
+func ParseReflogSelector(rev string) (string, int, bool) {
+	refName, inner, found := strings.Cut(rev, "@{")
+	if !found {
+		return "", 0, false
+	}
+	inner, ok := strings.CutSuffix(inner, "}")
+	if !ok || inner == "" || !isDigits(inner) {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil {
+		return "", 0, false
+	}
+	return refName, n, true
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
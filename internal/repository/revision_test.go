@@ -0,0 +1,301 @@
+package repository_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Gr1shma/notgit/internal/objects/blob"
+	"github.com/Gr1shma/notgit/internal/objects/commit"
+	"github.com/Gr1shma/notgit/internal/objects/tag"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func storeTestCommit(t *testing.T, repo *repository.Repository, files map[string]string, message string, parents ...string) string {
+	t.Helper()
+
+	idx := repository.NewIndex()
+	for path, content := range files {
+		hash, err := repo.StoreObject(&blob.Blob{Content: []byte(content), Size: int64(len(content))})
+		require.NoError(t, err)
+		idx.AddEntry(path, hash)
+	}
+
+	treeHash, err := repo.WriteTree(idx)
+	require.NoError(t, err)
+
+	sig := commit.Signature{Name: "Tester", Email: "tester@example.com", Time: time.Unix(1700000000, 0)}
+	c := commit.NewCommit(treeHash, message, parents, sig, sig)
+	hash, err := repo.StoreObject(c)
+	require.NoError(t, err)
+	return hash
+}
+
+func writeTestRef(t *testing.T, repo *repository.Repository, ref, hash string) {
+	t.Helper()
+	refPath := filepath.Join(repo.NotgitDir, filepath.FromSlash(ref))
+	require.NoError(t, os.MkdirAll(filepath.Dir(refPath), 0o755))
+	require.NoError(t, os.WriteFile(refPath, []byte(hash+"\n"), 0o644))
+}
+
+func TestResolveRevision(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(repo.NotgitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0o644))
+
+	root := storeTestCommit(t, repo, map[string]string{"a.txt": "one"}, "root")
+	second := storeTestCommit(t, repo, map[string]string{"a.txt": "two"}, "second", root)
+	side := storeTestCommit(t, repo, map[string]string{"a.txt": "side", "lib/b.txt": "bee"}, "side", root)
+	merge := storeTestCommit(t, repo, map[string]string{"a.txt": "two", "lib/b.txt": "bee"}, "merge", second, side)
+
+	writeTestRef(t, repo, "refs/heads/main", merge)
+	writeTestRef(t, repo, "refs/heads/side", side)
+
+	cases := map[string]string{
+		"HEAD":            merge,
+		"@":               merge,
+		"main":            merge,
+		"refs/heads/main": merge,
+		"side":            side,
+		merge:             merge,
+		merge[:8]:         merge,
+		"HEAD^":           second,
+		"HEAD^1":          second,
+		"HEAD^2":          side,
+		"HEAD~1":          second,
+		"HEAD~2":          root,
+		"main^2~1":        root,
+		"HEAD^0":          merge,
+		"side~":           root,
+	}
+	for rev, expected := range cases {
+		hash, err := repo.ResolveRevision(rev)
+		require.NoError(t, err, rev)
+		require.Equal(t, expected, hash, rev)
+	}
+
+	for _, rev := range []string{"HEAD~3", "HEAD^3", "missing", "HEAD~x", "../config"} {
+		_, err := repo.ResolveRevision(rev)
+		require.Error(t, err, rev)
+	}
+}
+
+func TestResolveRevisionPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(repo.NotgitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0o644))
+
+	head := storeTestCommit(t, repo, map[string]string{"src/main.go": "package main"}, "root")
+	writeTestRef(t, repo, "refs/heads/main", head)
+
+	blobHash, err := repo.ResolveRevision("HEAD:src/main.go")
+	require.NoError(t, err)
+	retrieved, err := repo.RetrieveBlob(blobHash)
+	require.NoError(t, err)
+	require.Equal(t, "package main", string(retrieved.Content))
+
+	treeHash, err := repo.ResolveRevision("main:src")
+	require.NoError(t, err)
+	_, err = repo.RetrieveTree(treeHash)
+	require.NoError(t, err)
+
+	_, err = repo.ResolveRevision("HEAD:src/missing.go")
+	require.Error(t, err)
+
+	idx := repository.NewIndex()
+	idx.AddEntry("staged.txt", blobHash)
+	require.NoError(t, repo.SaveIndex(idx))
+
+	staged, err := repo.ResolveRevision(":staged.txt")
+	require.NoError(t, err)
+	require.Equal(t, blobHash, staged)
+}
+
+func TestResolveRevisionAmbiguousPrefix(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	// Store blobs until two of them share a four character prefix
+	seen := make(map[string]string)
+	var first, second string
+	for i := 0; first == ""; i++ {
+		content := fmt.Sprintf("blob number %d", i)
+		hash, err := repo.StoreObject(&blob.Blob{Content: []byte(content), Size: int64(len(content))})
+		require.NoError(t, err)
+		if other, ok := seen[hash[:4]]; ok {
+			first, second = other, hash
+		}
+		seen[hash[:4]] = hash
+	}
+
+	_, err = repo.ResolveRevision(first[:4])
+	require.ErrorContains(t, err, "ambiguous")
+
+	// A longer prefix disambiguates as long as it still differs
+	for length := 5; length <= 40; length++ {
+		if first[:length] != second[:length] {
+			hash, err := repo.ResolveRevision(first[:length])
+			require.NoError(t, err)
+			require.Equal(t, first, hash)
+			break
+		}
+	}
+}
+
+func TestResolvePreviousCheckout(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	main := storeTestCommit(t, repo, map[string]string{"a.txt": "main"}, "main")
+	topic := storeTestCommit(t, repo, map[string]string{"a.txt": "topic"}, "topic", main)
+	writeTestRef(t, repo, "refs/heads/main", main)
+	writeTestRef(t, repo, "refs/heads/topic", topic)
+
+	sig := commit.Signature{Name: "Tester", Email: "tester@example.com", Time: time.Unix(1700000000, 0)}
+	require.NoError(t, repo.AppendReflog("HEAD", repository.ReflogEntry{
+		OldHash: main, NewHash: topic, Committer: sig, Message: "checkout: moving from main to topic",
+	}))
+
+	name, err := repo.ResolveBranchShorthand("-")
+	require.NoError(t, err)
+	require.Equal(t, "main", name)
+
+	hash, err := repo.ResolveRevision("@{-1}")
+	require.NoError(t, err)
+	require.Equal(t, main, hash)
+
+	_, err = repo.ResolveRevision("@{-2}")
+	require.Error(t, err)
+}
+
+func TestResolveRevisionPeelsTags(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	root := storeTestCommit(t, repo, map[string]string{"a.txt": "one"}, "root")
+	head := storeTestCommit(t, repo, map[string]string{"a.txt": "two"}, "second", root)
+	writeTestRef(t, repo, "refs/heads/main", head)
+
+	sig := commit.Signature{Name: "Tester", Email: "tester@example.com", Time: time.Unix(1700000000, 0)}
+	annotated, err := repo.StoreObject(tag.NewTag(head, "commit", "v1", sig, "release"))
+	require.NoError(t, err)
+	nested, err := repo.StoreObject(tag.NewTag(annotated, "tag", "v1-signed", sig, "tag of a tag"))
+	require.NoError(t, err)
+	writeTestRef(t, repo, "refs/tags/v1", annotated)
+	writeTestRef(t, repo, "refs/tags/v1-signed", nested)
+	writeTestRef(t, repo, "refs/tags/light", root)
+
+	headCommit, err := repo.RetrieveCommit(head)
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"v1":                 annotated,
+		"v1^{}":              head,
+		"v1^0":               head,
+		"v1~1":               root,
+		"v1^{tree}":          headCommit.TreeHash,
+		"v1-signed^{commit}": head,
+		"light":              root,
+	}
+	for rev, expected := range cases {
+		hash, err := repo.ResolveRevision(rev)
+		require.NoError(t, err, rev)
+		require.Equal(t, expected, hash, rev)
+	}
+
+	hash, err := repo.ResolveCommit("v1-signed")
+	require.NoError(t, err)
+	require.Equal(t, head, hash)
+
+	blobHash, err := repo.ResolveRevision("v1:a.txt")
+	require.NoError(t, err)
+	b, err := repo.RetrieveBlob(blobHash)
+	require.NoError(t, err)
+	require.Equal(t, "two", string(b.Content))
+
+	reachable, err := repo.ReachableObjects([]string{nested})
+	require.NoError(t, err)
+	for _, hash := range []string{nested, annotated, head, root, blobHash} {
+		require.Contains(t, reachable, hash)
+	}
+}
+
+func TestResolveReflogEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(repo.NotgitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0o644))
+
+	sig := commit.Signature{Name: "Tester", Email: "tester@example.com", Time: time.Unix(1700000000, 0)}
+	first := storeTestCommit(t, repo, map[string]string{"a.txt": "one"}, "first")
+	second := storeTestCommit(t, repo, map[string]string{"a.txt": "two"}, "second", first)
+	lost := storeTestCommit(t, repo, map[string]string{"a.txt": "lost"}, "lost", second)
+
+	require.NoError(t, repo.UpdateHEAD(first, sig, "commit (initial): first"))
+	require.NoError(t, repo.UpdateHEAD(second, sig, "commit: second"))
+	require.NoError(t, repo.UpdateHEAD(lost, sig, "commit: lost"))
+	require.NoError(t, repo.UpdateRef("refs/heads/main", second, sig, "reset: moving to HEAD~1"))
+
+	cases := map[string]string{
+		"@{0}":      second,
+		"@{1}":      lost,
+		"main@{2}":  second,
+		"HEAD@{3}":  first,
+		"@{1}~1":    second,
+		"main@{1}^": second,
+	}
+	for rev, expected := range cases {
+		hash, err := repo.ResolveRevision(rev)
+		require.NoError(t, err, rev)
+		require.Equal(t, expected, hash, rev)
+	}
+
+	_, err = repo.ResolveRevision("main@{4}")
+	require.Error(t, err)
+	_, err = repo.ResolveRevision("nosuch@{0}")
+	require.Error(t, err)
+
+	hashes, err := repo.ReflogHashes()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{first, second, lost}, hashes)
+
+	refs, err := repo.ReflogRefs()
+	require.NoError(t, err)
+	require.Equal(t, []string{"HEAD", "refs/heads/main"}, refs)
+
+	require.NoError(t, repo.RenameReflog("refs/heads/main", "refs/heads/feature/x"))
+	entries, err := repo.ReadReflog("refs/heads/feature/x")
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+
+	require.NoError(t, repo.WriteReflog("refs/heads/feature/x", entries[2:]))
+	entries, err = repo.ReadReflog("refs/heads/feature/x")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "commit: lost", entries[0].Message)
+
+	require.NoError(t, repo.DeleteReflog("refs/heads/feature/x"))
+	entries, err = repo.ReadReflog("refs/heads/feature/x")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
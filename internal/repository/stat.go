@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"os"
+
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+)
+
+// FileStat is the file system metadata cached for an index entry. When a
+// file's current FileStat equals the cached one, its content is assumed
+// unchanged and it is not hashed again. Sizes and inodes are truncated to
+// 32 bits as in the index file.
+type FileStat struct {
+	Size  uint32
+	MTime int64 // nanoseconds since the epoch
+	CTime int64 // nanoseconds since the epoch, 0 if unknown
+	Inode uint32
+	Mode  uint32 // Git file mode, e.g. 0o100644
+}
+
+// StatFromFileInfo collects the cached metadata from the result of
+// os.Lstat.
+func StatFromFileInfo(info os.FileInfo) FileStat {
+	entryType := tree.EntryTypeBlob
+	switch mode := info.Mode(); {
+	case mode&os.ModeSymlink != 0:
+		entryType = tree.EntryTypeSymlink
+	case mode&0o111 != 0:
+		entryType = tree.EntryTypeExecutable
+	}
+
+	stat := FileStat{
+		Size:  uint32(info.Size()),
+		MTime: info.ModTime().UnixNano(),
+		Mode:  entryModeBits(entryType),
+	}
+	fillPlatformStat(&stat, info)
+	return stat
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"os"
+	"syscall"
+)
+
+func fillPlatformStat(stat *FileStat, info os.FileInfo) {
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		stat.CTime = sys.Ctim.Nano()
+		stat.Inode = uint32(sys.Ino)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package repository
+
+import "os"
+
+// Other platforms only compare size, mtime and mode.
+func fillPlatformStat(stat *FileStat, info os.FileInfo) {}
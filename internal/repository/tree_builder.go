@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+)
+
+type treeNode struct {
+	blobs    map[string]IndexEntry
+	children map[string]*treeNode
+}
+
+func newTreeNode() *treeNode {
+	return &treeNode{
+		blobs:    make(map[string]IndexEntry),
+		children: make(map[string]*treeNode),
+	}
+}
+
+// WriteTree stores the index as a hierarchy of tree objects (one per directory)
+// and returns the hash of the root tree.
+func (r *Repository) WriteTree(idx *Index) (string, error) {
+	root := newTreeNode()
+
+	for filePath, entry := range idx.Entries {
+		parts := strings.Split(filePath, "/")
+		node := root
+		for _, dir := range parts[:len(parts)-1] {
+			child, ok := node.children[dir]
+			if !ok {
+				child = newTreeNode()
+				node.children[dir] = child
+			}
+			node = child
+		}
+		node.blobs[parts[len(parts)-1]] = entry
+	}
+
+	return r.writeTreeNode(root)
+}
+
+func (r *Repository) writeTreeNode(node *treeNode) (string, error) {
+	names := make([]string, 0, len(node.blobs)+len(node.children))
+	for name := range node.blobs {
+		names = append(names, name)
+	}
+	for name := range node.children {
+		if _, clash := node.blobs[name]; clash {
+			return "", fmt.Errorf("path '%s' is both a file and a directory", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t := tree.NewTree()
+	for _, name := range names {
+		if child, ok := node.children[name]; ok {
+			childHash, err := r.writeTreeNode(child)
+			if err != nil {
+				return "", err
+			}
+			t.AddEntry(name, childHash, tree.EntryTypeTree)
+			continue
+		}
+		entry := node.blobs[name]
+		t.AddEntry(name, entry.Hash, entry.Type)
+	}
+
+	if err := t.ComputeHash(); err != nil {
+		return "", fmt.Errorf("failed to compute tree hash: %w", err)
+	}
+
+	if _, err := r.StoreObject(t); err != nil {
+		return "", fmt.Errorf("failed to write tree object: %w", err)
+	}
+
+	return t.GetHash(), nil
+}
+
+// ReadTree returns an index holding exactly the files of the tree, with
+// their modes, the inverse of WriteTree.
+func (r *Repository) ReadTree(treeHash string) (*Index, error) {
+	idx := NewIndex()
+	err := r.walkTreeFiles(treeHash, "", func(path string, entry tree.Entry) {
+		idx.AddEntryWithType(path, entry.Hash, entry.Type)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// ReadTreeFiles walks the tree recursively and returns every blob keyed by its
+// slash-separated path relative to the tree root.
+func (r *Repository) ReadTreeFiles(treeHash string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := r.walkTreeFiles(treeHash, "", func(path string, entry tree.Entry) {
+		files[path] = entry.Hash
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (r *Repository) walkTreeFiles(treeHash, prefix string, visit func(path string, entry tree.Entry)) error {
+	t, err := r.RetrieveTree(treeHash)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve tree %s: %w", treeHash, err)
+	}
+
+	for _, entry := range t.Entries {
+		entryPath := path.Join(prefix, entry.Name)
+		if entry.Type == tree.EntryTypeTree {
+			if err := r.walkTreeFiles(entry.Hash, entryPath, visit); err != nil {
+				return err
+			}
+			continue
+		}
+		visit(entryPath, entry)
+	}
+
+	return nil
+}
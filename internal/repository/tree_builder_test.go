@@ -0,0 +1,113 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/Gr1shma/notgit/internal/objects/tree"
+	"github.com/Gr1shma/notgit/internal/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTreeBuildsNestedTrees(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	idx := repository.NewIndex()
+	idx.AddEntry("README.md", "1111111111111111111111111111111111111111")
+	idx.AddEntry("src/main.go", "2222222222222222222222222222222222222222")
+	idx.AddEntry("src/util/helper.go", "3333333333333333333333333333333333333333")
+
+	rootHash, err := repo.WriteTree(idx)
+	require.NoError(t, err)
+
+	root, err := repo.RetrieveTree(rootHash)
+	require.NoError(t, err)
+	require.Len(t, root.Entries, 2)
+	require.Equal(t, "README.md", root.Entries[0].Name)
+	require.Equal(t, tree.EntryTypeBlob, root.Entries[0].Type)
+	require.Equal(t, "src", root.Entries[1].Name)
+	require.Equal(t, tree.EntryTypeTree, root.Entries[1].Type)
+
+	src, err := repo.RetrieveTree(root.Entries[1].Hash)
+	require.NoError(t, err)
+	require.Len(t, src.Entries, 2)
+	require.Equal(t, "main.go", src.Entries[0].Name)
+	require.Equal(t, "util", src.Entries[1].Name)
+	require.Equal(t, tree.EntryTypeTree, src.Entries[1].Type)
+
+	// Flattening the tree must give back exactly what was in the index
+	files, err := repo.ReadTreeFiles(rootHash)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	for path, entry := range idx.Entries {
+		require.Equal(t, entry.Hash, files[path])
+	}
+}
+
+func TestWriteTreeSharesUnchangedSubtrees(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	idx := repository.NewIndex()
+	idx.AddEntry("a.txt", "1111111111111111111111111111111111111111")
+	idx.AddEntry("lib/b.txt", "2222222222222222222222222222222222222222")
+
+	firstHash, err := repo.WriteTree(idx)
+	require.NoError(t, err)
+
+	idx.AddEntry("a.txt", "4444444444444444444444444444444444444444")
+	secondHash, err := repo.WriteTree(idx)
+	require.NoError(t, err)
+	require.NotEqual(t, firstHash, secondHash)
+
+	first, err := repo.RetrieveTree(firstHash)
+	require.NoError(t, err)
+	second, err := repo.RetrieveTree(secondHash)
+	require.NoError(t, err)
+
+	// The "lib" subtree did not change, so both roots point to the same object
+	require.Equal(t, first.GetEntry("lib").Hash, second.GetEntry("lib").Hash)
+}
+
+func TestWriteTreeRejectsFileDirectoryClash(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	idx := repository.NewIndex()
+	idx.AddEntry("docs", "1111111111111111111111111111111111111111")
+	idx.AddEntry("docs/guide.md", "2222222222222222222222222222222222222222")
+
+	_, err = repo.WriteTree(idx)
+	require.Error(t, err)
+}
+
+func TestReadTreeRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, repository.CreateRepo(tmpDir))
+
+	repo, err := repository.OpenRepository(tmpDir)
+	require.NoError(t, err)
+
+	idx := repository.NewIndex()
+	idx.AddEntry("a.txt", "1111111111111111111111111111111111111111")
+	idx.AddEntry("lib/b.txt", "2222222222222222222222222222222222222222")
+	idx.AddEntry("lib/deep/c.txt", "3333333333333333333333333333333333333333")
+	idx.AddEntryWithType("run.sh", "4444444444444444444444444444444444444444", tree.EntryTypeExecutable)
+	idx.AddEntryWithType("lib/link", "5555555555555555555555555555555555555555", tree.EntryTypeSymlink)
+
+	treeHash, err := repo.WriteTree(idx)
+	require.NoError(t, err)
+
+	readBack, err := repo.ReadTree(treeHash)
+	require.NoError(t, err)
+	require.Equal(t, idx.Entries, readBack.Entries)
+}
@@ -1,11 +1,13 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Gr1shma/notgit/internal/lockfile"
 	"gopkg.in/ini.v1"
 )
 
@@ -79,6 +81,14 @@ var configSchema = map[string]map[string]ConfigKeyInfo{
 		"editor": {
 			Description: "Default text editor (e.g., vim, nvim, nano)",
 		},
+		"excludesFile": {
+			Description: "Global ignore file (default: ~/.config/notgit/ignore)",
+		},
+	},
+	"commit": {
+		"cleanup": {
+			Description: "How commit messages are cleaned up (strip, whitespace, verbatim, scissors, default)",
+		},
 	},
 	"init": {
 		"defaultBranch": {
@@ -123,8 +133,14 @@ func PrintSupportedConfigKeys() string {
 	return sb.String()
 }
 
+// SaveConfig atomically replaces the config file at path while holding its
+// lock.
 func SaveConfig(cfg *ini.File, path string) error {
-	return cfg.SaveTo(path)
+	var buf bytes.Buffer
+	if _, err := cfg.WriteTo(&buf); err != nil {
+		return err
+	}
+	return lockfile.WriteFile(path, buf.Bytes(), 0o644)
 }
 
 func GetConfigKeyValue(cfg *ini.File, key string) (string, error) {